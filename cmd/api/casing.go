@@ -0,0 +1,114 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// snakeCaseDecoder returns a decoder of the body where the camelCase keys
+// of a JSON object are renamed to the snake_case fields of dst.
+//
+// Only the top-level keys unknown to dst are renamed, and a key given in
+// both casings keeps its snake_case value. Bodies which are not a JSON
+// object are decoded as is.
+func snakeCaseDecoder(body io.Reader, dst interface{}) (*json.Decoder, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := jsonFields(dst)
+
+	var object map[string]json.RawMessage
+	if len(fields) == 0 || json.Unmarshal(data, &object) != nil {
+		return json.NewDecoder(bytes.NewReader(data)), nil
+	}
+
+	normalized := make(map[string]json.RawMessage, len(object))
+	for key, value := range object {
+		if !fields[strings.ToLower(key)] && fields[snakeCase(key)] {
+			if _, ok := object[snakeCase(key)]; ok {
+				continue
+			}
+			key = snakeCase(key)
+		}
+		normalized[key] = value
+	}
+
+	data, err = json.Marshal(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.NewDecoder(bytes.NewReader(data)), nil
+}
+
+// jsonFields returns the lowercased JSON field names of the struct
+// pointed to by dst.
+func jsonFields(dst interface{}) map[string]bool {
+	typ := reflect.TypeOf(dst)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields := make(map[string]bool, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = true
+	}
+
+	return fields
+}
+
+// snakeCase converts a camelCase key to snake_case, separating the
+// words and the numbers, such as "countryCodeAlpha2" to
+// "country_code_alpha_2".
+func snakeCase(key string) string {
+	var b strings.Builder
+	var prev rune
+	for i, r := range key {
+		switch {
+		case i > 0 && unicode.IsUpper(r) && prev != '_':
+			b.WriteByte('_')
+		case i > 0 && unicode.IsDigit(r) && unicode.IsLetter(prev):
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+		prev = r
+	}
+
+	return b.String()
+}
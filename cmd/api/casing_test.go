@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"firstName":         "first_name",
+		"first_name":        "first_name",
+		"countryCodeAlpha2": "country_code_alpha_2",
+		"email":             "email",
+	}
+
+	for key, expected := range tests {
+		require.Equal(t, expected, snakeCase(key), key)
+	}
+}
+
+func TestCreateUserHandlerCamelCase(t *testing.T) {
+	bodies := map[string]string{
+		`snake_case`: `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`,
+		`camelCase`:  `{"email":"john.doe@example.com","firstName":"John","lastName":"Doe","provinceCode":"ON","countryCodeAlpha2":"CA"}`,
+	}
+
+	var created []data.User
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.camelCaseInput = true
+
+			rr := httptest.NewRecorder()
+			app.createUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+			require.Equal(t, http.StatusCreated, rr.Code)
+
+			var response struct {
+				User data.User `json:"user"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			created = append(created, response.User)
+		})
+	}
+
+	require.Len(t, created, 2)
+	for i := range created {
+		created[i].ID = ""
+	}
+	require.Equal(t, created[0], created[1])
+}
+
+func TestReadJSONCamelCase(t *testing.T) {
+	tests := map[string]struct {
+		camelCase bool
+		body      string
+		expected  string
+		err       string
+	}{
+		`camelCase disabled`: {
+			body: `{"firstName":"John"}`,
+			err:  `body contains unknown key "firstName"`,
+		},
+		`camelCase enabled`: {
+			camelCase: true,
+			body:      `{"firstName":"John"}`,
+			expected:  "John",
+		},
+		`snake_case wins`: {
+			camelCase: true,
+			body:      `{"firstName":"Jack","first_name":"John"}`,
+			expected:  "John",
+		},
+		`unknown key`: {
+			camelCase: true,
+			body:      `{"middleName":"Jack"}`,
+			err:       `body contains unknown key "middleName"`,
+		},
+		`badly-formed JSON`: {
+			camelCase: true,
+			body:      `{"firstName":"John"`,
+			err:       "body contains badly-formed JSON",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := &application{}
+			app.config.camelCaseInput = tt.camelCase
+
+			var input struct {
+				FirstName string `json:"first_name"`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			err := app.readJSON(httptest.NewRecorder(), req, &input)
+
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, input.FirstName)
+		})
+	}
+}
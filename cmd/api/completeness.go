@@ -0,0 +1,38 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/http"
+	"user-service.mykapital.io/internal/user"
+)
+
+// showCompletenessHandler scores how complete the profile of a user is,
+// from the optional sections which are filled, and lists the sections
+// still missing.
+func (app *application) showCompletenessHandler(w http.ResponseWriter, r *http.Request) {
+	usr, ok := app.getUser(w, r)
+	if !ok {
+		return
+	}
+
+	score, missing := user.Completeness(usr, user.CompletenessWeights)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"completeness": envelope{"score": score, "missing": missing}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+)
+
+func TestShowCompletenessHandler(t *testing.T) {
+	const id = "5b1c7e0a-8d2f-4a63-b9e4-2c7f1a3d6e58"
+
+	tests := map[string]struct {
+		user            *data.User
+		expectedScore   int
+		expectedMissing []string
+	}{
+		`empty profile`: {
+			user:            &data.User{ID: id},
+			expectedScore:   0,
+			expectedMissing: []string{"date_of_birth", "debts", "dependents", "goals", "income", "protections", "spouse"},
+		},
+		`partial profile`: {
+			user:            &data.User{ID: id, DateOfBirth: "1990-05-01", Goals: []user.Goal{{Title: "House"}}},
+			expectedScore:   40,
+			expectedMissing: []string{"debts", "dependents", "income", "protections", "spouse"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			seedUsers(t, fake, tt.user)
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/"+id+"/completeness", nil)
+			rr := httptest.NewRecorder()
+			app.showCompletenessHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			var response struct {
+				Completeness struct {
+					Score   int      `json:"score"`
+					Missing []string `json:"missing"`
+				} `json:"completeness"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Equal(t, tt.expectedScore, response.Completeness.Score)
+			require.Equal(t, tt.expectedMissing, response.Completeness.Missing)
+		})
+	}
+
+	t.Run("missing user", func(t *testing.T) {
+		app, _ := newTestApplication(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/v1/users/"+id+"/completeness", nil)
+		rr := httptest.NewRecorder()
+		app.showCompletenessHandler(rr, withParams(req, "id", id))
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/http"
+
+	"user-service.mykapital.io/internal/user"
+)
+
+// readConsistencyHeader lets trusted callers choose the consistency of
+// the reads of a request, either "strong" or "eventual".
+const readConsistencyHeader = "X-Read-Consistency"
+
+// users returns the user model for the request.
+//
+// The reads are strongly consistent when an authenticated caller asks for
+// it with the X-Read-Consistency header, or eventually consistent when it
+// asks for that instead. The header of anonymous callers is ignored, as
+// strong reads cost twice as much.
+func (app *application) users(r *http.Request) user.Model {
+	users := app.models.Users
+	if app.contextGetCaller(r).IsAnonymous() {
+		return users
+	}
+
+	switch r.Header.Get(readConsistencyHeader) {
+	case "strong":
+		users.ConsistentRead = true
+	case "eventual":
+		users.ConsistentRead = false
+	}
+
+	return users
+}
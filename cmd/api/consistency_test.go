@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+// consistencyRecorder records the consistency of the last GetItem call.
+type consistencyRecorder struct {
+	*testsupport.FakeDynamoDB
+	mu         sync.Mutex
+	consistent bool
+}
+
+func (c *consistencyRecorder) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	c.consistent = aws.ToBool(params.ConsistentRead)
+	c.mu.Unlock()
+
+	return c.FakeDynamoDB.GetItem(ctx, params, optFns...)
+}
+
+func TestReadConsistencyHeader(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		key         string
+		consistency string
+		expected    bool
+	}{
+		`trusted caller asking for strong reads`:   {key: "support-key", consistency: "strong", expected: true},
+		`trusted caller asking for eventual reads`: {key: "support-key", consistency: "eventual", expected: false},
+		`trusted caller without the header`:        {key: "support-key", expected: false},
+		`anonymous caller asking for strong reads`: {consistency: "strong", expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.apiKeys = map[string]string{"support-key": roleSupport}
+			recorder := &consistencyRecorder{FakeDynamoDB: fake}
+			app.models.Users.DynamoDbClient = recorder
+			seedUsers(t, fake, &data.User{ID: id, FirstName: "John"})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			if tt.consistency != "" {
+				req.Header.Set(readConsistencyHeader, tt.consistency)
+			}
+			rr := httptest.NewRecorder()
+
+			app.authenticate(app.router()).ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, tt.expected, recorder.consistent)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const (
+	callerContextKey    = contextKey("caller")
+	requestIDContextKey = contextKey("requestID")
+)
+
+// Roles of the callers authenticated with an API key.
+const (
+	roleAdmin   = "admin"
+	roleSupport = "support"
+)
+
+// caller is the client of a request.
+type caller struct {
+	// Key is the API key of the caller, empty for anonymous callers.
+	Key  string
+	Role string
+}
+
+var anonymousCaller = &caller{}
+
+// IsAnonymous reports whether the caller did not authenticate.
+func (c *caller) IsAnonymous() bool {
+	return c == anonymousCaller
+}
+
+func (app *application) contextSetCaller(r *http.Request, c *caller) *http.Request {
+	ctx := context.WithValue(r.Context(), callerContextKey, c)
+	return r.WithContext(ctx)
+}
+
+// contextGetCaller returns the caller of the request, which is anonymous
+// when the request was not authenticated.
+func (app *application) contextGetCaller(r *http.Request) *caller {
+	c, ok := r.Context().Value(callerContextKey).(*caller)
+	if !ok {
+		return anonymousCaller
+	}
+
+	return c
+}
+
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the ID of the request, which is empty when
+// the request didn't go through the requestID middleware.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
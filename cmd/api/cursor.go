@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor returns the opaque cursor of the key where a list resumes.
+//
+// An empty cursor is returned for a nil key, as the list is complete.
+func encodeCursor(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	var values map[string]interface{}
+	err := attributevalue.UnmarshalMap(key, &values)
+	if err != nil {
+		return "", err
+	}
+
+	js, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(js), nil
+}
+
+// decodeCursor returns the key of a cursor given by encodeCursor.
+//
+// An empty cursor starts the list from the beginning.
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	js, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var values map[string]interface{}
+	err = json.Unmarshal(js, &values)
+	if err != nil || len(values) == 0 {
+		return nil, errInvalidCursor
+	}
+
+	key, err := attributevalue.MarshalMap(values)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return key, nil
+}
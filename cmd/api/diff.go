@@ -0,0 +1,49 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"reflect"
+	"strings"
+	"user-service.mykapital.io/internal/data"
+)
+
+// diffUsers returns the fields which differ between the old and the new
+// user, as a pair of the old and the new value.
+//
+// Fields are named after their DynamoDB attribute. A nil user is compared
+// as an empty one.
+func diffUsers(old, new *data.User) map[string][2]interface{} {
+	if old == nil {
+		old = &data.User{}
+	}
+	if new == nil {
+		new = &data.User{}
+	}
+
+	diff := make(map[string][2]interface{})
+	oldVal, newVal := reflect.ValueOf(*old), reflect.ValueOf(*new)
+	typ := oldVal.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		oldField, newField := oldVal.Field(i).Interface(), newVal.Field(i).Interface()
+		if !reflect.DeepEqual(oldField, newField) {
+			name := strings.Split(typ.Field(i).Tag.Get("dynamodbav"), ",")[0]
+			diff[name] = [2]interface{}{oldField, newField}
+		}
+	}
+
+	return diff
+}
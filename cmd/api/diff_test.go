@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+)
+
+func TestDiffUsers(t *testing.T) {
+	milestone := user.Milestone{Date: "2023-02-05", Title: "Bank Opened", Type: "Debt"}
+
+	tests := map[string]struct {
+		old      *data.User
+		new      *data.User
+		expected map[string][2]interface{}
+	}{
+		`no change`: {
+			old:      &data.User{ID: "1", FirstName: "John", Version: 1},
+			new:      &data.User{ID: "1", FirstName: "John", Version: 1},
+			expected: map[string][2]interface{}{},
+		},
+		`scalar changes`: {
+			old: &data.User{ID: "1", FirstName: "John", Occupation: "", Version: 1},
+			new: &data.User{ID: "1", FirstName: "Johnny", Occupation: "Engineer", Version: 2},
+			expected: map[string][2]interface{}{
+				"firstName":  {"John", "Johnny"},
+				"occupation": {"", "Engineer"},
+				"version":    {int64(1), int64(2)},
+			},
+		},
+		`slice change`: {
+			old: &data.User{ID: "1"},
+			new: &data.User{ID: "1", Milestones: []user.Milestone{milestone}},
+			expected: map[string][2]interface{}{
+				"milestones": {[]user.Milestone(nil), []user.Milestone{milestone}},
+			},
+		},
+		`missing old user`: {
+			old: nil,
+			new: &data.User{ID: "1"},
+			expected: map[string][2]interface{}{
+				"userID": {"", "1"},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, diffUsers(tt.old, tt.new))
+		})
+	}
+}
@@ -16,19 +16,37 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"user-service.mykapital.io/internal/user"
 )
 
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
+		"request_id":     app.contextGetRequestID(r),
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
 	})
 }
 
+// errorResponse sends the error message, along with the time of the error
+// and the ID of the request, so the error can be matched with the logs.
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	env := envelope{"error": message}
+	app.errorEnvelopeResponse(w, r, status, envelope{"error": message})
+}
+
+// errorEnvelopeResponse sends the error envelope, completed like in
+// errorResponse.
+func (app *application) errorEnvelopeResponse(w http.ResponseWriter, r *http.Request, status int, env envelope) {
+	env["timestamp"] = app.now().UTC().Format(time.RFC3339)
+	if id := app.contextGetRequestID(r); id != "" {
+		env["request_id"] = id
+	}
 
 	err := app.writeJSON(w, status, env, nil)
 	if err != nil {
@@ -37,11 +55,35 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 	}
 }
 
+// serverErrorResponse logs the error, and sends a generic message.
+//
+// With debug errors, the error and the stack trace are sent along, to
+// speed up debugging. They are never sent in production.
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	env := envelope{"error": message}
+	if app.debugErrors() {
+		env["debug"] = map[string]string{
+			"detail": err.Error(),
+			"trace":  string(debug.Stack()),
+		}
+	}
+	app.errorEnvelopeResponse(w, r, http.StatusInternalServerError, env)
+}
+
+// debugErrors reports whether the server errors are sent with their
+// detail: in development, or when enabled outside of production.
+func (app *application) debugErrors() bool {
+	switch app.config.env {
+	case "production":
+		return false
+	case "development":
+		return true
+	default:
+		return app.config.debugErrors
+	}
 }
 
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
@@ -49,15 +91,31 @@ func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request)
 	app.errorResponse(w, r, http.StatusNotFound, message)
 }
 
+// methodNotAllowedResponse is the MethodNotAllowed handler of the router,
+// which sets the Allow header to the methods of the resource beforehand.
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
 	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
 }
 
+// badRequestResponse answers the requests which can't be parsed, such as
+// a malformed body, a field of the wrong type or an unknown field. A body
+// of an unsupported charset is answered with 415 Unsupported Media Type.
+//
+// The requests which are parsed, but fail the validation, are answered
+// with failedValidationResponse instead.
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var charsetErr *unsupportedCharsetError
+	if errors.As(err, &charsetErr) {
+		app.errorResponse(w, r, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
 	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
 }
 
+// failedValidationResponse answers the requests which are parsed, but
+// whose values fail the validation.
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
@@ -67,7 +125,54 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) duplicateUserResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a user with this id already exists, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the user doesn't match the conditions of the request"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) pendingVerificationResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a registration with this email address is pending verification, please use the verification email or request a new one"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) phoneLockedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "too many failed verification attempts, please wait for the code to expire and request a new one"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+func (app *application) phoneCooldownResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(user.PhoneResendCooldown.Seconds())))
+	message := "a verification code was sent recently, please wait before requesting a new one"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// rateLimitExceededResponse answers the requests rejected by the rate
+// limiter. The envelope has a code along with the message, so the clients
+// can tell it from the other 429 responses. The Retry-After header is set
+// by the rate limiter beforehand.
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorEnvelopeResponse(w, r, http.StatusTooManyRequests, envelope{"error": message, "code": "RATE_LIMITED"})
+}
+
+func (app *application) headerFieldsTooLargeResponse(w http.ResponseWriter, r *http.Request, header string) {
+	message := fmt.Sprintf("the %s header has too many values", header)
+	app.errorResponse(w, r, http.StatusRequestHeaderFieldsTooLarge, message)
+}
+
+func (app *application) invalidAuthenticationResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "invalid or missing API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your API key doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
 }
@@ -0,0 +1,211 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorResponseMetadata(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.clock = func() time.Time {
+		return time.Date(2023, 2, 5, 10, 30, 0, 0, time.FixedZone("EST", -5*60*60))
+	}
+	handler := app.requestID(http.HandlerFunc(app.notFoundResponse))
+
+	tests := map[string]struct {
+		header string
+	}{
+		`request ID given by the client`: {header: "lb-1234"},
+		`request ID generated`:           {header: ""},
+		`invalid request ID replaced`:    {header: "not a valid id"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/unknown", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-ID", tt.header)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			var response struct {
+				Error     string `json:"error"`
+				Timestamp string `json:"timestamp"`
+				RequestID string `json:"request_id"`
+			}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, http.StatusNotFound, rr.Code)
+			require.NotEmpty(t, response.Error)
+			require.Equal(t, "2023-02-05T15:30:00Z", response.Timestamp)
+			require.Equal(t, rr.Header().Get("X-Request-ID"), response.RequestID)
+
+			if tt.header == "lb-1234" {
+				require.Equal(t, tt.header, response.RequestID)
+			} else {
+				_, err := uuid.Parse(response.RequestID)
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMethodNotAllowedResponse(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	tests := map[string]struct {
+		method, path string
+		expected     string
+	}{
+		`collection`: {method: http.MethodPut, path: "/v1/users", expected: "GET, OPTIONS, POST"},
+		`user`:       {method: http.MethodPost, path: "/v1/users/f8ae3ad1-d5c7-4465-b446-2e931606e938", expected: "DELETE, GET, HEAD, OPTIONS, PATCH, PUT"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			app.router().ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+
+			require.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+			require.Equal(t, tt.expected, rr.Header().Get("Allow"))
+			require.Contains(t, rr.Body.String(), tt.method)
+		})
+	}
+}
+
+func TestFailureClassStatus(t *testing.T) {
+	tests := map[string]struct {
+		body        string
+		contentType string
+		expected    int
+	}{
+		`malformed JSON`:      {body: `{"email":`, expected: http.StatusBadRequest},
+		`wrong type`:          {body: `{"email":42}`, expected: http.StatusBadRequest},
+		`unknown field`:       {body: `{"email":"john.doe@example.com","nickname":"JD"}`, expected: http.StatusBadRequest},
+		`empty body`:          {body: ``, expected: http.StatusBadRequest},
+		`several JSON values`: {body: `{} {}`, expected: http.StatusBadRequest},
+		`unsupported charset`: {
+			body:        `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`,
+			contentType: "application/json; charset=utf-16",
+			expected:    http.StatusUnsupportedMediaType,
+		},
+		`failed validation`: {
+			body:     `{"email":"not-an-email","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`,
+			expected: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.requireUTF8 = true
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+
+			app.createUserHandler(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("unexpected status: got %d, want %d: %s", rr.Code, tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestServerErrorResponseDebug(t *testing.T) {
+	tests := map[string]struct {
+		env         string
+		debugErrors bool
+		expected    bool
+	}{
+		`development`:                  {env: "development", expected: true},
+		`staging`:                      {env: "staging", expected: false},
+		`staging with debug errors`:    {env: "staging", debugErrors: true, expected: true},
+		`production`:                   {env: "production", expected: false},
+		`production with debug errors`: {env: "production", debugErrors: true, expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.env = tt.env
+			app.config.debugErrors = tt.debugErrors
+			rr := httptest.NewRecorder()
+
+			app.serverErrorResponse(rr, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("table User is unreachable"))
+
+			require.Equal(t, http.StatusInternalServerError, rr.Code)
+
+			var response struct {
+				Error string `json:"error"`
+				Debug *struct {
+					Detail string `json:"detail"`
+					Trace  string `json:"trace"`
+				} `json:"debug"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Equal(t, "the server encountered a problem and could not process your request", response.Error)
+			if !tt.expected {
+				require.Nil(t, response.Debug)
+				return
+			}
+			require.NotNil(t, response.Debug)
+			require.Equal(t, "table User is unreachable", response.Debug.Detail)
+			require.Contains(t, response.Debug.Trace, "serverErrorResponse")
+		})
+	}
+}
+
+func TestRateLimitExceededResponse(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 1
+	app.config.limiter.burst = 1
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := app.requestID(app.rateLimit(ok))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	var response map[string]string
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Equal(t, "rate limit exceeded", response["error"])
+	require.Equal(t, "RATE_LIMITED", response["code"])
+	require.NotEmpty(t, response["timestamp"])
+	require.Equal(t, rr.Header().Get("X-Request-ID"), response["request_id"])
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// flattenedColumns are the keys of a flattened user, in order.
+var flattenedColumns = []string{
+	"id", "email", "first_name", "last_name", "province_code", "country_code_alpha_2",
+	"administrative_division", "currency", "date_of_birth", "occupation", "income",
+	"expenses", "family_member_number", "is_married", "created_at", "has_spouse",
+	"dependent_count", "milestone_count", "goal_count", "protection_count", "debt_count",
+	"total_debt",
+}
+
+// flatten returns the scalar attributes of a user along with counts
+// derived from its nested attributes, keyed by flattenedColumns.
+func flatten(usr *data.User) map[string]string {
+	var totalDebt user.Money
+	for _, debt := range usr.Debts {
+		totalDebt += debt.Cost
+	}
+
+	return map[string]string{
+		"id":                      usr.ID,
+		"email":                   usr.Email,
+		"first_name":              usr.FirstName,
+		"last_name":               usr.LastName,
+		"province_code":           usr.ProvinceCode,
+		"country_code_alpha_2":    usr.CountryCodeAlpha2,
+		"administrative_division": usr.AdministrativeDivision,
+		"currency":                usr.Currency,
+		"date_of_birth":           usr.DateOfBirth,
+		"occupation":              usr.Occupation,
+		"income":                  usr.Income.Format(usr.Currency),
+		"expenses":                usr.Expenses.Format(usr.Currency),
+		"family_member_number":    strconv.FormatInt(usr.FamilyMemberNumber, 10),
+		"is_married":              strconv.FormatBool(usr.IsMarried),
+		"created_at":              usr.CreatedAt,
+		"has_spouse":              strconv.FormatBool(usr.Spouse != nil),
+		"dependent_count":         strconv.Itoa(len(usr.Dependents)),
+		"milestone_count":         strconv.Itoa(len(usr.Milestones)),
+		"goal_count":              strconv.Itoa(len(usr.Goals)),
+		"protection_count":        strconv.Itoa(len(usr.Protections)),
+		"debt_count":              strconv.Itoa(len(usr.Debts)),
+		"total_debt":              totalDebt.Format(usr.Currency),
+	}
+}
+
+// exportColumns are the columns of the CSV export, in order.
+var exportColumns = append(append([]string(nil), flattenedColumns...), "age_range", "income_range")
+
+// exportRecord returns the CSV record of a user at the time now, following
+// exportColumns.
+func exportRecord(user *data.User, now time.Time) []string {
+	exported := newExportedUser(user, now)
+	fields := flatten(user)
+	fields["age_range"] = exported.AgeRange
+	fields["income_range"] = exported.IncomeRange
+
+	record := make([]string, len(exportColumns))
+	for i, column := range exportColumns {
+		record[i] = fields[column]
+	}
+	return record
+}
+
+// exportedUser is a user along with the ranges of its age and income, for
+// the analytics which must not rely on the precise values.
+type exportedUser struct {
+	*data.User
+	AgeRange    string `json:"age_range,omitempty"`
+	IncomeRange string `json:"income_range"`
+}
+
+// newExportedUser computes the ranges of the user at the time now.
+func newExportedUser(user *data.User, now time.Time) exportedUser {
+	return exportedUser{
+		User:        user,
+		AgeRange:    data.AgeBucket(user.DateOfBirth, now),
+		IncomeRange: data.IncomeBucket(user.Income.Units()),
+	}
+}
+
+// exportUsersHandler streams every user as JSON lines (default) or CSV,
+// along with the ranges of their age and income.
+//
+// Users are written page by page as they are scanned, so memory stays flat
+// regardless of the size of the table. The stream is gzipped when the
+// client accepts it. The users may be filtered like the lists, but they
+// can't be sorted, which would hold the whole table in memory.
+func (app *application) exportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	v.Check(r.URL.Query().Get("sort") == "", "sort", "is not supported by exports")
+	query := app.readListQuery(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+
+	var contentType string
+	switch format {
+	case "jsonl":
+		contentType = "application/x-ndjson"
+	case "csv":
+		contentType = "text/csv"
+	default:
+		app.badRequestResponse(w, r, fmt.Errorf("unsupported export format %q", format))
+		return
+	}
+
+	filename := "users." + format
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if acceptsGzip(r) {
+		gz = gzip.NewWriter(w)
+		out = gz
+		filename += ".gz"
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Add("Vary", "Accept-Encoding")
+	w.WriteHeader(http.StatusOK)
+
+	now := app.now()
+	var write func(*data.User) error
+	var flush func() error
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(out)
+		write = func(user *data.User) error { return cw.Write(exportRecord(user, now)) }
+		flush = func() error { cw.Flush(); return cw.Error() }
+
+		if err := cw.Write(exportColumns); err != nil {
+			app.logError(r, err)
+			return
+		}
+	default:
+		enc := json.NewEncoder(out)
+		write = func(user *data.User) error { return enc.Encode(newExportedUser(user, now)) }
+		flush = func() error { return nil }
+	}
+
+	err := app.models.Users.ForEach(r.Context(), query.filter(), func(user *data.User) error {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		return write(app.shapeUser(r, user))
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil && gz != nil {
+		// The gzip stream is only terminated once every user is written,
+		// so a failed export can't be mistaken for a complete one.
+		err = gz.Close()
+	}
+	if err != nil {
+		// The status is already sent, so the error can only be logged.
+		app.logError(r, err)
+	}
+}
+
+// acceptsGzip reports whether the client accepts a gzipped response. An
+// encoding with a quality value of 0 is not accepted.
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			params := strings.Split(encoding, ";")
+			if strings.TrimSpace(params[0]) != "gzip" {
+				continue
+			}
+
+			for _, param := range params[1:] {
+				name, quality, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "q") {
+					q, err := strconv.ParseFloat(quality, 64)
+					return err == nil && q > 0
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
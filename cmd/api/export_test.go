@@ -0,0 +1,244 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+)
+
+func exportFixtures() []*data.User {
+	return []*data.User{
+		{ID: "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", Email: "john.doe@example.com", FirstName: "John", CountryCodeAlpha2: "CA", ProvinceCode: "ON"},
+		{ID: "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22", Email: "jane.doe@example.com", FirstName: "Jane", CountryCodeAlpha2: "US", ProvinceCode: "TX", DateOfBirth: "1990-05-01", Income: user.MinorUnits(6000000, "USD")},
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	usr := &data.User{
+		ID:                     "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11",
+		Email:                  "john.doe@example.com",
+		FirstName:              "John",
+		LastName:               "Doe",
+		ProvinceCode:           "ON",
+		CountryCodeAlpha2:      "CA",
+		AdministrativeDivision: "province",
+		Currency:               "CAD",
+		DateOfBirth:            "1985-03-12",
+		Occupation:             "Engineer",
+		Income:                 user.MinorUnits(8500050, "CAD"),
+		Expenses:               user.MinorUnits(4200000, "CAD"),
+		FamilyMemberNumber:     4,
+		IsMarried:              true,
+		Spouse:                 &user.FamilyMember{Type: "Spouse", FirstName: "Jane"},
+		Dependents:             []user.FamilyMember{{Type: "Child", FirstName: "Jim"}, {Type: "Child", FirstName: "Joan"}},
+		Milestones:             []user.Milestone{{Title: "Emergency fund"}},
+		Goals:                  []user.Goal{{Title: "House"}, {Title: "Retirement"}, {Title: "Travel"}},
+		Debts:                  []user.Debt{{Type: "Mortgage", Cost: user.MinorUnits(25000000, "CAD")}, {Type: "Car", Cost: user.MinorUnits(1234567, "CAD")}},
+		CreatedAt:              "2023-01-02T03:04:05Z",
+	}
+
+	golden := map[string]string{
+		"id":                      "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11",
+		"email":                   "john.doe@example.com",
+		"first_name":              "John",
+		"last_name":               "Doe",
+		"province_code":           "ON",
+		"country_code_alpha_2":    "CA",
+		"administrative_division": "province",
+		"currency":                "CAD",
+		"date_of_birth":           "1985-03-12",
+		"occupation":              "Engineer",
+		"income":                  "85000.50",
+		"expenses":                "42000.00",
+		"family_member_number":    "4",
+		"is_married":              "true",
+		"created_at":              "2023-01-02T03:04:05Z",
+		"has_spouse":              "true",
+		"dependent_count":         "2",
+		"milestone_count":         "1",
+		"goal_count":              "3",
+		"protection_count":        "0",
+		"debt_count":              "2",
+		"total_debt":              "262345.67",
+	}
+
+	flattened := flatten(usr)
+	require.Equal(t, golden, flattened)
+	require.Len(t, flattenedColumns, len(flattened))
+	for _, column := range flattenedColumns {
+		require.Contains(t, flattened, column)
+	}
+}
+
+func TestExportUsersGzip(t *testing.T) {
+	app, fake := newTestApplication(t)
+	users := exportFixtures()
+	seedUsers(t, fake, users...)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/exports/users", nil)
+	req.Header.Set("Accept-Encoding", "deflate, gzip;q=0.8")
+	rr := httptest.NewRecorder()
+
+	app.exportUsersHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	require.Equal(t, `attachment; filename="users.jsonl.gz"`, rr.Header().Get("Content-Disposition"))
+
+	gz, err := gzip.NewReader(rr.Body)
+	require.NoError(t, err)
+
+	var exported []*data.User
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		var usr data.User
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &usr))
+		exported = append(exported, &usr)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, users, exported)
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]struct {
+		acceptEncoding string
+		expected       bool
+	}{
+		`none`:            {acceptEncoding: "", expected: false},
+		`gzip`:            {acceptEncoding: "gzip", expected: true},
+		`among others`:    {acceptEncoding: "deflate, gzip;q=0.8", expected: true},
+		`zero quality`:    {acceptEncoding: "deflate, gzip;q=0", expected: false},
+		`zero decimals`:   {acceptEncoding: "gzip; q=0.000", expected: false},
+		`invalid quality`: {acceptEncoding: "gzip;q=high", expected: false},
+		`other encoding`:  {acceptEncoding: "deflate", expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/exports/users", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+
+			require.Equal(t, tt.expected, acceptsGzip(req))
+		})
+	}
+}
+
+func TestExportUsersCSV(t *testing.T) {
+	app, fake := newTestApplication(t)
+	users := exportFixtures()
+	seedUsers(t, fake, users...)
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	app.clock = func() time.Time { return now }
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/exports/users?format=csv", nil)
+	rr := httptest.NewRecorder()
+
+	app.exportUsersHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Empty(t, rr.Header().Get("Content-Encoding"))
+	require.Equal(t, `attachment; filename="users.csv"`, rr.Header().Get("Content-Disposition"))
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, len(users)+1)
+	require.Equal(t, exportColumns, records[0])
+	require.Equal(t, exportRecord(users[1], now), records[2])
+	require.Equal(t, []string{"25-34", "50000-74999"}, records[2][len(records[2])-2:])
+}
+
+func TestExportUsersUnsupportedFormat(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/exports/users?format=xml", nil)
+	rr := httptest.NewRecorder()
+
+	app.exportUsersHandler(rr, req)
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestExportUsersQuery(t *testing.T) {
+	app, fake := newTestApplication(t)
+	app.config.sortableAttributes = []string{"first_name"}
+	app.config.filterableAttributes = []string{"country_code_alpha_2"}
+	seedUsers(t, fake,
+		&data.User{ID: "00000000-0000-0000-0000-000000000001", CountryCodeAlpha2: "CA"},
+		&data.User{ID: "00000000-0000-0000-0000-000000000002", CountryCodeAlpha2: "US"},
+	)
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.exportUsersHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/exports/users"+query, nil))
+		return rr
+	}
+
+	rr := export("?filter=country_code_alpha_2:US")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), "00000000-0000-0000-0000-000000000002")
+	require.NotContains(t, rr.Body.String(), "00000000-0000-0000-0000-000000000001")
+
+	require.Equal(t, http.StatusUnprocessableEntity, export("?filter=email:x").Code)
+	require.Equal(t, http.StatusUnprocessableEntity, export("?sort=first_name").Code)
+}
+
+func TestListAndExportUsersRoles(t *testing.T) {
+	app, fake := newTestApplication(t)
+	app.config.apiKeys = map[string]string{"admin-key": roleAdmin, "support-key": roleSupport}
+	seedUsers(t, fake, exportFixtures()...)
+
+	handler := app.authenticate(app.router())
+
+	tests := map[string]struct {
+		path     string
+		key      string
+		expected int
+	}{
+		`admin list`:       {path: "/v1/users", key: "admin-key", expected: http.StatusOK},
+		`support list`:     {path: "/v1/users", key: "support-key", expected: http.StatusOK},
+		`anonymous list`:   {path: "/v1/users", expected: http.StatusUnauthorized},
+		`admin export`:     {path: "/v1/exports/users", key: "admin-key", expected: http.StatusOK},
+		`support export`:   {path: "/v1/exports/users", key: "support-key", expected: http.StatusForbidden},
+		`anonymous export`: {path: "/v1/exports/users", expected: http.StatusUnauthorized},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.expected, rr.Code)
+		})
+	}
+}
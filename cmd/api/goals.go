@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// rejectedGoal is a goal left out of a best-effort append, with the
+// reasons of its rejection.
+type rejectedGoal struct {
+	// Index is the position of the goal in the request, from 1.
+	Index  int               `json:"index"`
+	Errors map[string]string `json:"errors"`
+}
+
+// appendGoalsHandler appends goals to the goals of a user, and answers
+// with every goal of the user.
+//
+// When some goals are invalid, the whole request is rejected with 422 by
+// default. When the goal appends are best-effort, the valid goals are
+// appended, and the invalid ones are reported along with their errors in a
+// 207 Multi-Status response. A request without any valid goal is still
+// rejected with 422.
+func (app *application) appendGoalsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Goals []user.Goal `json:"goals"`
+	}
+
+	usr, ok := app.getUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Goals) > 0, "goals", "must be provided")
+
+	var accepted []user.Goal
+	var rejected []rejectedGoal
+	for i, goal := range input.Goals {
+		gv := validator.New()
+		user.ValidateGoal(gv, &goal, fmt.Sprintf("goal_%d", i+1), app.rules.MaxGoalDuration)
+		if !gv.Valid() {
+			rejected = append(rejected, rejectedGoal{Index: i + 1, Errors: gv.Errors})
+			for key, message := range gv.Errors {
+				v.AddError(key, message)
+			}
+			continue
+		}
+		accepted = append(accepted, goal)
+	}
+
+	bestEffort := app.config.goalAppend == "best-effort"
+	if len(accepted) == 0 || (!bestEffort && !v.Valid()) {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.AppendGoals(r.Context(), usr, accepted)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	env := resourceEnvelope("goal", append(usr.Goals, accepted...))
+	if len(rejected) > 0 {
+		status = http.StatusMultiStatus
+		env["rejected"] = rejected
+	}
+
+	err = app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
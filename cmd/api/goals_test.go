@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+)
+
+func TestAppendGoalsHandler(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+	const body = `{"goals":[
+		{"title":"Emergency fund","progress_level":"not_started"},
+		{"title":"House","progress_level":"halfway"},
+		{"title":"Retirement","progress_level":"in_progress"}
+	]}`
+
+	tests := map[string]struct {
+		mode          string
+		expected      int
+		expectedGoals []string
+	}{
+		`all-or-nothing`: {mode: "all-or-nothing", expected: http.StatusUnprocessableEntity, expectedGoals: []string{"Car"}},
+		`best-effort`:    {mode: "best-effort", expected: http.StatusMultiStatus, expectedGoals: []string{"Car", "Emergency fund", "Retirement"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.goalAppend = tt.mode
+			seedUsers(t, fake, &data.User{ID: id, Goals: []user.Goal{{Title: "Car", ProgressLevel: "completed"}}, Version: 1})
+
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id+"/goals", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			app.appendGoalsHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+
+			var response struct {
+				Goals    []user.Goal `json:"goals"`
+				Rejected []struct {
+					Index  int               `json:"index"`
+					Errors map[string]string `json:"errors"`
+				} `json:"rejected"`
+				Error map[string]string `json:"error"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			if tt.expected == http.StatusMultiStatus {
+				require.Len(t, response.Rejected, 1)
+				require.Equal(t, 2, response.Rejected[0].Index)
+				require.Contains(t, response.Rejected[0].Errors, "goal_2_progress_level")
+				require.Len(t, response.Goals, len(tt.expectedGoals))
+			} else {
+				require.Contains(t, response.Error, "goal_2_progress_level")
+			}
+
+			stored, err := app.models.Users.Get(context.Background(), id)
+			require.NoError(t, err)
+			var titles []string
+			for _, goal := range stored.Goals {
+				titles = append(titles, goal.Title)
+			}
+			require.Equal(t, tt.expectedGoals, titles)
+		})
+	}
+}
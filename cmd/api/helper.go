@@ -16,15 +16,33 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 	"io"
+	"mime"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
+	"user-service.mykapital.io/internal/data"
 )
 
+// now returns the current time of the clock of the application.
+func (app *application) now() time.Time {
+	if app.clock == nil {
+		return time.Now()
+	}
+
+	return app.clock()
+}
+
 // readParam reads parameters from URL
 func (app *application) readParam(r *http.Request, paramName string) string {
 	params := httprouter.ParamsFromContext(r.Context())
@@ -32,8 +50,48 @@ func (app *application) readParam(r *http.Request, paramName string) string {
 	return data
 }
 
+// readIDParam reads the id parameter of the request as a UUID. A
+// malformed id is answered with 404 Not Found, as an unknown id, or with
+// 400 Bad Request when the config rejects the malformed ids.
+func (app *application) readIDParam(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(app.readParam(r, "id"))
+	if err != nil {
+		if app.config.rejectMalformedIDs {
+			app.badRequestResponse(w, r, errors.New("the id must be a valid UUID"))
+		} else {
+			app.notFoundResponse(w, r)
+		}
+		return uuid.UUID{}, false
+	}
+
+	return id, true
+}
+
 type envelope map[string]interface{}
 
+// resourcePlurals are the plural names of the resources whose plural isn't
+// their name followed by an s.
+var resourcePlurals = map[string]string{}
+
+// pluralName returns the plural of the name of a resource.
+func pluralName(name string) string {
+	if plural, ok := resourcePlurals[name]; ok {
+		return plural
+	}
+	return name + "s"
+}
+
+// resourceEnvelope returns the envelope of a resource, keyed by the name of
+// the resource for a single one, such as {"user": ...}, and by its plural
+// for a collection given as a slice, such as {"users": [...]}. The other
+// members of the response are added to the envelope.
+func resourceEnvelope(name string, v interface{}) envelope {
+	if v != nil && reflect.TypeOf(v).Kind() == reflect.Slice {
+		return envelope{pluralName(name): v}
+	}
+	return envelope{name: v}
+}
+
 // writeJSON writes json
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
 	js, err := json.Marshal(data)
@@ -48,21 +106,62 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(js)))
 	w.WriteHeader(status)
 	w.Write(js)
 
 	return nil
 }
 
+// unsupportedCharsetError is returned by readJSON for a body declaring a
+// charset other than UTF-8, which the decoder would mangle.
+type unsupportedCharsetError struct {
+	charset string
+}
+
+func (e *unsupportedCharsetError) Error() string {
+	return fmt.Sprintf("body charset %q is not supported, only utf-8 is", e.charset)
+}
+
+// checkCharset checks that the Content-Type of the request declares no
+// charset, or UTF-8.
+func checkCharset(r *http.Request) error {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+
+	charset, ok := params["charset"]
+	if !ok || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "utf8") {
+		return nil
+	}
+
+	return &unsupportedCharsetError{charset: charset}
+}
+
 // readJSON validates json
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	if app.config.requireUTF8 {
+		if err := checkCharset(r); err != nil {
+			return err
+		}
+	}
+
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
 	dec := json.NewDecoder(r.Body)
-	dec.DisallowUnknownFields()
 
-	err := dec.Decode(dst)
+	// Legacy clients send camelCase keys, renamed before the unknown
+	// fields are checked.
+	var err error
+	if app.config.camelCaseInput {
+		dec, err = snakeCaseDecoder(r.Body, dst)
+	}
+	if err == nil {
+		dec.DisallowUnknownFields()
+		err = dec.Decode(dst)
+	}
 	if err != nil {
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
@@ -99,6 +198,11 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 		}
 	}
 
+	// The decoder stops after the first value, so a body with several
+	// concatenated values would otherwise be silently truncated.
+	if app.config.allowTrailingJSON {
+		return nil
+	}
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
 		return errors.New("body must only contain a single JSON value")
@@ -106,3 +210,66 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 
 	return nil
 }
+
+// updateOutcome is the result of the update of a user.
+type updateOutcome struct {
+	// user is the user once updated.
+	user *data.User
+	// diff is the difference between the user before and after the update.
+	diff map[string][2]interface{}
+}
+
+// sharedUpdateTimeout bounds the updates shared by identical concurrent
+// requests.
+const sharedUpdateTimeout = 10 * time.Second
+
+// dedupeUpdate runs the update fn of a user once for all the identical
+// concurrent updates, which then share its result.
+//
+// Updates are identical when they target the same user with the same
+// attributes. The update is run as is, with ctx, when deduplication is
+// disabled. Else it runs with its own context, bounded by
+// sharedUpdateTimeout, so the cancellation of the request which started
+// it doesn't fail the requests sharing it.
+func (app *application) dedupeUpdate(ctx context.Context, id string, attributes map[string]interface{}, fn func(ctx context.Context) (*updateOutcome, error)) (*updateOutcome, error) {
+	if app.updates == nil {
+		return fn(ctx)
+	}
+
+	js, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(js)
+
+	result, err, _ := app.updates.Do(id+":"+hex.EncodeToString(digest[:]), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), sharedUpdateTimeout)
+		defer cancel()
+
+		return fn(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*updateOutcome), nil
+}
+
+// background runs fn in a goroutine, recovering from its panics.
+//
+// The server waits for the background goroutines before shutting down.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
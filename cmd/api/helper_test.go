@@ -18,8 +18,13 @@ package main
 import (
 	"context"
 	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
 )
 
 func TestReadParam(t *testing.T) {
@@ -96,3 +101,89 @@ func TestReadParam(t *testing.T) {
 		})
 	}
 }
+
+func TestReadJSONTrailingData(t *testing.T) {
+	tests := map[string]struct {
+		allowTrailing bool
+		body          string
+		err           string
+	}{
+		`single object`: {
+			body: `{"first_name":"John"}`,
+		},
+		`concatenated objects`: {
+			body: `{"first_name":"John"}{"first_name":"Jack"}`,
+			err:  "body must only contain a single JSON value",
+		},
+		`trailing garbage`: {
+			body: `{"first_name":"John"} garbage`,
+			err:  "body must only contain a single JSON value",
+		},
+		`concatenated objects allowed`: {
+			allowTrailing: true,
+			body:          `{"first_name":"John"}{"first_name":"Jack"}`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app := &application{}
+			app.config.allowTrailingJSON = tt.allowTrailing
+
+			var input struct {
+				FirstName string `json:"first_name"`
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			err := app.readJSON(httptest.NewRecorder(), req, &input)
+
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "John", input.FirstName)
+		})
+	}
+}
+
+func TestResourceEnvelope(t *testing.T) {
+	defer func(plurals map[string]string) { resourcePlurals = plurals }(resourcePlurals)
+	resourcePlurals = map[string]string{"person": "people"}
+
+	tests := map[string]struct {
+		name        string
+		v           interface{}
+		expectedKey string
+	}{
+		`single resource`:         {name: "user", v: &data.User{ID: "1"}, expectedKey: "user"},
+		`single map resource`:     {name: "user", v: map[string]interface{}{"first_name": "John"}, expectedKey: "user"},
+		`collection`:              {name: "user", v: []*data.User{{ID: "1"}}, expectedKey: "users"},
+		`empty collection`:        {name: "goal", v: []user.Goal{}, expectedKey: "goals"},
+		`nil collection`:          {name: "goal", v: []user.Goal(nil), expectedKey: "goals"},
+		`irregular plural`:        {name: "person", v: []string{"John"}, expectedKey: "people"},
+		`irregular plural single`: {name: "person", v: "John", expectedKey: "person"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			env := resourceEnvelope(tt.name, tt.v)
+			require.Len(t, env, 1)
+			require.Contains(t, env, tt.expectedKey)
+		})
+	}
+}
+
+func TestWriteJSONResourceEnvelope(t *testing.T) {
+	app, fake := newTestApplication(t)
+	seedUsers(t, fake, &data.User{ID: "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", FirstName: "John"})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", nil)
+	rr := httptest.NewRecorder()
+	app.showUserHandler(rr, withParams(req, "id", "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), `{"user":{`)
+
+	rr, _ = listUsers(t, app, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), `{"users":[`)
+}
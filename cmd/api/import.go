@@ -0,0 +1,193 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// maxImportLineBytes caps the size of a line of an import.
+const maxImportLineBytes = 1 << 20
+
+// maxImportErrors caps the errors listed in the summary of an import.
+const maxImportErrors = 100
+
+// importError is the error of a line of an import.
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// importSummary reports the outcome of an import.
+type importSummary struct {
+	Imported int `json:"imported"`
+	Failed   int `json:"failed"`
+	// Errors are the first maxImportErrors errors, by line.
+	Errors []importError `json:"errors"`
+	// Throttled is the number of writes throttled by DynamoDB, which were
+	// retried with backoff.
+	Throttled     int64   `json:"throttled"`
+	Duration      string  `json:"duration"`
+	RowsPerSecond float64 `json:"rows_per_second"`
+}
+
+// importRow is a line of an import.
+type importRow struct {
+	line int
+	data []byte
+}
+
+// importUsersHandler imports users from JSON lines, one user per line, as
+// exported by exportUsersHandler, and answers with an importSummary.
+//
+// The users are validated like the created users, and are only inserted
+// when neither their id nor their email is already taken. The inserts are
+// parallelized over a pool of importConcurrency workers. A throttled
+// insert is retried with backoff by its worker, which holds back the next
+// rows meanwhile.
+func (app *application) importUsersHandler(w http.ResponseWriter, r *http.Request) {
+	concurrency := app.config.importConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var throttled int64
+	users := app.models.Users
+	users.OnThrottle = func() { atomic.AddInt64(&throttled, 1) }
+
+	var (
+		mu      sync.Mutex
+		summary = importSummary{Errors: []importError{}}
+		wg      sync.WaitGroup
+		rows    = make(chan importRow)
+	)
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range rows {
+				err := app.importUser(r.Context(), users, row.data)
+
+				mu.Lock()
+				if err != nil {
+					summary.Failed++
+					if len(summary.Errors) < maxImportErrors {
+						summary.Errors = append(summary.Errors, importError{Line: row.line, Error: err.Error()})
+					}
+				} else {
+					summary.Imported++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxImportLineBytes)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		// The scanner reuses its buffer, so the line is copied.
+		rows <- importRow{line: line, data: append([]byte(nil), scanner.Bytes()...)}
+	}
+	close(rows)
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("couldn't read line %d: %v", line+1, err))
+		return
+	}
+
+	elapsed := time.Since(start)
+	summary.Throttled = atomic.LoadInt64(&throttled)
+	summary.Duration = elapsed.String()
+	if elapsed > 0 {
+		summary.RowsPerSecond = float64(summary.Imported+summary.Failed) / elapsed.Seconds()
+	}
+	sort.Slice(summary.Errors, func(i, j int) bool { return summary.Errors[i].Line < summary.Errors[j].Line })
+
+	app.logger.PrintInfo("users imported", map[string]string{
+		"imported":  fmt.Sprint(summary.Imported),
+		"failed":    fmt.Sprint(summary.Failed),
+		"throttled": fmt.Sprint(summary.Throttled),
+		"duration":  summary.Duration,
+	})
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"summary": summary}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importUser validates and inserts the user of a line of an import.
+func (app *application) importUser(ctx context.Context, users user.Model, line []byte) error {
+	var usr data.User
+	if err := json.Unmarshal(line, &usr); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	if usr.ID == "" {
+		usr.ID = uuid.New().String()
+	} else if _, err := uuid.Parse(usr.ID); err != nil {
+		return errors.New("id: must be a valid id")
+	}
+	if usr.CreatedAt == "" {
+		usr.CreatedAt = app.now().Format("2006-01-02")
+	}
+	usr.Version = 1
+	usr.DeletedAt = ""
+
+	data.Normalize(&usr)
+
+	v := validator.New()
+	app.rules.FillDefaults(v, &usr)
+	if app.rules.ValidateUser(v, &usr); !v.Valid() {
+		fields := make([]string, 0, len(v.Errors))
+		for field, message := range v.Errors {
+			fields = append(fields, field+": "+message)
+		}
+		sort.Strings(fields)
+		return errors.New(strings.Join(fields, "; "))
+	}
+
+	err := users.CreateIfAbsent(ctx, &usr)
+	switch {
+	case errors.Is(err, data.ErrConditionFailed):
+		return errors.New("id: a user with this id already exists")
+	case errors.Is(err, data.ErrDuplicateEmail), errors.Is(err, data.ErrPendingVerification):
+		return errors.New("email: a user with this email address already exists")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+// concurrentPuts records the maximum number of concurrent PutItem calls,
+// and throttles the first one.
+type concurrentPuts struct {
+	*testsupport.FakeDynamoDB
+	mu        sync.Mutex
+	inFlight  int
+	max       int
+	throttled bool
+}
+
+func (c *concurrentPuts) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.mu.Lock()
+	if !c.throttled {
+		c.throttled = true
+		c.mu.Unlock()
+		return nil, &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")}
+	}
+	c.inFlight++
+	if c.inFlight > c.max {
+		c.max = c.inFlight
+	}
+	c.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+
+	return c.FakeDynamoDB.PutItem(ctx, params, optFns...)
+}
+
+func TestImportUsersHandler(t *testing.T) {
+	const rows = 50
+
+	app, fake := newTestApplication(t)
+	app.config.importConcurrency = 3
+	puts := &concurrentPuts{FakeDynamoDB: fake}
+	app.models.Users.DynamoDbClient = puts
+	seedUsers(t, fake, &data.User{ID: "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22", Email: "taken@example.com", Activated: true})
+
+	var body strings.Builder
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&body, `{"id":"00000000-0000-0000-0000-%012d","email":"user%d@example.com","first_name":"User","country_code_alpha_2":"CA","province_code":"ON"}`+"\n", i, i)
+	}
+	// An invalid user, and a user whose email is already taken.
+	body.WriteString(`{"email":"invalid","first_name":"User","country_code_alpha_2":"CA","province_code":"ON"}` + "\n")
+	body.WriteString("\n")
+	body.WriteString(`{"email":"taken@example.com","first_name":"User","country_code_alpha_2":"CA","province_code":"ON"}` + "\n")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/imports/users", strings.NewReader(body.String()))
+	rr := httptest.NewRecorder()
+	app.importUsersHandler(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response struct {
+		Summary importSummary `json:"summary"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	summary := response.Summary
+	require.Equal(t, rows, summary.Imported)
+	require.Equal(t, 2, summary.Failed)
+	require.Equal(t, int64(1), summary.Throttled)
+	require.Len(t, summary.Errors, 2)
+	require.Equal(t, rows+1, summary.Errors[0].Line)
+	require.Contains(t, summary.Errors[0].Error, "email: must be valid")
+	require.Equal(t, rows+3, summary.Errors[1].Line)
+	require.Contains(t, summary.Errors[1].Error, "already exists")
+
+	require.Len(t, fake.Items, rows+1)
+	require.LessOrEqual(t, puts.max, 3)
+	require.Greater(t, puts.max, 1)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// apiIndex lists the methods supported by every path of the API.
+type apiIndex map[string][]string
+
+// add registers the method of a path.
+func (i apiIndex) add(method, path string) {
+	i[path] = append(i[path], method)
+}
+
+// resource is a path of the API and its supported methods.
+type resource struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+// resources returns the paths of the index, sorted.
+func (i apiIndex) resources() []resource {
+	resources := make([]resource, 0, len(i))
+	for path, methods := range i {
+		sorted := append([]string(nil), methods...)
+		sort.Strings(sorted)
+		resources = append(resources, resource{Path: path, Methods: sorted})
+	}
+
+	sort.Slice(resources, func(a, b int) bool {
+		return resources[a].Path < resources[b].Path
+	})
+
+	return resources
+}
+
+// indexHandler describes the resources of the API, so integrators can
+// discover it.
+func (app *application) indexHandler(index apiIndex) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		env := envelope{
+			"version":   version,
+			"resources": index.resources(),
+		}
+
+		err := app.writeJSON(w, http.StatusOK, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
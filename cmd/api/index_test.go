@@ -0,0 +1,48 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexHandler(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	rr := httptest.NewRecorder()
+	app.router().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Resources []resource `json:"resources"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+
+	methods := make(map[string][]string)
+	for _, res := range response.Resources {
+		methods[res.Path] = res.Methods
+	}
+
+	require.Equal(t, []string{"GET", "POST"}, methods["/v1/users"])
+	require.Equal(t, []string{"DELETE", "GET", "HEAD", "PATCH", "PUT"}, methods["/v1/users/:id"])
+	require.Contains(t, methods, "/v1")
+	require.NotContains(t, methods, "/debug/vars")
+}
@@ -17,17 +17,25 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	sdkConfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"golang.org/x/sync/singleflight"
+	"net/http"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"user-service.mykapital.io/internal/data"
 	"user-service.mykapital.io/internal/jsonlog"
+	"user-service.mykapital.io/internal/notify"
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
 )
 
 var (
@@ -35,24 +43,132 @@ var (
 	version   string
 )
 
+// limiterConfig is the rate limit of the requests of each client.
+type limiterConfig struct {
+	rps     float64
+	burst   int
+	enabled bool
+}
+
 type config struct {
-	port int
-	env  string
-	sdk  struct {
+	port    int
+	env     string
+	tenant  string
+	apiKeys map[string]string
+	sdk     struct {
 		config aws.Config
 		az     string
 	}
-	limiter struct {
-		rps     float64
-		burst   int
-		enabled bool
+	limiter     limiterConfig
+	retryBudget struct {
+		rps   float64
+		burst int
+	}
+	dedupeUpdates  bool
+	camelCaseInput bool
+	requireUTF8    bool
+	debugErrors    bool
+	versionGrace   bool
+	pendingWindow  time.Duration
+	skipCorrupt    bool
+	emailClaims    bool
+	getBatch       struct {
+		window  time.Duration
+		maxSize int
+	}
+	timeouts struct {
+		request time.Duration
+		routes  map[string]time.Duration
+	}
+	validation struct {
+		dateOfBirthRequired    []string
+		defaultCurrency        string
+		strictCurrency         bool
+		maxDependents          int
+		occupations            []string
+		maxMetaValueBytes      int
+		maxGoalDuration        time.Duration
+		metaNamespaces         []string
+		metaPolicy             user.MetaPolicy
+		rejectFutureMilestones bool
+	}
+	immutableFields []string
+	// maxUpdateAttributes caps the attributes of a single update, which
+	// all end up in its DynamoDB expression.
+	maxUpdateAttributes int
+	// emptyUpdate is how updates without any attribute are answered,
+	// either rejected or ignored.
+	emptyUpdate string
+	notifier    struct {
+		kind   string
+		sender string
+		sms    string
 	}
+	headers struct {
+		maxBytes   int
+		maxValues  int
+		security   []string
+		hstsMaxAge time.Duration
+	}
+	cors struct {
+		trustedOrigins []string
+		exposedHeaders []string
+	}
+	tls struct {
+		certFile   string
+		keyFile    string
+		minVersion uint16
+	}
+	// maskSupportContacts masks the emails and phones of the users for
+	// the support agents.
+	maskSupportContacts bool
+	// normalizeWrites normalizes the codes and the emails of the users
+	// before they are stored.
+	normalizeWrites bool
+	// rejectMalformedIDs answers the malformed user ids with 400 instead
+	// of 404, which doesn't tell them from the unknown ids.
+	rejectMalformedIDs bool
+	// importConcurrency is the number of users inserted in parallel by an
+	// import.
+	importConcurrency int
+	// normalizeReads upper-cases the province and country codes of the
+	// users in the responses, whatever their stored case.
+	normalizeReads bool
+	// readDefaults fills the country dependent fields missing from the
+	// stored users in the responses.
+	readDefaults bool
+	// goalAppend is how the goal appends with invalid goals are handled,
+	// either rejected as a whole or applied to the valid goals.
+	goalAppend string
+	// allowTrailingJSON ignores the data following the first JSON value of
+	// the request bodies, for the clients which append it.
+	allowTrailingJSON bool
+	// sortableAttributes are the attributes the lists of users can be
+	// sorted by.
+	sortableAttributes []string
+	// filterableAttributes are the attributes the lists and the exports of
+	// users can be filtered on.
+	filterableAttributes []string
+	// callerLimiter limits the requests of each API key, whatever the IPs
+	// they come from, on top of the limit of each IP.
+	callerLimiter limiterConfig
 }
 
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	rules    user.Rules
+	updates  *singleflight.Group
+	notifier notify.Notifier
+	sms      notify.Notifier
+	wg       sync.WaitGroup
+	total    totalCache
+	// phoneSends throttles the phone verification codes sent to each
+	// number, and is disabled when nil.
+	phoneSends *phoneCooldown
+	// clock returns the current time, and is time.Now when nil.
+	clock func() time.Time
 }
 
 func main() {
@@ -60,13 +176,190 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.BoolVar(&cfg.debugErrors, "debug-errors", false, "Send the detail of server errors in staging, as in development (never in production)")
+	flag.StringVar(&cfg.tenant, "tenant", "", "Tenant prefixing the table names, in multi-tenant deployments")
 	flag.StringVar(&cfg.sdk.az, "availability-zone", "us-east-1", "AWS Availability Zone")
 
-	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
-	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	// The rates default to the limits of the environment, see limiterDefaults.
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 0, "Rate limiter maximum requests per second (default 20 in development, 4 in staging, 2 in production)")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 0, "Rate limiter maximum burst (default 40 in development, 8 in staging, 4 in production)")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.callerLimiter.rps, "caller-limiter-rps", 0, "Rate limiter maximum requests per second of an API key (default 100 in development, 20 in staging, 10 in production)")
+	flag.IntVar(&cfg.callerLimiter.burst, "caller-limiter-burst", 0, "Rate limiter maximum burst of an API key (default 200 in development, 40 in staging, 20 in production)")
+	flag.BoolVar(&cfg.callerLimiter.enabled, "caller-limiter-enabled", true, "Enable rate limiter of the API keys")
+
+	flag.Float64Var(&cfg.retryBudget.rps, "retry-budget-rps", 10, "Retries of throttled DynamoDB calls allowed per second")
+	flag.IntVar(&cfg.retryBudget.burst, "retry-budget-burst", 20, "Retry budget maximum burst")
+
+	flag.BoolVar(&cfg.dedupeUpdates, "dedupe-updates", true, "Share a single write between identical concurrent updates")
+
+	flag.BoolVar(&cfg.versionGrace, "version-grace", true, "Initialize the version of legacy users stored without one")
+
+	flag.DurationVar(&cfg.pendingWindow, "pending-verification-window", 72*time.Hour, "How long an unverified registration blocks its email")
+
+	flag.DurationVar(&cfg.getBatch.window, "get-batch-window", 0, "Window coalescing the concurrent reads of users into batches (0 to disable)")
+	flag.IntVar(&cfg.getBatch.maxSize, "get-batch-size", user.MaxBatchGetKeys, "Maximum number of users of a read batch")
+
+	flag.BoolVar(&cfg.skipCorrupt, "skip-corrupt-users", false, "Leave the users which can't be decoded out of lists, instead of failing them")
+	flag.BoolVar(&cfg.normalizeReads, "normalize-reads", false, "Upper-case the province and country codes of the users in the responses, for the legacy users stored in mixed case")
+	flag.BoolVar(&cfg.readDefaults, "read-defaults", true, "Fill the administrative division and the currency missing from the stored users in the responses, from their country")
+	flag.BoolVar(&cfg.normalizeWrites, "normalize-writes", false, "Trim and upper-case the codes, and lower-case the emails, of the users before storing them")
+	flag.BoolVar(&cfg.emailClaims, "email-claims", false, "Claim the emails of the users in the UserEmail table, so concurrent registrations can't share an email")
+
+	flag.BoolVar(&cfg.rejectMalformedIDs, "reject-malformed-ids", false, "Answer the user ids which aren't UUIDs with 400 instead of 404")
+	flag.BoolVar(&cfg.camelCaseInput, "accept-camel-case", false, "Accept camelCase keys in request bodies, for legacy clients")
+	flag.BoolVar(&cfg.requireUTF8, "require-utf8", true, "Reject request bodies declaring a charset other than UTF-8")
+	flag.BoolVar(&cfg.allowTrailingJSON, "allow-trailing-json", false, "Ignore the data following the first JSON value of request bodies instead of rejecting them")
+
+	flag.IntVar(&cfg.headers.maxBytes, "max-header-bytes", 16<<10, "Maximum size of the request headers")
+	flag.IntVar(&cfg.headers.maxValues, "max-header-values", 20, "Maximum number of values of a single request header")
+
+	for name := range securityHeaders {
+		cfg.headers.security = append(cfg.headers.security, name)
+	}
+	flag.Func("security-headers", "Comma-separated security headers set on the responses, empty when a gateway sets them (default X-Content-Type-Options,X-Frame-Options,Referrer-Policy)", func(value string) error {
+		cfg.headers.security = nil
+		for _, name := range strings.Split(value, ",") {
+			if name == "" {
+				continue
+			}
+			if _, ok := securityHeaders[http.CanonicalHeaderKey(name)]; !ok {
+				return fmt.Errorf("unknown security header %q", name)
+			}
+			cfg.headers.security = append(cfg.headers.security, http.CanonicalHeaderKey(name))
+		}
+		return nil
+	})
+	flag.DurationVar(&cfg.headers.hstsMaxAge, "hsts-max-age", 365*24*time.Hour, "Max age of the Strict-Transport-Security header when serving HTTPS (0 to disable)")
+
+	flag.Func("cors-trusted-origins", "Comma-separated origins allowed to call the API cross-origin", func(value string) error {
+		cfg.cors.trustedOrigins = splitList(value)
+		return nil
+	})
+	cfg.cors.exposedHeaders = []string{"ETag", "Location", "X-Request-ID"}
+	flag.Func("cors-exposed-headers", "Comma-separated response headers readable cross-origin (default ETag,Location,X-Request-ID)", func(value string) error {
+		cfg.cors.exposedHeaders = nil
+		for _, name := range strings.Split(value, ",") {
+			if name != "" {
+				cfg.cors.exposedHeaders = append(cfg.cors.exposedHeaders, http.CanonicalHeaderKey(name))
+			}
+		}
+		return nil
+	})
+
+	flag.StringVar(&cfg.tls.certFile, "tls-cert", "", "Certificate file, serving HTTPS when set with -tls-key")
+	flag.StringVar(&cfg.tls.keyFile, "tls-key", "", "Private key file of the certificate")
+	cfg.tls.minVersion = tls.VersionTLS12
+	flag.Func("tls-min-version", "Minimum TLS version, 1.2 or 1.3 (default 1.2)", func(value string) (err error) {
+		cfg.tls.minVersion, err = parseTLSVersion(value)
+		return err
+	})
+
+	flag.DurationVar(&cfg.timeouts.request, "request-timeout", 10*time.Second, "Default timeout of a request (0 for unlimited)")
+	exportTimeout := flag.Duration("export-timeout", 5*time.Minute, "Timeout of an export request")
+	importTimeout := flag.Duration("import-timeout", 5*time.Minute, "Timeout of an import request")
+	flag.IntVar(&cfg.importConcurrency, "import-concurrency", 4, "Number of users inserted in parallel by an import")
+
+	flag.Func("dob-required-countries", "Comma-separated country codes requiring a date of birth", func(value string) error {
+		cfg.validation.dateOfBirthRequired = splitList(strings.ToUpper(value))
+		return nil
+	})
+
+	flag.Func("default-currency", "Currency assumed, with a warning, when it can't be defaulted from the country", func(value string) error {
+		if !validator.IsCurrency(value) {
+			return fmt.Errorf("invalid currency %q", value)
+		}
+		cfg.validation.defaultCurrency = value
+		return nil
+	})
+	flag.BoolVar(&cfg.validation.strictCurrency, "strict-currency", false, "Reject the users whose currency can't be defaulted from the country")
+	validateOccupation := flag.Bool("validate-occupation", false, "Require the occupation to be a known occupation code")
+	occupationCodes := flag.String("occupation-codes", strings.Join(user.ISCOSubMajorGroups, ","), "Comma-separated occupation codes allowed with -validate-occupation")
+	flag.Func("age-buckets", "Comma-separated lower bounds of the exported age ranges (default 18,25,35,45,55,65)", func(value string) (err error) {
+		user.AgeBuckets, err = user.ParseBuckets(value)
+		return err
+	})
+	flag.Func("income-buckets", "Comma-separated lower bounds of the exported income ranges (default 0,25000,50000,75000,100000,150000,250000)", func(value string) (err error) {
+		user.IncomeBuckets, err = user.ParseBuckets(value)
+		return err
+	})
+	flag.Func("completeness-weights", "Comma-separated weights of the sections in the profile completeness (default date_of_birth:20,income:20,spouse:10,dependents:10,goals:20,protections:10,debts:10)", func(value string) (err error) {
+		user.CompletenessWeights, err = user.ParseWeights(value)
+		return err
+	})
+
+	flag.IntVar(&cfg.validation.maxMetaValueBytes, "max-meta-value-bytes", user.DefaultMaxMetaValueBytes, "Maximum size of a meta value (0 for unlimited)")
+	flag.Func("meta-namespaces", "Comma-separated namespaces allowed in the meta fields, enforced with -meta-policy", func(value string) error {
+		cfg.validation.metaNamespaces = splitList(value)
+		return nil
+	})
+	cfg.validation.metaPolicy = user.MetaPassthrough
+	flag.Func("meta-policy", "Handling of the meta fields of the namespaces not allowed, kept, dropped or rejected with 422 (passthrough|strip|reject) (default passthrough)", func(value string) error {
+		policy := user.MetaPolicy(value)
+		if policy != user.MetaPassthrough && policy != user.MetaStrip && policy != user.MetaReject {
+			return errors.New("must be passthrough, strip or reject")
+		}
+		cfg.validation.metaPolicy = policy
+		return nil
+	})
+	flag.IntVar(&cfg.validation.maxDependents, "max-dependents", user.DefaultMaxDependents, "Maximum number of dependents of a user (0 for unlimited)")
+	flag.DurationVar(&cfg.validation.maxGoalDuration, "max-goal-duration", user.DefaultMaxGoalDuration, "Maximum estimated duration of a goal (0 for unlimited)")
+	flag.BoolVar(&cfg.validation.rejectFutureMilestones, "reject-future-milestones", false, "Reject the milestones dated after the current day")
+
+	// The phone is only set through its verification.
+	cfg.immutableFields = []string{"country_code_alpha_2", "created_at", "phone", "phone_verified"}
+	flag.Func("immutable-fields", "Comma-separated fields which can't be updated after the registration (default country_code_alpha_2,created_at,phone,phone_verified)", func(value string) error {
+		cfg.immutableFields = splitList(strings.ToLower(value))
+		return nil
+	})
+	cfg.sortableAttributes = []string{"created_at", "first_name", "last_name"}
+	flag.Func("sortable-attributes", "Comma-separated text attributes the lists of users can be sorted by (default created_at,first_name,last_name)", func(value string) (err error) {
+		cfg.sortableAttributes, err = parseAttributes(value)
+		return err
+	})
+	cfg.filterableAttributes = []string{"country_code_alpha_2", "province_code", "currency"}
+	flag.Func("filterable-attributes", "Comma-separated text attributes the lists and the exports of users can be filtered on (default country_code_alpha_2,province_code,currency)", func(value string) (err error) {
+		cfg.filterableAttributes, err = parseAttributes(value)
+		return err
+	})
+	flag.IntVar(&cfg.maxUpdateAttributes, "max-update-attributes", 50, "Maximum number of attributes of a single update (0 for unlimited)")
+	cfg.emptyUpdate = "reject"
+	flag.Func("empty-update", "Answer to updates without any field, rejected with 400 or ignored with 304 (reject|noop) (default reject)", func(value string) error {
+		if !validator.In(value, "reject", "noop") {
+			return errors.New("must be reject or noop")
+		}
+		cfg.emptyUpdate = value
+		return nil
+	})
+
+	cfg.goalAppend = "all-or-nothing"
+	flag.Func("goal-append", "Handling of the goal appends with invalid goals, rejected with 422 or applied to the valid goals with 207 (all-or-nothing|best-effort) (default all-or-nothing)", func(value string) error {
+		if !validator.In(value, "all-or-nothing", "best-effort") {
+			return errors.New("must be all-or-nothing or best-effort")
+		}
+		cfg.goalAppend = value
+		return nil
+	})
+
+	flag.StringVar(&cfg.notifier.kind, "notifier", "log", "Notification sender (ses|log)")
+	flag.StringVar(&cfg.notifier.sender, "notifier-sender", "Kapital <no-reply@mykapital.io>", "Sender address of the notifications")
+	flag.StringVar(&cfg.notifier.sms, "sms-notifier", "log", "Text message sender (sns|log)")
+
+	flag.BoolVar(&cfg.maskSupportContacts, "mask-support-contacts", true, "Mask the emails and phones of the users for the support agents")
+	flag.Func("api-keys", "Comma-separated API keys with their role, such as key:admin", func(value string) error {
+		cfg.apiKeys = make(map[string]string)
+		for _, entry := range strings.Split(value, ",") {
+			key, role, ok := strings.Cut(entry, ":")
+			if !ok || key == "" || (role != roleAdmin && role != roleSupport) {
+				return fmt.Errorf("invalid API key entry %q", entry)
+			}
+			cfg.apiKeys[key] = role
+		}
+		return nil
+	})
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
+	selfTest := flag.Bool("self-test", false, "Put, get and delete a throwaway user in the configured table, then exit with its outcome")
 
 	flag.Parse()
 
@@ -76,9 +369,40 @@ func main() {
 		os.Exit(0)
 	}
 
+	cfg.timeouts.routes = map[string]time.Duration{
+		"GET /v1/exports/users":  *exportTimeout,
+		"POST /v1/imports/users": *importTimeout,
+	}
+
+	if *validateOccupation {
+		cfg.validation.occupations = splitList(*occupationCodes)
+	}
+
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
-	err := configSdk(&cfg, logger)
+	setFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+	err := checkRequired(cfg.env, setFlags)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	err = checkNotifiers(cfg.env, cfg.notifier.kind, cfg.notifier.sms)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	resolveLimiters(&cfg, setFlags)
+	logger.PrintInfo("rate limits", map[string]string{
+		"env":                  cfg.env,
+		"limiter_rps":          strconv.FormatFloat(cfg.limiter.rps, 'f', -1, 64),
+		"limiter_burst":        strconv.Itoa(cfg.limiter.burst),
+		"caller_limiter_rps":   strconv.FormatFloat(cfg.callerLimiter.rps, 'f', -1, 64),
+		"caller_limiter_burst": strconv.Itoa(cfg.callerLimiter.burst),
+	})
+
+	cfg.sdk.config, err = data.LoadSDKConfig(cfg.env, cfg.sdk.az, logger)
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
@@ -93,38 +417,194 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	models, err := data.NewModels(
+		data.NewDynamoDBClient(cfg.sdk.config),
+		user.NewRetryBudget(cfg.retryBudget.rps, cfg.retryBudget.burst),
+		cfg.tenant,
+	)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(dynamodb.NewFromConfig(cfg.sdk.config)),
+		config:     cfg,
+		logger:     logger,
+		models:     models,
+		rules:      user.DefaultRules,
+		phoneSends: newPhoneCooldown(),
+	}
+	app.rules.DateOfBirthRequired = cfg.validation.dateOfBirthRequired
+	app.rules.DefaultCurrency = cfg.validation.defaultCurrency
+	app.rules.StrictCurrency = cfg.validation.strictCurrency
+	app.rules.MaxDependents = cfg.validation.maxDependents
+	app.rules.Occupations = cfg.validation.occupations
+	app.rules.MaxMetaValueBytes = cfg.validation.maxMetaValueBytes
+	app.rules.MaxGoalDuration = cfg.validation.maxGoalDuration
+	app.rules.MetaNamespaces = cfg.validation.metaNamespaces
+	app.rules.MetaPolicy = cfg.validation.metaPolicy
+	app.rules.RejectFutureMilestones = cfg.validation.rejectFutureMilestones
+	app.rules.Now = app.now
+	app.models.Users.VersionGrace = cfg.versionGrace
+	app.models.Users.PendingWindow = cfg.pendingWindow
+	app.models.Users.SkipCorruptItems = cfg.skipCorrupt
+	if cfg.normalizeWrites {
+		app.models.Users.WriteTransforms = append(app.models.Users.WriteTransforms, user.Normalize)
+	}
+	if cfg.emailClaims {
+		app.models.Users.EmailTableName, err = user.TenantName(cfg.tenant, "UserEmail")
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+	if cfg.getBatch.window > 0 {
+		app.models.Users.Batcher = &user.GetBatcher{Window: cfg.getBatch.window, MaxSize: cfg.getBatch.maxSize}
+	}
+
+	if *selfTest {
+		err = app.models.Users.SelfTest(context.Background(), func(step string, err error) {
+			if err != nil {
+				logger.PrintError(err, map[string]string{"self_test_step": step})
+				return
+			}
+			logger.PrintInfo("self-test step passed", map[string]string{"self_test_step": step})
+		})
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		logger.PrintInfo("self-test passed", nil)
+		os.Exit(0)
+	}
+
+	if cfg.dedupeUpdates {
+		app.updates = &singleflight.Group{}
 	}
 
-	err = app.serve(logger)
+	switch cfg.notifier.kind {
+	case "ses":
+		app.notifier = notify.SES{Config: cfg.sdk.config, From: cfg.notifier.sender}
+	case "log":
+		app.notifier = notify.Log{Logger: logger}
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown notifier %q", cfg.notifier.kind), nil)
+	}
+
+	switch cfg.notifier.sms {
+	case "sns":
+		app.sms = notify.SNS{Config: cfg.sdk.config}
+	case "log":
+		app.sms = notify.Log{Logger: logger}
+	default:
+		logger.PrintFatal(fmt.Errorf("unknown text message sender %q", cfg.notifier.sms), nil)
+	}
+
+	if (cfg.tls.certFile == "") != (cfg.tls.keyFile == "") {
+		logger.PrintFatal(errors.New("-tls-cert and -tls-key must be set together"), nil)
+	}
+
+	if cfg.tls.certFile != "" {
+		err = app.serveTLS(logger)
+	} else {
+		err = app.serve(logger)
+	}
 	if err != nil {
 		logger.PrintFatal(err, nil)
 	}
 }
 
-func configSdk(cfg *config, logger *jsonlog.Logger) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+// productionFlags are the flags which must be set explicitly in
+// production, as their defaults only suit development.
+var productionFlags = []string{
+	"availability-zone",
+	"api-keys",
+	"notifier",
+	"notifier-sender",
+	"sms-notifier",
+}
 
-	sdkCfg, err := sdkConfig.LoadDefaultConfig(
-		ctx,
-		sdkConfig.WithRegion(cfg.sdk.az),
-		sdkConfig.WithLogger(logger),
-	)
-	if err != nil {
-		return err
+// checkRequired checks that the flags required by the environment were
+// set, given the set of the flags explicitly set.
+func checkRequired(env string, setFlags map[string]bool) error {
+	if env != "production" {
+		return nil
 	}
 
-	if cfg.env == "development" {
-		sdkCfg.EndpointResolverWithOptions = aws.EndpointResolverWithOptionsFunc(
-			func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-				return aws.Endpoint{URL: "http://localhost:8000"}, nil
-			})
+	var missing []string
+	for _, name := range productionFlags {
+		if !setFlags[name] {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s must be set in production", strings.Join(missing, ", "))
 	}
 
-	cfg.sdk.config = sdkCfg
 	return nil
 }
+
+// checkNotifiers checks that the emails and the text messages are really
+// sent in production, where the log notifiers would only log them.
+func checkNotifiers(env, notifier, sms string) error {
+	if env != "production" {
+		return nil
+	}
+
+	var logged []string
+	if notifier == "log" {
+		logged = append(logged, "-notifier")
+	}
+	if sms == "log" {
+		logged = append(logged, "-sms-notifier")
+	}
+	if len(logged) > 0 {
+		return fmt.Errorf("%s must not be log in production", strings.Join(logged, ", "))
+	}
+
+	return nil
+}
+
+// limiterDefaults are the rate limits of each environment, per IP and per
+// API key, looser in development than in production.
+var limiterDefaults = map[string]struct {
+	limiter, callerLimiter limiterConfig
+}{
+	"development": {limiter: limiterConfig{rps: 20, burst: 40}, callerLimiter: limiterConfig{rps: 100, burst: 200}},
+	"staging":     {limiter: limiterConfig{rps: 4, burst: 8}, callerLimiter: limiterConfig{rps: 20, burst: 40}},
+	"production":  {limiter: limiterConfig{rps: 2, burst: 4}, callerLimiter: limiterConfig{rps: 10, burst: 20}},
+}
+
+// resolveLimiters sets the rates of the limiters to the defaults of the
+// environment, except for the flags explicitly set, given the set of the
+// flags explicitly set. An unknown environment gets the production limits.
+func resolveLimiters(cfg *config, setFlags map[string]bool) {
+	defaults, ok := limiterDefaults[cfg.env]
+	if !ok {
+		defaults = limiterDefaults["production"]
+	}
+
+	if !setFlags["limiter-rps"] {
+		cfg.limiter.rps = defaults.limiter.rps
+	}
+	if !setFlags["limiter-burst"] {
+		cfg.limiter.burst = defaults.limiter.burst
+	}
+	if !setFlags["caller-limiter-rps"] {
+		cfg.callerLimiter.rps = defaults.callerLimiter.rps
+	}
+	if !setFlags["caller-limiter-burst"] {
+		cfg.callerLimiter.burst = defaults.callerLimiter.burst
+	}
+}
+
+// splitList splits the comma-separated values of a flag, such as
+// "CA, US", trimming them and dropping the empty ones.
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
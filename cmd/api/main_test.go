@@ -0,0 +1,154 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRequired(t *testing.T) {
+	all := make(map[string]bool)
+	for _, name := range productionFlags {
+		all[name] = true
+	}
+	withoutZone := make(map[string]bool)
+	for name := range all {
+		withoutZone[name] = name != "availability-zone"
+	}
+
+	tests := map[string]struct {
+		env      string
+		setFlags map[string]bool
+		valid    bool
+	}{
+		`production with every flag`:  {env: "production", setFlags: all, valid: true},
+		`production missing the zone`: {env: "production", setFlags: withoutZone, valid: false},
+		`production with no flag`:     {env: "production", setFlags: map[string]bool{}, valid: false},
+		`development with no flag`:    {env: "development", setFlags: map[string]bool{}, valid: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkRequired(tt.env, tt.setFlags)
+			if tt.valid {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			if !tt.setFlags["availability-zone"] {
+				require.Contains(t, err.Error(), "-availability-zone")
+			}
+		})
+	}
+}
+
+func TestCheckNotifiers(t *testing.T) {
+	tests := map[string]struct {
+		env      string
+		notifier string
+		sms      string
+		valid    bool
+	}{
+		`production with senders`:      {env: "production", notifier: "ses", sms: "sns", valid: true},
+		`production logging emails`:    {env: "production", notifier: "log", sms: "sns", valid: false},
+		`production logging messages`:  {env: "production", notifier: "ses", sms: "log", valid: false},
+		`development logging messages`: {env: "development", notifier: "log", sms: "log", valid: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := checkNotifiers(tt.env, tt.notifier, tt.sms)
+			if tt.valid {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestResolveLimiters(t *testing.T) {
+	tests := map[string]struct {
+		env                   string
+		setFlags              map[string]bool
+		expectedLimiter       limiterConfig
+		expectedCallerLimiter limiterConfig
+	}{
+		`development`: {
+			env:                   "development",
+			expectedLimiter:       limiterConfig{rps: 20, burst: 40, enabled: true},
+			expectedCallerLimiter: limiterConfig{rps: 100, burst: 200, enabled: true},
+		},
+		`staging`: {
+			env:                   "staging",
+			expectedLimiter:       limiterConfig{rps: 4, burst: 8, enabled: true},
+			expectedCallerLimiter: limiterConfig{rps: 20, burst: 40, enabled: true},
+		},
+		`production`: {
+			env:                   "production",
+			expectedLimiter:       limiterConfig{rps: 2, burst: 4, enabled: true},
+			expectedCallerLimiter: limiterConfig{rps: 10, burst: 20, enabled: true},
+		},
+		`unknown environment`: {
+			env:                   "qa",
+			expectedLimiter:       limiterConfig{rps: 2, burst: 4, enabled: true},
+			expectedCallerLimiter: limiterConfig{rps: 10, burst: 20, enabled: true},
+		},
+		`explicit flags`: {
+			env:                   "production",
+			setFlags:              map[string]bool{"limiter-rps": true, "caller-limiter-burst": true},
+			expectedLimiter:       limiterConfig{rps: 7, burst: 4, enabled: true},
+			expectedCallerLimiter: limiterConfig{rps: 10, burst: 70, enabled: true},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The values the flags would have parsed.
+			cfg := config{
+				env:           tt.env,
+				limiter:       limiterConfig{rps: 7, burst: 7, enabled: true},
+				callerLimiter: limiterConfig{rps: 70, burst: 70, enabled: true},
+			}
+
+			resolveLimiters(&cfg, tt.setFlags)
+
+			require.Equal(t, tt.expectedLimiter, cfg.limiter)
+			require.Equal(t, tt.expectedCallerLimiter, cfg.callerLimiter)
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected []string
+	}{
+		`single value`:  {value: "CA", expected: []string{"CA"}},
+		`spaces around`: {value: " CA , US ", expected: []string{"CA", "US"}},
+		`empty values`:  {value: "CA,,US,", expected: []string{"CA", "US"}},
+		`no value`:      {value: "", expected: nil},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, splitList(tt.value))
+		})
+	}
+}
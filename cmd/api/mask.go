@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+	"user-service.mykapital.io/internal/data"
+)
+
+// maskEmail hides the local part of the email but its first character,
+// such as j***@example.com.
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "***"
+	}
+
+	_, size := utf8.DecodeRuneInString(email)
+	return email[:size] + "***" + email[at:]
+}
+
+// maskPhone hides the digits of the phone but its last four, such as
+// +*******4567 for +15145554567.
+func maskPhone(phone string) string {
+	const visible = 4
+
+	masked := []rune(phone)
+	for i := 0; i < len(masked)-visible; i++ {
+		if masked[i] != '+' {
+			masked[i] = '*'
+		}
+	}
+
+	return string(masked)
+}
+
+// masksContacts reports whether the contacts of the users are masked for
+// the caller of the request, which is the case for the support agents.
+func (app *application) masksContacts(r *http.Request) bool {
+	return app.config.maskSupportContacts && app.contextGetCaller(r).Role == roleSupport
+}
+
+// shapeUser returns the user as seen by the caller of the request: a copy
+// with its email and phone masked for the support agents, with its codes
+// upper-cased when the reads are normalized, and with the defaults of its
+// country when the reads are defaulted. The stored user is left untouched.
+func (app *application) shapeUser(r *http.Request, usr *data.User) *data.User {
+	masks := app.masksContacts(r)
+	if usr == nil || (!masks && !app.config.normalizeReads && !app.config.readDefaults) {
+		return usr
+	}
+
+	shaped := *usr
+	if masks && shaped.Email != "" {
+		shaped.Email = maskEmail(shaped.Email)
+	}
+	if masks && shaped.Phone != "" {
+		shaped.Phone = maskPhone(shaped.Phone)
+	}
+	if app.config.normalizeReads {
+		shaped.ProvinceCode = strings.ToUpper(shaped.ProvinceCode)
+		shaped.CountryCodeAlpha2 = strings.ToUpper(shaped.CountryCodeAlpha2)
+	}
+	if app.config.readDefaults {
+		app.rules.ReadDefaults(&shaped)
+	}
+
+	return &shaped
+}
+
+// shapeDiff masks the email and the phone of a diff of users like
+// shapeUser.
+func (app *application) shapeDiff(r *http.Request, diff map[string][2]interface{}) map[string][2]interface{} {
+	if !app.masksContacts(r) {
+		return diff
+	}
+
+	masked := make(map[string][2]interface{}, len(diff))
+	for name, values := range diff {
+		for i, value := range values {
+			if s, ok := value.(string); ok && s != "" {
+				switch name {
+				case "email":
+					values[i] = maskEmail(s)
+				case "phone":
+					values[i] = maskPhone(s)
+				}
+			}
+		}
+		masked[name] = values
+	}
+
+	return masked
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+)
+
+func TestMaskEmail(t *testing.T) {
+	tests := map[string]struct {
+		email    string
+		expected string
+	}{
+		`email`:                {email: "john.doe@example.com", expected: "j***@example.com"},
+		`single character`:     {email: "j@example.com", expected: "j***@example.com"},
+		`multibyte first rune`: {email: "élodie@example.com", expected: "é***@example.com"},
+		`no local part`:        {email: "@example.com", expected: "***"},
+		`not an email`:         {email: "john.doe", expected: "***"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, maskEmail(tt.email))
+		})
+	}
+}
+
+func TestMaskPhone(t *testing.T) {
+	tests := map[string]struct {
+		phone    string
+		expected string
+	}{
+		`E.164 phone`: {phone: "+15145554567", expected: "+*******4567"},
+		`short phone`: {phone: "4567", expected: "4567"},
+		`no prefix`:   {phone: "5145554567", expected: "******4567"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tt.expected, maskPhone(tt.phone))
+		})
+	}
+}
+
+func TestShowUserHandlerMasking(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		role          string
+		mask          bool
+		expectedEmail string
+		expectedPhone string
+	}{
+		`support agent`:    {role: roleSupport, mask: true, expectedEmail: "j***@example.com", expectedPhone: "+*******4567"},
+		`admin`:            {role: roleAdmin, mask: true, expectedEmail: "john.doe@example.com", expectedPhone: "+15145554567"},
+		`masking disabled`: {role: roleSupport, mask: false, expectedEmail: "john.doe@example.com", expectedPhone: "+15145554567"},
+		`anonymous caller`: {mask: true, expectedEmail: "john.doe@example.com", expectedPhone: "+15145554567"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.maskSupportContacts = tt.mask
+			stored := &data.User{ID: id, Email: "john.doe@example.com", Phone: "+15145554567", PhoneVerified: true, Version: 1}
+			seedUsers(t, fake, stored)
+
+			req := withParams(httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil), "id", id)
+			if tt.role != "" {
+				req = app.contextSetCaller(req, &caller{Key: "key", Role: tt.role})
+			}
+			rr := httptest.NewRecorder()
+
+			app.showUserHandler(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			var response struct {
+				User data.User `json:"user"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Equal(t, tt.expectedEmail, response.User.Email)
+			require.Equal(t, tt.expectedPhone, response.User.Phone)
+		})
+	}
+}
+
+func TestShowUserHandlerNormalizeReads(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		normalize        bool
+		expectedProvince string
+		expectedCountry  string
+	}{
+		`normalized reads`: {normalize: true, expectedProvince: "ON", expectedCountry: "CA"},
+		`stored case`:      {normalize: false, expectedProvince: "on", expectedCountry: "ca"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.normalizeReads = tt.normalize
+			seedUsers(t, fake, &data.User{ID: id, ProvinceCode: "on", CountryCodeAlpha2: "ca", Version: 1})
+
+			rr := httptest.NewRecorder()
+			app.showUserHandler(rr, withParams(httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil), "id", id))
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			var response struct {
+				User data.User `json:"user"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Equal(t, tt.expectedProvince, response.User.ProvinceCode)
+			require.Equal(t, tt.expectedCountry, response.User.CountryCodeAlpha2)
+
+			// The stored user is left untouched.
+			stored, err := app.models.Users.Get(context.Background(), id)
+			require.NoError(t, err)
+			require.Equal(t, "on", stored.ProvinceCode)
+		})
+	}
+}
+
+func TestShowUserHandlerReadDefaults(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	app.config.readDefaults = true
+	// A legacy item, stored before the division and the currency.
+	fake.Put(map[string]types.AttributeValue{
+		"userID":            &types.AttributeValueMemberS{Value: id},
+		"countryCodeAlpha2": &types.AttributeValueMemberS{Value: "CA"},
+		"provinceCode":      &types.AttributeValueMemberS{Value: "ON"},
+		"version":           &types.AttributeValueMemberN{Value: "1"},
+	})
+
+	rr := httptest.NewRecorder()
+	app.showUserHandler(rr, withParams(httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil), "id", id))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		User data.User `json:"user"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Equal(t, "province", response.User.AdministrativeDivision)
+	require.Equal(t, "CAD", response.User.Currency)
+
+	require.NotContains(t, fake.Items[id], "currency")
+	require.NotContains(t, fake.Items[id], "administrativeDivision")
+}
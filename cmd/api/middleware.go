@@ -16,15 +16,22 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"expvar"
 	"fmt"
 	"github.com/felixge/httpsnoop"
+	"github.com/google/uuid"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
+	"math"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"user-service.mykapital.io/internal/validator"
 )
 
 func (app *application) recoverPanic(next http.Handler) http.Handler {
@@ -42,7 +49,232 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// requestIDRX matches the request IDs accepted from the clients.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID identifies the request with the ID of its X-Request-ID
+// header, such as one set by a load balancer, or with a new one. The ID is
+// echoed in the X-Request-ID header of the response.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDRX.MatchString(id) {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+// securityHeaders are the security headers which can be set on every
+// response, with their value.
+var securityHeaders = map[string]string{
+	"X-Content-Type-Options": "nosniff",
+	"X-Frame-Options":        "DENY",
+	"Referrer-Policy":        "no-referrer",
+}
+
+// secureHeaders sets the configured security headers on every response,
+// and the Strict-Transport-Security header when serving HTTPS.
+func (app *application) secureHeaders(next http.Handler) http.Handler {
+	headers := make(http.Header)
+	for _, name := range app.config.headers.security {
+		headers.Set(name, securityHeaders[name])
+	}
+	if app.config.tls.certFile != "" && app.config.headers.hstsMaxAge > 0 {
+		headers.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d", int64(app.config.headers.hstsMaxAge.Seconds())))
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range headers {
+			w.Header()[name] = values
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsAllowedHeaders are the request headers which may be sent
+// cross-origin.
+var corsAllowedHeaders = []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "X-Read-Consistency", "X-Request-ID"}
+
+// enableCORS allows the trusted origins to call the API cross-origin, and
+// to read the configured response headers.
+//
+// The preflight requests are answered directly, before authentication.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	exposed := strings.Join(app.config.cors.exposedHeaders, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || !validator.In(origin, app.config.cors.trustedOrigins...) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if exposed != "" {
+			w.Header().Set("Access-Control-Expose-Headers", exposed)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, GET, HEAD, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// timeout bounds the context of the requests of a route to the timeout
+// configured for the route, or to the default request timeout.
+//
+// The route is identified by its method and path pattern, such as
+// "GET /v1/users/:id". The context isn't bounded when the timeout is 0.
+//
+// The routes outlasting the write timeout of the server extend the write
+// deadline of their requests, rather than the server raising it for
+// every route.
+func (app *application) timeout(route string, next http.HandlerFunc) http.HandlerFunc {
+	timeout, ok := app.config.timeouts.routes[route]
+	if !ok {
+		timeout = app.config.timeouts.request
+	}
+	if timeout <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if timeout+writeTimeoutMargin > writeTimeout {
+			// The writers not supporting deadlines, such as the recorders of
+			// the tests, have no write timeout to extend.
+			err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + writeTimeoutMargin))
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// proxyHeaders are the headers listing the proxies of a request, which
+// each proxy appends itself to.
+var proxyHeaders = map[string]bool{
+	"Forwarded":       true,
+	"Via":             true,
+	"X-Forwarded-For": true,
+}
+
+// limitHeaders rejects the requests repeating a header more than the
+// configured number of times, such as a long chain of X-Forwarded-For
+// proxies.
+//
+// The comma-separated values of the proxyHeaders count as many values as
+// they contain. The other headers only count their lines, as commas are
+// part of values such as the dates or the user agents.
+func (app *application) limitHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range r.Header {
+			count := len(values)
+			if proxyHeaders[name] {
+				count = 0
+				for _, value := range values {
+					count += strings.Count(value, ",") + 1
+				}
+			}
+
+			if count > app.config.headers.maxValues {
+				app.headerFieldsTooLargeResponse(w, r, name)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate identifies the caller from the API key of the
+// Authorization header. Requests without the header are anonymous.
+func (app *application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			next.ServeHTTP(w, app.contextSetCaller(r, anonymousCaller))
+			return
+		}
+
+		key := strings.TrimPrefix(authorizationHeader, "Bearer ")
+		role, ok := app.config.apiKeys[key]
+		if key == authorizationHeader || !ok {
+			app.invalidAuthenticationResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, app.contextSetCaller(r, &caller{Key: key, Role: role}))
+	})
+}
+
+// requireRole only lets the callers with the role through.
+func (app *application) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return app.requireAnyRole([]string{role}, next)
+}
+
+// requireAnyRole only lets the callers with one of the roles through.
+func (app *application) requireAnyRole(roles []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := app.contextGetCaller(r)
+
+		switch {
+		case c.IsAnonymous():
+			app.invalidAuthenticationResponse(w, r)
+		case !validator.In(c.Role, roles...):
+			app.notPermittedResponse(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// rateLimit limits the requests of each IP.
 func (app *application) rateLimit(next http.Handler) http.Handler {
+	return app.limitRate(&app.config.limiter, realip.FromRequest)(next)
+}
+
+// rateLimitCaller limits the requests of each API key, so a key can't
+// evade the limit of an IP by spreading its requests over many IPs. The
+// anonymous callers are only limited by IP.
+//
+// It must run after authenticate. The rate limit headers then report the
+// budget of the API key.
+func (app *application) rateLimitCaller(next http.Handler) http.Handler {
+	limited := app.limitRate(&app.config.callerLimiter, func(r *http.Request) string {
+		return app.contextGetCaller(r).Key
+	})(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetCaller(r).IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
+
+// limitRate limits the requests of each client, as identified by key.
+func (app *application) limitRate(limits *limiterConfig, key func(*http.Request) string) func(http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
 		lastSeen time.Time
@@ -59,9 +291,9 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 
 			mu.Lock()
 
-			for ip, client := range clients {
+			for k, client := range clients {
 				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
+					delete(clients, k)
 				}
 			}
 
@@ -69,38 +301,88 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		}
 	}()
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limiter.enabled {
-			ip := realip.FromRequest(r)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limits.enabled {
+				k := key(r)
 
-			mu.Lock()
+				mu.Lock()
 
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+				if _, found := clients[k]; !found {
+					clients[k] = &client{
+						limiter: rate.NewLimiter(rate.Limit(limits.rps), limits.burst),
+					}
 				}
-			}
 
-			clients[ip].lastSeen = time.Now()
+				now := time.Now()
+				clients[k].lastSeen = now
+
+				allowed := clients[k].limiter.AllowN(now, 1)
+				setRateLimitHeaders(w, clients[k].limiter, now, allowed)
+				if !allowed {
+					mu.Unlock()
+					app.rateLimitExceededResponse(w, r)
+					return
+				}
 
-			if !clients[ip].limiter.Allow() {
 				mu.Unlock()
-				app.rateLimitExceededResponse(w, r)
-				return
 			}
 
-			mu.Unlock()
-		}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// setRateLimitHeaders reports the budget left in the limiter of the
+// client, so it can throttle itself: X-RateLimit-Limit is the burst of
+// the limiter, X-RateLimit-Remaining the requests allowed right away, and
+// X-RateLimit-Reset the seconds until the budget is whole again.
+//
+// The rejected requests also get a Retry-After header, with the seconds
+// until the next request is allowed.
+func setRateLimitHeaders(w http.ResponseWriter, limiter *rate.Limiter, now time.Time, allowed bool) {
+	tokens := limiter.TokensAt(now)
+	remaining := int(tokens)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limiter.Burst()))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+
+	rps := float64(limiter.Limit())
+	if rps <= 0 {
+		return
+	}
+	reset := math.Ceil((float64(limiter.Burst()) - tokens) / rps)
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(reset)))
+	if !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil((1-tokens)/rps))))
+	}
+}
+
+// expvarInt returns the published expvar.Int with the name, publishing it
+// first if needed, so the handler can be assembled more than once.
+func expvarInt(name string) *expvar.Int {
+	if v, ok := expvar.Get(name).(*expvar.Int); ok {
+		return v
+	}
+	return expvar.NewInt(name)
+}
+
+// expvarMap is like expvarInt for an expvar.Map.
+func expvarMap(name string) *expvar.Map {
+	if v, ok := expvar.Get(name).(*expvar.Map); ok {
+		return v
+	}
+	return expvar.NewMap(name)
 }
 
 func (app *application) metrics(next http.Handler) http.Handler {
-	totalRequestsReceived := expvar.NewInt("total_requests_received")
-	totalResponsesSent := expvar.NewInt("total_responses_sent")
-	totalProcessingTimeMicroseconds := expvar.NewInt("total_processing_time_μs")
-	totalResponsesSentByStatus := expvar.NewMap("total_responses_sent_by_status")
+	totalRequestsReceived := expvarInt("total_requests_received")
+	totalResponsesSent := expvarInt("total_responses_sent")
+	totalProcessingTimeMicroseconds := expvarInt("total_processing_time_μs")
+	totalResponsesSentByStatus := expvarMap("total_responses_sent_by_status")
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		totalRequestsReceived.Add(1)
@@ -0,0 +1,384 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"user-service.mykapital.io/internal/jsonlog"
+)
+
+func TestTimeoutPerRoute(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.timeouts.request = 10 * time.Millisecond
+	app.config.timeouts.routes = map[string]time.Duration{
+		"GET /v1/exports/users": time.Second,
+	}
+
+	// slow takes 50ms to respond, unless its deadline is reached first.
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-time.After(50 * time.Millisecond):
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+
+	tests := map[string]struct {
+		route    string
+		expected int
+	}{
+		`export route tolerates a longer runtime`: {route: "GET /v1/exports/users", expected: http.StatusOK},
+		`normal route times out sooner`:           {route: "GET /v1/users/:id", expected: http.StatusServiceUnavailable},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+
+			app.timeout(tt.route, slow)(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != tt.expected {
+				t.Errorf("unexpected status: got %d, want %d", rr.Code, tt.expected)
+			}
+		})
+	}
+}
+
+// deadlineRecorder records the write deadline set on the response.
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (d *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	d.deadline = deadline
+	return nil
+}
+
+func TestTimeoutWriteDeadline(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.timeouts.request = 10 * time.Second
+	app.config.timeouts.routes = map[string]time.Duration{
+		"GET /v1/exports/users": 5 * time.Minute,
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := map[string]struct {
+		route    string
+		extended bool
+	}{
+		`long route extends the deadline`:    {route: "GET /v1/exports/users", extended: true},
+		`short route keeps the base timeout`: {route: "GET /v1/users/:id", extended: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rr := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+			start := time.Now()
+
+			app.timeout(tt.route, ok)(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("unexpected status: got %d, want %d", rr.Code, http.StatusOK)
+			}
+			if rr.deadline.IsZero() == tt.extended {
+				t.Fatalf("unexpected write deadline: %v", rr.deadline)
+			}
+			if tt.extended && rr.deadline.Before(start.Add(5*time.Minute+writeTimeoutMargin)) {
+				t.Errorf("the write deadline %v doesn't let the route complete", rr.deadline)
+			}
+		})
+	}
+}
+
+func TestLimitHeaders(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.headers.maxValues = 3
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := map[string]struct {
+		name     string
+		values   []string
+		expected int
+	}{
+		`few proxies`:            {name: "X-Forwarded-For", values: []string{"10.0.0.1, 10.0.0.2"}, expected: http.StatusOK},
+		`too many listed values`: {name: "X-Forwarded-For", values: []string{"10.0.0.1, 10.0.0.2, 10.0.0.3, 10.0.0.4"}, expected: http.StatusRequestHeaderFieldsTooLarge},
+		`too many header lines`:  {name: "X-Forwarded-For", values: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"}, expected: http.StatusRequestHeaderFieldsTooLarge},
+		`commas in a value`:      {name: "If-Modified-Since", values: []string{"Sun, 05 Feb 2023 10:00:00 GMT"}, expected: http.StatusOK},
+		`long list of types`:     {name: "Accept", values: []string{"text/html, application/xhtml+xml, application/xml;q=0.9, */*;q=0.8"}, expected: http.StatusOK},
+		`too many other lines`:   {name: "Accept", values: []string{"text/html", "application/xml", "application/json", "*/*"}, expected: http.StatusRequestHeaderFieldsTooLarge},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header[tt.name] = tt.values
+			rr := httptest.NewRecorder()
+
+			app.limitHeaders(ok).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("unexpected status: got %d, want %d", rr.Code, tt.expected)
+			}
+		})
+	}
+}
+
+func TestServerMaxHeaderBytes(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.headers.maxBytes = 1 << 10
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := app.server(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), jsonlog.New(io.Discard, jsonlog.LevelOff))
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Padding", strings.Repeat("a", 16<<10))
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("unexpected status: got %d, want %d", res.StatusCode, http.StatusRequestHeaderFieldsTooLarge)
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := map[string]struct {
+		security []string
+		tls      bool
+		expected map[string]string
+	}{
+		`every header`: {
+			security: []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy"},
+			expected: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "no-referrer",
+				"Strict-Transport-Security": "",
+			},
+		},
+		`every header over TLS`: {
+			security: []string{"X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy"},
+			tls:      true,
+			expected: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Strict-Transport-Security": "max-age=31536000",
+			},
+		},
+		`disabled behind a gateway`: {
+			security: nil,
+			expected: map[string]string{
+				"X-Content-Type-Options":    "",
+				"X-Frame-Options":           "",
+				"Referrer-Policy":           "",
+				"Strict-Transport-Security": "",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.headers.security = tt.security
+			app.config.headers.hstsMaxAge = 365 * 24 * time.Hour
+			if tt.tls {
+				app.config.tls.certFile = "cert.pem"
+			}
+			rr := httptest.NewRecorder()
+
+			app.secureHeaders(ok).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			for header, expected := range tt.expected {
+				if got := rr.Header().Get(header); got != expected {
+					t.Errorf("unexpected %s header: got %q, want %q", header, got, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestEnableCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := map[string]struct {
+		origin          string
+		exposedHeaders  []string
+		expectedOrigin  string
+		expectedExposed string
+	}{
+		`default exposed headers`: {
+			origin:          "https://app.mykapital.io",
+			exposedHeaders:  []string{"ETag", "Location", "X-Request-ID"},
+			expectedOrigin:  "https://app.mykapital.io",
+			expectedExposed: "ETag, Location, X-Request-ID",
+		},
+		`configured exposed headers`: {
+			origin:          "https://app.mykapital.io",
+			exposedHeaders:  []string{"ETag"},
+			expectedOrigin:  "https://app.mykapital.io",
+			expectedExposed: "ETag",
+		},
+		`untrusted origin`: {
+			origin:         "https://evil.example.com",
+			exposedHeaders: []string{"ETag", "Location", "X-Request-ID"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.cors.trustedOrigins = []string{"https://app.mykapital.io"}
+			app.config.cors.exposedHeaders = tt.exposedHeaders
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+			req.Header.Set("Origin", tt.origin)
+			rr := httptest.NewRecorder()
+
+			app.enableCORS(ok).ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedOrigin {
+				t.Errorf("unexpected Access-Control-Allow-Origin header: got %q, want %q", got, tt.expectedOrigin)
+			}
+			if got := rr.Header().Get("Access-Control-Expose-Headers"); got != tt.expectedExposed {
+				t.Errorf("unexpected Access-Control-Expose-Headers header: got %q, want %q", got, tt.expectedExposed)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.limiter.enabled = true
+	app.config.limiter.rps = 0.1
+	app.config.limiter.burst = 3
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := app.rateLimit(ok)
+
+	for i, expected := range []struct {
+		status    int
+		remaining string
+	}{
+		{http.StatusOK, "2"},
+		{http.StatusOK, "1"},
+		{http.StatusOK, "0"},
+		{http.StatusTooManyRequests, "0"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != expected.status {
+			t.Errorf("request %d: unexpected status: got %d, want %d", i, rr.Code, expected.status)
+		}
+		if got := rr.Header().Get("X-RateLimit-Limit"); got != "3" {
+			t.Errorf("request %d: unexpected limit: got %q, want %q", i, got, "3")
+		}
+		if got := rr.Header().Get("X-RateLimit-Remaining"); got != expected.remaining {
+			t.Errorf("request %d: unexpected remaining: got %q, want %q", i, got, expected.remaining)
+		}
+		if reset, err := strconv.Atoi(rr.Header().Get("X-RateLimit-Reset")); err != nil || reset < 1 || reset > 30 {
+			t.Errorf("request %d: unexpected reset: %q", i, rr.Header().Get("X-RateLimit-Reset"))
+		}
+		if retry := rr.Header().Get("Retry-After"); (retry != "") != (expected.status == http.StatusTooManyRequests) {
+			t.Errorf("request %d: unexpected Retry-After %q for status %d", i, retry, rr.Code)
+		}
+	}
+}
+
+func TestRateLimitCaller(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.apiKeys = map[string]string{"key-1": roleAdmin, "key-2": roleAdmin}
+	app.config.limiter = limiterConfig{rps: 0.1, burst: 2, enabled: true}
+	app.config.callerLimiter = limiterConfig{rps: 0.1, burst: 3, enabled: true}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := app.rateLimit(app.authenticate(app.rateLimitCaller(ok)))
+
+	request := func(ip, key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", ip)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The key is limited even though each of its IPs is under its own limit.
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := request(fmt.Sprintf("203.0.113.%d", i+1), "key-1"); code != expected {
+			t.Errorf("request %d of key-1: unexpected status: got %d, want %d", i, code, expected)
+		}
+	}
+
+	// The limit of a key doesn't affect the other keys, nor the anonymous
+	// callers, which are only limited by IP.
+	if code := request("198.51.100.1", "key-2"); code != http.StatusOK {
+		t.Errorf("unexpected status of key-2: got %d, want %d", code, http.StatusOK)
+	}
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := request("198.51.100.2", ""); code != expected {
+			t.Errorf("anonymous request %d: unexpected status: got %d, want %d", i, code, expected)
+		}
+	}
+
+	// The limit of an IP still applies to the keys.
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if code := request("198.51.100.3", "key-2"); code != expected {
+			t.Errorf("request %d of key-2 from one IP: unexpected status: got %d, want %d", i, code, expected)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// pagination is the metadata of a page of a collection, given alongside
+// its items:
+//
+//	{"users":[...],"page_size":20,"next_cursor":"...","total":1234}
+//
+// Every collection endpoint shares this shape.
+type pagination struct {
+	PageSize int `json:"page_size"`
+	// NextCursor is null on the last page.
+	NextCursor *string `json:"next_cursor"`
+	// Total is the approximate size of the collection, only given when
+	// requested.
+	Total *int64 `json:"total,omitempty"`
+}
+
+// newPagination returns the metadata of a page, continued from nextKey.
+func newPagination(pageSize int, nextKey map[string]types.AttributeValue) (pagination, error) {
+	p := pagination{PageSize: pageSize}
+
+	cursor, err := encodeCursor(nextKey)
+	if err != nil {
+		return pagination{}, err
+	}
+	if cursor != "" {
+		p.NextCursor = &cursor
+	}
+
+	return p, nil
+}
+
+// totalTTL is how long the approximate total of users is cached.
+const totalTTL = 5 * time.Minute
+
+// totalCache caches the approximate total of users.
+type totalCache struct {
+	mu        sync.Mutex
+	value     int64
+	fetchedAt time.Time
+}
+
+// approximateTotal returns the approximate number of users, cached for
+// totalTTL.
+func (app *application) approximateTotal(ctx context.Context) (int64, error) {
+	app.total.mu.Lock()
+	defer app.total.mu.Unlock()
+
+	if !app.total.fetchedAt.IsZero() && time.Since(app.total.fetchedAt) < totalTTL {
+		return app.total.value, nil
+	}
+
+	total, err := app.models.Users.ApproximateCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+	app.total.value, app.total.fetchedAt = total, time.Now()
+
+	return total, nil
+}
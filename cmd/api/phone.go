@@ -0,0 +1,239 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// phoneCooldown remembers when a code was last sent to each phone number,
+// so a number can't be flooded through many users.
+type phoneCooldown struct {
+	mu     sync.Mutex
+	sentAt map[string]time.Time
+}
+
+func newPhoneCooldown() *phoneCooldown {
+	return &phoneCooldown{sentAt: make(map[string]time.Time)}
+}
+
+// allow reports whether a code can be sent to the phone, and records the
+// send when it can. The numbers out of their cooldown are forgotten along
+// the way.
+func (c *phoneCooldown) allow(phone string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, sentAt := range c.sentAt {
+		if !now.Before(sentAt.Add(user.PhoneResendCooldown)) {
+			delete(c.sentAt, k)
+		}
+	}
+
+	if _, found := c.sentAt[phone]; found {
+		return false
+	}
+	c.sentAt[phone] = now
+
+	return true
+}
+
+// sendPhoneCode sends the phone verification code to the phone in the
+// background.
+func (app *application) sendPhoneCode(id, phone, code string) {
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		body := fmt.Sprintf("Your Kapital verification code is %s. It expires in %s.", code, user.PhoneVerificationTTL)
+
+		err := app.sms.Send(ctx, phone, "Verify your phone", body)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": id})
+		}
+	})
+}
+
+// getUser returns the user of the id parameter of the request, or sends
+// an error response.
+func (app *application) getUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, ok := app.readIDParam(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	usr, err := app.models.Users.Get(r.Context(), id.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return usr, true
+}
+
+// requestPhoneVerificationHandler sends a code verifying the given phone
+// to the user, replacing the pending verification.
+//
+// A verification locked out by wrong codes can't be replaced before it
+// expires, else the lockout could be reset at will. Codes are also sent
+// at most once every user.PhoneResendCooldown to each user and to each
+// number, so the endpoint can't be used to flood a phone.
+func (app *application) requestPhoneVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Phone string `json:"phone"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.Matches(input.Phone, validator.PhoneRX), "phone", "must be a phone number in the E.164 format")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	usr, ok := app.getUser(w, r)
+	if !ok {
+		return
+	}
+
+	now := app.now()
+	if usr.PhoneVerification.Locked(now) {
+		app.phoneLockedResponse(w, r)
+		return
+	}
+	if usr.PhoneVerification.CoolingDown(now) || (app.phoneSends != nil && !app.phoneSends.allow(input.Phone, now)) {
+		app.phoneCooldownResponse(w, r)
+		return
+	}
+
+	code, verification, err := data.NewPhoneVerification(input.Phone, now)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.SetPhoneVerification(r.Context(), usr, verification)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.sendPhoneCode(usr.ID, input.Phone, code)
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "a verification code was sent to the phone"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// recordPhoneAttempt counts a wrong code against the pending phone
+// verification of the user, unless it has expired.
+func (app *application) recordPhoneAttempt(ctx context.Context, usr *data.User, now time.Time) error {
+	if usr.PhoneVerification.Expired(now) {
+		return nil
+	}
+
+	attempted := *usr.PhoneVerification
+	attempted.Attempts++
+
+	return app.models.Users.SetPhoneVerification(ctx, usr, &attempted)
+}
+
+// verifyPhoneHandler sets the phone of the user once the code of its
+// pending phone verification is confirmed. Wrong codes are counted, and
+// lock the verification out after user.MaxPhoneAttempts.
+func (app *application) verifyPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Code != "", "code", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	usr, ok := app.getUser(w, r)
+	if !ok {
+		return
+	}
+
+	now := app.now()
+	err = usr.PhoneVerification.Check(input.Code, now)
+	switch {
+	case errors.Is(err, data.ErrPhoneLocked):
+		app.phoneLockedResponse(w, r)
+		return
+	case errors.Is(err, data.ErrInvalidPhoneCode):
+		switch err = app.recordPhoneAttempt(r.Context(), usr, now); {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case err != nil:
+			app.serverErrorResponse(w, r, err)
+		default:
+			v.AddError("code", "invalid or expired verification code")
+			app.failedValidationResponse(w, r, v.Errors)
+		}
+		return
+	}
+
+	err = app.models.Users.VerifyPhone(r.Context(), usr)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, resourceEnvelope("user", app.shapeUser(r, usr)), nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+)
+
+func TestPhoneVerification(t *testing.T) {
+	const (
+		id    = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+		phone = "+15145550123"
+	)
+
+	tests := map[string]struct {
+		// wrongCodes are sent before the right code.
+		wrongCodes int
+		// wait is the time elapsed before the right code.
+		wait     time.Duration
+		expected int
+	}{
+		`right code`:                  {expected: http.StatusOK},
+		`right code after wrong ones`: {wrongCodes: user.MaxPhoneAttempts - 1, expected: http.StatusOK},
+		`expired code`:                {wait: user.PhoneVerificationTTL, expected: http.StatusUnprocessableEntity},
+		`locked out`:                  {wrongCodes: user.MaxPhoneAttempts, expected: http.StatusTooManyRequests},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			now := time.Date(2023, 2, 5, 10, 0, 0, 0, time.UTC)
+			app.clock = func() time.Time { return now }
+			seedUsers(t, fake, &data.User{ID: id, FirstName: "John", Version: 1})
+			handler := app.router()
+
+			send := func(method, path, body string) *httptest.ResponseRecorder {
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, httptest.NewRequest(method, "/v1/users/"+id+path, strings.NewReader(body)))
+				return rr
+			}
+
+			rr := send(http.MethodPut, "/phone-verification", `{"phone":"`+phone+`"}`)
+			require.Equal(t, http.StatusAccepted, rr.Code)
+
+			app.wg.Wait()
+			sent := app.sms.(*fakeNotifier).sent()
+			require.Len(t, sent, 1)
+			require.Equal(t, phone, sent[0].to)
+			code := regexp.MustCompile(`[0-9]{6}`).FindString(sent[0].body)
+			require.NotEmpty(t, code)
+
+			wrong := "000000"
+			if code == wrong {
+				wrong = "111111"
+			}
+			for i := 0; i < tt.wrongCodes; i++ {
+				rr = send(http.MethodPut, "/phone", `{"code":"`+wrong+`"}`)
+				require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+			}
+
+			now = now.Add(tt.wait)
+			rr = send(http.MethodPut, "/phone", `{"code":"`+code+`"}`)
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+
+			stored, err := app.models.Users.Get(context.Background(), id)
+			require.NoError(t, err)
+			if tt.expected == http.StatusOK {
+				require.Equal(t, phone, stored.Phone)
+				require.True(t, stored.PhoneVerified)
+				require.Nil(t, stored.PhoneVerification)
+			} else {
+				require.Empty(t, stored.Phone)
+			}
+
+			if tt.expected == http.StatusTooManyRequests {
+				// The lockout can't be reset by a new code.
+				rr = send(http.MethodPut, "/phone-verification", `{"phone":"`+phone+`"}`)
+				require.Equal(t, http.StatusTooManyRequests, rr.Code)
+			}
+		})
+	}
+}
+
+func TestPhoneVerificationCooldown(t *testing.T) {
+	const (
+		id    = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+		other = "5b1c8e2a-7d4f-4a3b-8c6e-2f9d1a0b7c35"
+		phone = "+15145550123"
+	)
+
+	app, fake := newTestApplication(t)
+	now := time.Date(2023, 2, 5, 10, 0, 0, 0, time.UTC)
+	app.clock = func() time.Time { return now }
+	seedUsers(t, fake, &data.User{ID: id, FirstName: "John", Version: 1}, &data.User{ID: other, FirstName: "Jane", Version: 1})
+	handler := app.router()
+
+	request := func(id, phone string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		body := strings.NewReader(`{"phone":"` + phone + `"}`)
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/v1/users/"+id+"/phone-verification", body))
+		return rr
+	}
+
+	require.Equal(t, http.StatusAccepted, request(id, phone).Code)
+
+	// Neither the user nor the number can be sent another code right away.
+	rr := request(id, "+15145550124")
+	require.Equal(t, http.StatusTooManyRequests, rr.Code)
+	require.NotEmpty(t, rr.Header().Get("Retry-After"))
+	require.Equal(t, http.StatusTooManyRequests, request(other, phone).Code)
+
+	now = now.Add(user.PhoneResendCooldown)
+	require.Equal(t, http.StatusAccepted, request(id, phone).Code)
+	require.Equal(t, http.StatusAccepted, request(other, "+15145550124").Code)
+
+	app.wg.Wait()
+	require.Len(t, app.sms.(*fakeNotifier).sent(), 3)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// textAttribute is a text attribute of the users, which the lists can be
+// sorted and filtered on.
+type textAttribute struct {
+	// name is the name of the dynamodb attribute.
+	name string
+	// index is the index of the field in data.User.
+	index int
+}
+
+// textAttributes are the text attributes of the users, by JSON name.
+var textAttributes = func() map[string]textAttribute {
+	attributes := make(map[string]textAttribute)
+	typ := reflect.TypeOf(data.User{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Type.Kind() != reflect.String || jsonName == "" || jsonName == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("dynamodbav"), ",")
+		attributes[jsonName] = textAttribute{name: name, index: i}
+	}
+
+	return attributes
+}()
+
+// parseAttributes parses comma-separated text attributes, such as
+// "created_at,last_name".
+func parseAttributes(value string) ([]string, error) {
+	var attributes []string
+	for _, attribute := range strings.Split(value, ",") {
+		attribute = strings.TrimSpace(attribute)
+		if attribute == "" {
+			continue
+		}
+		if _, ok := textAttributes[attribute]; !ok {
+			return nil, fmt.Errorf("unknown text attribute %q", attribute)
+		}
+		attributes = append(attributes, attribute)
+	}
+
+	return attributes, nil
+}
+
+// listQuery is how a list of users is sorted and filtered.
+type listQuery struct {
+	// sort is the attribute the users are sorted by, in descending order
+	// when desc is set.
+	sort string
+	desc bool
+	// filters are the values the attributes of the users must be equal to,
+	// by attribute.
+	filters map[string]string
+}
+
+// readListQuery reads the sort of a list, as sort=<attribute> or
+// sort=-<attribute> in descending order, and its filters, as any number of
+// filter=<attribute>:<value>.
+//
+// Sorting and filtering on an attribute may scan the whole table, so only
+// the configured sortable and filterable attributes are allowed.
+func (app *application) readListQuery(qs url.Values, v *validator.Validator) listQuery {
+	var q listQuery
+
+	if s := qs.Get("sort"); s != "" {
+		q.sort = strings.TrimPrefix(s, "-")
+		q.desc = q.sort != s
+		v.Check(validator.In(q.sort, app.config.sortableAttributes...), "sort", allowedAttributes(app.config.sortableAttributes))
+	}
+
+	for _, filter := range qs["filter"] {
+		attribute, value, ok := strings.Cut(filter, ":")
+		switch {
+		case !ok:
+			v.AddError("filter", "must be given as attribute:value")
+		case !validator.In(attribute, app.config.filterableAttributes...):
+			v.AddError("filter", allowedAttributes(app.config.filterableAttributes))
+		default:
+			if q.filters == nil {
+				q.filters = make(map[string]string)
+			}
+			q.filters[attribute] = value
+		}
+	}
+
+	return q
+}
+
+// allowedAttributes is the validation message of an attribute which isn't
+// one of the allowed attributes.
+func allowedAttributes(allowed []string) string {
+	if len(allowed) == 0 {
+		return "is not supported"
+	}
+	return "must be one of " + strings.Join(allowed, ", ")
+}
+
+// filter is the condition the users matching the filters meet. It isn't
+// set when there is no filter.
+func (q listQuery) filter() expression.ConditionBuilder {
+	attributes := make([]string, 0, len(q.filters))
+	for attribute := range q.filters {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+
+	conditions := make([]expression.ConditionBuilder, 0, len(attributes))
+	for _, attribute := range attributes {
+		name := expression.Name(textAttributes[attribute].name)
+		conditions = append(conditions, name.Equal(expression.Value(q.filters[attribute])))
+	}
+
+	switch len(conditions) {
+	case 0:
+		return expression.ConditionBuilder{}
+	case 1:
+		return conditions[0]
+	default:
+		return expression.And(conditions[0], conditions[1], conditions[2:]...)
+	}
+}
+
+// sortUsers sorts the users by the sort attribute of the query, keeping
+// the order of the users with equal attributes.
+func (q listQuery) sortUsers(users []*data.User) {
+	index := textAttributes[q.sort].index
+	sort.SliceStable(users, func(i, j int) bool {
+		a := reflect.ValueOf(users[i]).Elem().Field(index).String()
+		b := reflect.ValueOf(users[j]).Elem().Field(index).String()
+		if q.desc {
+			return a > b
+		}
+		return a < b
+	})
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"user-service.mykapital.io/internal/data"
+)
+
+// showRawUserHandler shows the item of a user as stored in DynamoDB, to
+// debug the marshaling of users.
+func (app *application) showRawUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.readIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	item, err := app.users(r).GetRaw(r.Context(), id.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, resourceEnvelope("item", rawItem(item)), nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rawItem represents an item in the DynamoDB JSON format, where every
+// value is keyed by its type, such as {"email": {"S": "john.doe@example.com"}}.
+func rawItem(item map[string]types.AttributeValue) map[string]interface{} {
+	raw := make(map[string]interface{}, len(item))
+	for name, value := range item {
+		raw[name] = rawValue(value)
+	}
+
+	return raw
+}
+
+func rawValue(value types.AttributeValue) interface{} {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]interface{}{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]interface{}{"N": v.Value}
+	case *types.AttributeValueMemberB:
+		return map[string]interface{}{"B": v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]interface{}{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]interface{}{"NULL": v.Value}
+	case *types.AttributeValueMemberSS:
+		return map[string]interface{}{"SS": v.Value}
+	case *types.AttributeValueMemberNS:
+		return map[string]interface{}{"NS": v.Value}
+	case *types.AttributeValueMemberBS:
+		return map[string]interface{}{"BS": v.Value}
+	case *types.AttributeValueMemberM:
+		return map[string]interface{}{"M": rawItem(v.Value)}
+	case *types.AttributeValueMemberL:
+		list := make([]interface{}, len(v.Value))
+		for i, element := range v.Value {
+			list[i] = rawValue(element)
+		}
+		return map[string]interface{}{"L": list}
+	default:
+		return nil
+	}
+}
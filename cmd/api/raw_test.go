@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+)
+
+func TestShowRawUserHandler(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	app.config.apiKeys = map[string]string{"admin-key": roleAdmin, "support-key": roleSupport}
+	seedUsers(t, fake, &data.User{ID: id, FirstName: "John", Version: 1})
+	fake.Items[id]["legacyField"] = &types.AttributeValueMemberS{Value: "unexpected"}
+
+	handler := app.authenticate(app.router())
+
+	tests := map[string]struct {
+		id       string
+		key      string
+		expected int
+	}{
+		`admin`:          {id: id, key: "admin-key", expected: http.StatusOK},
+		`missing user`:   {id: "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22", key: "admin-key", expected: http.StatusNotFound},
+		`support`:        {id: id, key: "support-key", expected: http.StatusForbidden},
+		`unknown key`:    {id: id, key: "guessed-key", expected: http.StatusUnauthorized},
+		`anonymous user`: {id: id, expected: http.StatusUnauthorized},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/"+tt.id+"/raw", nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, tt.expected, rr.Code)
+			if tt.expected != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Item map[string]map[string]interface{} `json:"item"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Equal(t, id, response.Item["userID"]["S"])
+			require.Equal(t, "John", response.Item["firstName"]["S"])
+			require.Equal(t, "1", response.Item["version"]["N"])
+			require.Equal(t, "unexpected", response.Item["legacyField"]["S"])
+		})
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// errPreconditionFailed is returned when the conditional headers of a
+// request are not met.
+var errPreconditionFailed = errors.New("precondition failed")
+
+// replaceUserHandler stores the user at the given id, creating it when
+// it doesn't exist yet.
+//
+// The replacement is conditional with one of the headers:
+//   - If-None-Match: * only creates the user, if it doesn't exist.
+//   - If-Match: "<version>" only replaces the user at the version of the
+//     ETag returned with the user, or at any version for *.
+//
+// A failed condition is answered with 412 Precondition Failed. The fields
+// managed by the server, such as created_at or activated, are kept.
+func (app *application) replaceUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.readIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	ifNoneMatch, ifMatch := r.Header.Get("If-None-Match"), r.Header.Get("If-Match")
+	switch {
+	case ifNoneMatch != "" && ifMatch != "":
+		app.badRequestResponse(w, r, errors.New("If-None-Match and If-Match can't be combined"))
+		return
+	case ifNoneMatch != "" && ifNoneMatch != "*":
+		app.badRequestResponse(w, r, errors.New("If-None-Match only supports *"))
+		return
+	}
+
+	input := data.User{}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	old, err := app.models.Users.Get(r.Context(), id.String())
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		old = nil
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	usr := &input
+	usr.ID = id.String()
+	usr.DeletedAt = ""
+	if old != nil {
+		usr.CreatedAt = old.CreatedAt
+		usr.Activated = old.Activated
+		usr.Verification = old.Verification
+		usr.Phone = old.Phone
+		usr.PhoneVerified = old.PhoneVerified
+		usr.PhoneVerification = old.PhoneVerification
+	} else {
+		usr.CreatedAt = app.now().Format("2006-01-02")
+		usr.Activated = false
+		usr.Verification = nil
+		usr.Phone = ""
+		usr.PhoneVerified = false
+		usr.PhoneVerification = nil
+	}
+
+	data.Normalize(usr)
+
+	v := validator.New()
+	app.rules.FillDefaults(v, usr)
+	usr.Meta = app.filterMeta(v, usr.ID, usr.Meta)
+	if app.rules.ValidateUser(v, usr); old != nil {
+		for _, field := range app.changedImmutableFields(old, usr) {
+			v.AddError(field, "cannot be changed")
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var token string
+	if old == nil {
+		token, usr.Verification, err = data.NewVerification(app.now())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	conditional := ifNoneMatch != "" || ifMatch != ""
+	switch {
+	case ifNoneMatch == "*":
+		err = errPreconditionFailed
+		if old == nil {
+			usr.Version = 1
+			err = app.models.Users.CreateIfAbsent(r.Context(), usr)
+		}
+	case ifMatch != "":
+		err = errPreconditionFailed
+		if version, ok := matchVersion(ifMatch, old); ok {
+			err = app.models.Users.Replace(r.Context(), usr, version)
+		}
+	case old == nil:
+		usr.Version = 1
+		err = app.models.Users.CreateIfAbsent(r.Context(), usr)
+	default:
+		err = app.models.Users.Replace(r.Context(), usr, old.Version)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, errPreconditionFailed):
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrConditionFailed) && conditional:
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrConditionFailed):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrPendingVerification):
+			app.pendingVerificationResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(usr.Version))
+
+	env := resourceEnvelope("user", app.shapeUser(r, usr))
+	if len(v.Warnings) > 0 {
+		env["warnings"] = v.Warnings
+	}
+
+	status := http.StatusOK
+	if old == nil {
+		app.sendVerificationEmail(usr, token)
+		headers.Set("Location", fmt.Sprintf("/v1/users/%s", usr.ID))
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, status, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// matchVersion returns the version of the user matched by the If-Match
+// header, which is either * or a list of ETags. It doesn't match a
+// missing user.
+func matchVersion(ifMatch string, old *data.User) (int64, bool) {
+	if old == nil {
+		return 0, false
+	}
+	if strings.TrimSpace(ifMatch) == "*" {
+		return old.Version, true
+	}
+
+	for _, tag := range strings.Split(ifMatch, ",") {
+		s, err := strconv.Unquote(strings.TrimSpace(tag))
+		if err != nil {
+			continue
+		}
+		version, err := strconv.ParseInt(s, 10, 64)
+		if err == nil && version == old.Version {
+			return version, true
+		}
+	}
+
+	return 0, false
+}
+
+// changedImmutableFields lists the immutable fields which differ between
+// the stored user and its replacement.
+func (app *application) changedImmutableFields(old, usr *data.User) []string {
+	var changed []string
+	oldVal, val := reflect.ValueOf(*old), reflect.ValueOf(*usr)
+	typ := oldVal.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		jsonName, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if !validator.In(jsonName, app.config.immutableFields...) {
+			continue
+		}
+		if !reflect.DeepEqual(oldVal.Field(i).Interface(), val.Field(i).Interface()) {
+			changed = append(changed, jsonName)
+		}
+	}
+
+	return changed
+}
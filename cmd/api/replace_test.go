@@ -0,0 +1,120 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+)
+
+func TestReplaceUserHandler(t *testing.T) {
+	const (
+		id   = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+		body = `{"email":"john.doe@example.com","first_name":"Johnny","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+	)
+
+	tests := map[string]struct {
+		existing        bool
+		headers         map[string]string
+		expectedStatus  int
+		expectedVersion int64
+		expectedName    string
+	}{
+		`create if absent`: {
+			headers:         map[string]string{"If-None-Match": "*"},
+			expectedStatus:  http.StatusCreated,
+			expectedVersion: 1,
+			expectedName:    "Johnny",
+		},
+		`create if absent conflicts with existing user`: {
+			existing:        true,
+			headers:         map[string]string{"If-None-Match": "*"},
+			expectedStatus:  http.StatusPreconditionFailed,
+			expectedVersion: 3,
+			expectedName:    "John",
+		},
+		`replace if match`: {
+			existing:        true,
+			headers:         map[string]string{"If-Match": `"3"`},
+			expectedStatus:  http.StatusOK,
+			expectedVersion: 4,
+			expectedName:    "Johnny",
+		},
+		`replace if match with stale version`: {
+			existing:        true,
+			headers:         map[string]string{"If-Match": `"2"`},
+			expectedStatus:  http.StatusPreconditionFailed,
+			expectedVersion: 3,
+			expectedName:    "John",
+		},
+		`replace if match of missing user`: {
+			headers:        map[string]string{"If-Match": `"1"`},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		`plain replace`: {
+			existing:        true,
+			expectedStatus:  http.StatusOK,
+			expectedVersion: 4,
+			expectedName:    "Johnny",
+		},
+		`plain create`: {
+			expectedStatus:  http.StatusCreated,
+			expectedVersion: 1,
+			expectedName:    "Johnny",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			if tt.existing {
+				seedUsers(t, fake, &data.User{
+					ID: id, Email: "john.doe@example.com", FirstName: "John", LastName: "Doe",
+					ProvinceCode: "ON", CountryCodeAlpha2: "CA", CreatedAt: "2023-01-01", Version: 3, Activated: true,
+				})
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/v1/users/"+id, strings.NewReader(body))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+
+			app.replaceUserHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+
+			usr, err := app.models.Users.Get(context.Background(), id)
+			if tt.expectedVersion == 0 {
+				require.ErrorIs(t, err, data.ErrRecordNotFound)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedName, usr.FirstName)
+			require.Equal(t, tt.expectedVersion, usr.Version)
+			if tt.existing {
+				require.Equal(t, "2023-01-01", usr.CreatedAt)
+				require.True(t, usr.Activated)
+			}
+		})
+	}
+}
@@ -21,20 +21,72 @@ import (
 	"net/http"
 )
 
+// routes returns the handler of the server: the router of every endpoint,
+// wrapped in the middleware chain. The first middleware runs first.
 func (app *application) routes() http.Handler {
+	chain := []func(http.Handler) http.Handler{
+		app.metrics,
+		app.requestID,
+		app.enableCORS,
+		app.secureHeaders,
+		app.recoverPanic,
+		app.limitHeaders,
+		app.rateLimit,
+		app.authenticate,
+		app.rateLimitCaller,
+	}
+
+	var handler http.Handler = app.router()
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+
+	return handler
+}
+
+// router registers the handlers of the API.
+func (app *application) router() *httprouter.Router {
 	router := httprouter.New()
 
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	index := apiIndex{}
+	handle := func(method, path string, handler http.HandlerFunc) {
+		index.add(method, path)
+		router.HandlerFunc(method, path, app.timeout(method+" "+path, handler))
+	}
+
+	handle(http.MethodGet, "/v1", app.indexHandler(index))
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+
+	// The list reads every user, so it is left to the staff. The support
+	// agents see the contacts of the users masked.
+	handle(http.MethodGet, "/v1/users", app.requireAnyRole([]string{roleAdmin, roleSupport}, app.listUsersHandler))
+	handle(http.MethodPost, "/v1/users", app.createUserHandler)
+	handle(http.MethodPost, "/v1/users/batch", app.showUsersBatchHandler)
+	// POST /v1/users/batch already fetches users by id, and PUT would
+	// conflict with PUT /v1/users/:id, so the batch insert has its own path.
+	handle(http.MethodPost, "/v1/users/batch/insert", app.requireRole(roleAdmin, app.insertUsersBatchHandler))
+	handle(http.MethodGet, "/v1/users/:id", app.showUserHandler)
+	handle(http.MethodHead, "/v1/users/:id", app.showUserHandler)
+	handle(http.MethodPut, "/v1/users/:id", app.replaceUserHandler)
+	handle(http.MethodPatch, "/v1/users/:id", app.updateUserHandler)
+	handle(http.MethodDelete, "/v1/users/:id", app.deleteUserHandler)
+	handle(http.MethodPut, "/v1/users/:id/verification", app.activateUserHandler)
+	// POST would conflict with POST /v1/users/batch, so a new phone
+	// verification is PUT in place of the pending one.
+	handle(http.MethodPut, "/v1/users/:id/phone-verification", app.requestPhoneVerificationHandler)
+	handle(http.MethodPut, "/v1/users/:id/phone", app.verifyPhoneHandler)
+	// Like above, the goals are appended with PATCH instead of POST.
+	handle(http.MethodPatch, "/v1/users/:id/goals", app.appendGoalsHandler)
+	handle(http.MethodGet, "/v1/users/:id/completeness", app.showCompletenessHandler)
+	handle(http.MethodGet, "/v1/users/:id/raw", app.requireRole(roleAdmin, app.showRawUserHandler))
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.createUserHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/users/:id", app.showUserHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/users/:id", app.updateUserHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/users/:id", app.deleteUserHandler)
+	handle(http.MethodGet, "/v1/exports/users", app.requireRole(roleAdmin, app.exportUsersHandler))
+	handle(http.MethodPost, "/v1/imports/users", app.requireRole(roleAdmin, app.importUsersHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	return app.metrics(app.recoverPanic(app.rateLimit(router)))
+	return router
 }
@@ -0,0 +1,80 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, _ := newTestApplication(t)
+	router := app.router()
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/v1"},
+		{http.MethodGet, "/v1/healthcheck"},
+		{http.MethodGet, "/v1/users"},
+		{http.MethodPost, "/v1/users"},
+		{http.MethodPost, "/v1/users/batch"},
+		{http.MethodPost, "/v1/users/batch/insert"},
+		{http.MethodGet, "/v1/users/" + id},
+		{http.MethodHead, "/v1/users/" + id},
+		{http.MethodPut, "/v1/users/" + id},
+		{http.MethodPatch, "/v1/users/" + id},
+		{http.MethodDelete, "/v1/users/" + id},
+		{http.MethodPut, "/v1/users/" + id + "/verification"},
+		{http.MethodPut, "/v1/users/" + id + "/phone-verification"},
+		{http.MethodPut, "/v1/users/" + id + "/phone"},
+		{http.MethodPatch, "/v1/users/" + id + "/goals"},
+		{http.MethodGet, "/v1/users/" + id + "/completeness"},
+		{http.MethodGet, "/v1/users/" + id + "/raw"},
+		{http.MethodGet, "/v1/exports/users"},
+		{http.MethodPost, "/v1/imports/users"},
+		{http.MethodGet, "/debug/vars"},
+	}
+
+	for _, route := range routes {
+		handle, _, _ := router.Lookup(route.method, route.path)
+		require.NotNil(t, handle, "%s %s is not registered", route.method, route.path)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.config.headers.security = []string{"X-Content-Type-Options"}
+
+	// The handler can be assembled more than once, as its metrics are only
+	// published once.
+	app.routes()
+	handler := app.routes()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/healthcheck", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), `"status":"available"`)
+	require.NotEmpty(t, rr.Header().Get("X-Request-ID"))
+	require.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+}
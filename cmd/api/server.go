@@ -17,27 +17,100 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 	"user-service.mykapital.io/internal/jsonlog"
 )
 
-func (app *application) serve(logger *jsonlog.Logger) error {
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.port),
-		Handler:      app.routes(),
-		ErrorLog:     log.New(logger, "", 0),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+// writeTimeout is the time the server has to write the response of a
+// request. The routes given a longer timeout extend it, see
+// application.timeout.
+const writeTimeout = 30 * time.Second
+
+// writeTimeoutMargin is the time left to write the response of a route
+// once its timeout is reached.
+const writeTimeoutMargin = 5 * time.Second
+
+// server configures the HTTP server of the handler.
+func (app *application) server(handler http.Handler, logger *jsonlog.Logger) *http.Server {
+	return &http.Server{
+		Addr:           fmt.Sprintf(":%d", app.config.port),
+		Handler:        handler,
+		ErrorLog:       log.New(logger, "", 0),
+		IdleTimeout:    time.Minute,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   writeTimeout,
+		MaxHeaderBytes: app.config.headers.maxBytes,
+	}
+}
+
+// tlsCipherSuites are the cipher suites allowed with TLS 1.2: only AEAD
+// suites with forward secrecy. The suites of TLS 1.3 are not configurable,
+// and are all secure.
+var tlsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// tlsVersions maps the accepted values of -tls-min-version to their
+// version.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion returns the TLS version of the value of
+// -tls-min-version. Versions older than 1.2 are refused.
+func parseTLSVersion(value string) (uint16, error) {
+	version, ok := tlsVersions[value]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q, must be 1.2 or 1.3", value)
+	}
+
+	return version, nil
+}
+
+// tlsConfig returns the TLS configuration of the server.
+func (app *application) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       app.config.tls.minVersion,
+		CipherSuites:     tlsCipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
 	}
+}
+
+// serve serves the API over HTTP.
+func (app *application) serve(logger *jsonlog.Logger) error {
+	return app.run(app.server(app.routes(), logger), func(srv *http.Server) error {
+		return srv.ListenAndServe()
+	})
+}
+
+// serveTLS serves the API over HTTPS, with the configured certificate.
+func (app *application) serveTLS(logger *jsonlog.Logger) error {
+	srv := app.server(app.routes(), logger)
+	srv.TLSConfig = app.tlsConfig()
 
+	return app.run(srv, func(srv *http.Server) error {
+		return srv.ListenAndServeTLS(app.config.tls.certFile, app.config.tls.keyFile)
+	})
+}
+
+// run starts the server with listen, and shuts it down gracefully on
+// SIGINT or SIGTERM.
+func (app *application) run(srv *http.Server, listen func(*http.Server) error) error {
 	shutdownError := make(chan error)
 
 	go func() {
@@ -52,15 +125,27 @@ func (app *application) serve(logger *jsonlog.Logger) error {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		shutdownError <- srv.Shutdown(ctx)
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+
+		app.logger.PrintInfo("completing background tasks", map[string]string{
+			"addr": srv.Addr,
+		})
+
+		app.wg.Wait()
+		shutdownError <- nil
 	}()
 
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.config.env,
+		"tls":  strconv.FormatBool(srv.TLSConfig != nil),
 	})
 
-	err := srv.ListenAndServe()
+	err := listen(srv)
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
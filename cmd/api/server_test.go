@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfig(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected uint16
+		valid    bool
+	}{
+		`TLS 1.2`: {value: "1.2", expected: tls.VersionTLS12, valid: true},
+		`TLS 1.3`: {value: "1.3", expected: tls.VersionTLS13, valid: true},
+		`TLS 1.0`: {value: "1.0", valid: false},
+		`unknown`: {value: "latest", valid: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, err := parseTLSVersion(tt.value)
+			if !tt.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			app, _ := newTestApplication(t)
+			app.config.tls.minVersion = version
+			cfg := app.tlsConfig()
+
+			require.Equal(t, tt.expected, cfg.MinVersion)
+			for _, suite := range tls.InsecureCipherSuites() {
+				require.NotContains(t, cfg.CipherSuites, suite.ID, "insecure suite %s", suite.Name)
+			}
+			// Without forward secrecy, RSA key exchanges are weak too.
+			for _, id := range cfg.CipherSuites {
+				require.Contains(t, tls.CipherSuiteName(id), "ECDHE")
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+)
+
+// flushEvery is the number of users written between two flushes of a
+// streamed list.
+const flushEvery = 50
+
+// userStream writes a list of users as a JSON object, one user at a time,
+// instead of buffering the whole list. The list is followed by its
+// pagination:
+//
+//	{"users":[...],"page_size":20,"next_cursor":"..."}
+//
+// The response is only started with the first user, so the errors
+// happening before it can still be reported with an error status.
+type userStream struct {
+	w       http.ResponseWriter
+	buf     *bufio.Writer
+	started bool
+	count   int
+}
+
+func newUserStream(w http.ResponseWriter) *userStream {
+	return &userStream{w: w, buf: bufio.NewWriter(w)}
+}
+
+// start writes the headers and the opening of the list.
+func (s *userStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	s.w.Header().Set("Content-Type", "application/json")
+	s.w.WriteHeader(http.StatusOK)
+	s.buf.WriteString(`{"` + pluralName("user") + `":[`)
+}
+
+// write appends a user to the list.
+func (s *userStream) write(user interface{}) error {
+	js, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	s.start()
+	if s.count > 0 {
+		s.buf.WriteByte(',')
+	}
+	s.buf.Write(js)
+
+	s.count++
+	if s.count%flushEvery == 0 {
+		return s.flush()
+	}
+
+	return nil
+}
+
+// truncatedMessage tells the client a list was truncated. The cause of
+// the truncation is logged instead, as it may hold internal details.
+const truncatedMessage = "the server encountered a problem and could not complete the list"
+
+// close closes the list with its pagination, or with truncatedMessage when
+// the list is truncated.
+func (s *userStream) close(p pagination, truncated bool) error {
+	s.start()
+
+	var tail []byte
+	var err error
+	if truncated {
+		tail, err = json.Marshal(map[string]string{"error": truncatedMessage})
+	} else {
+		tail, err = json.Marshal(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The fields of the tail object follow the list.
+	s.buf.WriteString("],")
+	s.buf.Write(tail[1:])
+	s.buf.WriteString("\n")
+
+	return s.flush()
+}
+
+// flush sends the buffered users to the client.
+func (s *userStream) flush() error {
+	err := s.buf.Flush()
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return err
+}
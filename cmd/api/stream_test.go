@@ -0,0 +1,253 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/stretchr/testify/require"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+// listResponse is a streamed list of users.
+type listResponse struct {
+	Users      []*data.User `json:"users"`
+	PageSize   int          `json:"page_size"`
+	NextCursor *string      `json:"next_cursor"`
+	Total      *int64       `json:"total"`
+	Error      string       `json:"error"`
+}
+
+func listUsers(t *testing.T, app *application, query string) (*httptest.ResponseRecorder, listResponse) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	app.listUsersHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/users"+query, nil))
+
+	var response listResponse
+	if rr.Code == http.StatusOK {
+		require.True(t, json.Valid(rr.Body.Bytes()), "malformed list: %s", rr.Body)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	}
+
+	return rr, response
+}
+
+func TestListUsersHandlerPages(t *testing.T) {
+	app, fake := newTestApplication(t)
+	for i := 0; i < 5; i++ {
+		seedUsers(t, fake, &data.User{ID: fmt.Sprintf("00000000-0000-0000-0000-%012d", i), FirstName: "John"})
+	}
+
+	var ids []string
+	query := "?page_size=2&total=true"
+	for pages := 1; ; pages++ {
+		rr, response := listUsers(t, app, query)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Empty(t, response.Error)
+		require.Equal(t, 2, response.PageSize)
+		require.NotNil(t, response.Total)
+		require.Equal(t, int64(5), *response.Total)
+
+		for _, usr := range response.Users {
+			ids = append(ids, usr.ID)
+		}
+		if response.NextCursor == nil {
+			require.Equal(t, 3, pages)
+			break
+		}
+		query = "?page_size=2&total=true&cursor=" + *response.NextCursor
+	}
+
+	require.Len(t, ids, 5)
+	require.Equal(t, "00000000-0000-0000-0000-000000000004", ids[4])
+}
+
+func TestListUsersHandlerEmpty(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	rr, _ := listUsers(t, app, "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, `{"users":[],"page_size":20,"next_cursor":null}`, rr.Body.String())
+}
+
+func TestListUsersHandlerInvalidInput(t *testing.T) {
+	app, _ := newTestApplication(t)
+
+	rr, _ := listUsers(t, app, "?cursor=not-a-cursor")
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr, _ = listUsers(t, app, "?page_size=0")
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr, _ = listUsers(t, app, "?page_size=ten")
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// interruptedScan returns a single item per page, and fails after the
+// given number of pages.
+type interruptedScan struct {
+	*testsupport.FakeDynamoDB
+	mu    sync.Mutex
+	pages int
+}
+
+func (s *interruptedScan) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	s.mu.Lock()
+	s.pages--
+	failed := s.pages < 0
+	s.mu.Unlock()
+
+	if failed {
+		return nil, errors.New("connection reset")
+	}
+
+	params.Limit = new(int32)
+	*params.Limit = 1
+	return s.FakeDynamoDB.Scan(ctx, params, optFns...)
+}
+
+func TestListUsersHandlerEmail(t *testing.T) {
+	app, fake := newTestApplication(t)
+	seedUsers(t, fake,
+		&data.User{ID: "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", Email: "john.doe@example.com", FirstName: "John", Version: 2},
+		&data.User{ID: "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22", Email: "jane.doe@example.com", FirstName: "Jane", Version: 1},
+	)
+
+	rr, _ := listUsers(t, app, "?email=john.doe@example.com")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, `"2"`, rr.Header().Get("ETag"))
+	var response struct {
+		User data.User `json:"user"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Equal(t, "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", response.User.ID)
+
+	rr, _ = listUsers(t, app, "?email=nobody@example.com")
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr, _ = listUsers(t, app, "?email=not-an-email")
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestListUsersHandlerInterrupted(t *testing.T) {
+	tests := map[string]struct {
+		pages         int
+		expectedCode  int
+		expectedUsers int
+	}{
+		`interrupted before the first user`: {pages: 0, expectedCode: http.StatusInternalServerError},
+		`interrupted mid-stream`:            {pages: 1, expectedCode: http.StatusOK, expectedUsers: 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.models.Users.DynamoDbClient = &interruptedScan{FakeDynamoDB: fake, pages: tt.pages}
+			seedUsers(t, fake,
+				&data.User{ID: "00000000-0000-0000-0000-000000000001"},
+				&data.User{ID: "00000000-0000-0000-0000-000000000002"},
+			)
+
+			rr, response := listUsers(t, app, "?page_size=2")
+			require.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+
+			require.Len(t, response.Users, tt.expectedUsers)
+			require.Nil(t, response.NextCursor)
+			require.Equal(t, truncatedMessage, response.Error)
+		})
+	}
+}
+
+func TestListUsersHandlerQuery(t *testing.T) {
+	app, fake := newTestApplication(t)
+	app.config.sortableAttributes = []string{"first_name"}
+	app.config.filterableAttributes = []string{"country_code_alpha_2"}
+	seedUsers(t, fake,
+		&data.User{ID: "00000000-0000-0000-0000-000000000001", FirstName: "Alice", CountryCodeAlpha2: "CA"},
+		&data.User{ID: "00000000-0000-0000-0000-000000000002", FirstName: "Carol", CountryCodeAlpha2: "CA"},
+		&data.User{ID: "00000000-0000-0000-0000-000000000003", FirstName: "Bob", CountryCodeAlpha2: "US"},
+	)
+
+	names := func(users []*data.User) []string {
+		var names []string
+		for _, usr := range users {
+			names = append(names, usr.FirstName)
+		}
+		return names
+	}
+
+	rr, response := listUsers(t, app, "?sort=-first_name")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, []string{"Carol", "Bob", "Alice"}, names(response.Users))
+
+	rr, response = listUsers(t, app, "?sort=first_name&filter=country_code_alpha_2:CA")
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, []string{"Alice", "Carol"}, names(response.Users))
+
+	for _, query := range []string{
+		"?sort=last_name",
+		"?sort=-",
+		"?filter=email:alice@example.com",
+		"?filter=country_code_alpha_2",
+	} {
+		rr, _ = listUsers(t, app, query)
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code, query)
+	}
+}
+
+func TestListUsersHandlerIDs(t *testing.T) {
+	const (
+		johnID    = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+		janeID    = "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22"
+		missingID = "9f3e6d1a-2b4c-4d8e-b7f1-6a5c3e2d1b33"
+	)
+	app, fake := newTestApplication(t)
+	seedUsers(t, fake,
+		&data.User{ID: johnID, FirstName: "John"},
+		&data.User{ID: janeID, FirstName: "Jane"},
+	)
+
+	rr, _ := listUsers(t, app, "?ids="+janeID+","+missingID+","+johnID)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Users   []data.User `json:"users"`
+		Missing []string    `json:"missing"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	require.Len(t, response.Users, 2)
+	require.Equal(t, janeID, response.Users[0].ID)
+	require.Equal(t, johnID, response.Users[1].ID)
+	require.Equal(t, []string{missingID}, response.Missing)
+
+	for _, query := range []string{"?ids=", "?ids=not-a-uuid", "?ids=" + johnID + "," + johnID} {
+		rr, _ = listUsers(t, app, query)
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code, query)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/julienschmidt/httprouter"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/jsonlog"
+	"user-service.mykapital.io/internal/testsupport"
+	"user-service.mykapital.io/internal/testsupport/usertest"
+	"user-service.mykapital.io/internal/user"
+)
+
+// newTestApplication creates an application backed by a fake DynamoDB table.
+func newTestApplication(t *testing.T) (*application, *testsupport.FakeDynamoDB) {
+	t.Helper()
+
+	fake := testsupport.NewFakeDynamoDB()
+	app := &application{
+		logger:     jsonlog.New(io.Discard, jsonlog.LevelOff),
+		models:     data.Models{Users: user.Model{DynamoDbClient: fake, TableName: "User", IndexName: "email"}},
+		rules:      user.DefaultRules,
+		notifier:   &fakeNotifier{},
+		sms:        &fakeNotifier{},
+		phoneSends: newPhoneCooldown(),
+	}
+
+	return app, fake
+}
+
+// validUser returns a valid user of Ontario named John, with the given id,
+// and then applies the options in order.
+func validUser(id string, opts ...usertest.Option) *data.User {
+	base := func(usr *user.User) {
+		usr.ID = id
+		usr.FirstName = "John"
+	}
+	return usertest.RandomUser(append([]usertest.Option{base, usertest.WithCountry("CA", "ON")}, opts...)...)
+}
+
+// seedUsers stores users directly in the fake table.
+func seedUsers(t *testing.T, fake *testsupport.FakeDynamoDB, users ...*data.User) {
+	t.Helper()
+
+	for _, usr := range users {
+		item, err := attributevalue.MarshalMap(usr)
+		if err != nil {
+			t.Fatalf("failed to marshal user %s: %v", usr.ID, err)
+		}
+		fake.Put(item)
+	}
+}
+
+// withParams returns a copy of the request carrying the router parameters,
+// given as key-value pairs.
+func withParams(r *http.Request, keyValues ...string) *http.Request {
+	var params httprouter.Params
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		params = append(params, httprouter.Param{Key: keyValues[i], Value: keyValues[i+1]})
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+}
+
+// message is a notification sent through fakeNotifier.
+type message struct {
+	to, subject, body string
+}
+
+// fakeNotifier records the notifications instead of sending them.
+type fakeNotifier struct {
+	mu       sync.Mutex
+	messages []message
+}
+
+func (n *fakeNotifier) Send(_ context.Context, to, subject, body string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.messages = append(n.messages, message{to: to, subject: subject, body: body})
+	return nil
+}
+
+// sent returns the notifications sent so far.
+func (n *fakeNotifier) sent() []message {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return append([]message(nil), n.messages...)
+}
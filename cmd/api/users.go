@@ -16,24 +16,31 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/google/uuid"
 	"net/http"
-	"reflect"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
 	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
 	"user-service.mykapital.io/internal/validator"
 )
 
 func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Email             string `json:"email"`
-		FirstName         string `json:"first_name"`
-		LastName          string `json:"last_name"`
-		ProvinceCode      string `json:"province_code"`
-		CountryCodeAlpha2 string `json:"country_code_alpha_2"`
+		Email                  string `json:"email"`
+		FirstName              string `json:"first_name"`
+		LastName               string `json:"last_name"`
+		ProvinceCode           string `json:"province_code"`
+		CountryCodeAlpha2      string `json:"country_code_alpha_2"`
+		AdministrativeDivision string `json:"administrative_division"`
+		Currency               string `json:"currency"`
+		DateOfBirth            string `json:"date_of_birth"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -49,41 +56,79 @@ func (app *application) createUserHandler(w http.ResponseWriter, r *http.Request
 		LastName:               input.LastName,
 		ProvinceCode:           input.ProvinceCode,
 		CountryCodeAlpha2:      input.CountryCodeAlpha2,
-		AdministrativeDivision: "province",
-		Currency:               "CAD",
-		CreatedAt:              time.Now().Format("2006-01-02"),
+		AdministrativeDivision: input.AdministrativeDivision,
+		Currency:               input.Currency,
+		DateOfBirth:            input.DateOfBirth,
+		CreatedAt:              app.now().Format("2006-01-02"),
 		Version:                1,
 	}
 
+	data.Normalize(user)
+
 	v := validator.New()
-	if data.ValidateUser(v, user); !v.Valid() {
+	app.rules.FillDefaults(v, user)
+	if app.rules.ValidateUser(v, user); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	token, verification, err := data.NewVerification(app.now())
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+	user.Verification = verification
+
+	err = app.models.Users.Create(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPendingVerification):
+			app.pendingVerificationResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateUser):
+			app.duplicateUserResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.sendVerificationEmail(user, token)
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/users/%s", user.ID))
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, headers)
+	env := resourceEnvelope("user", user)
+	if len(v.Warnings) > 0 {
+		env["warnings"] = v.Warnings
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// etag returns the entity tag of a user at the given version.
+func etag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
 func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := uuid.Parse(app.readParam(r, "id"))
-	if err != nil {
-		app.notFoundResponse(w, r)
+	id, ok := app.readIDParam(w, r)
+	if !ok {
 		return
 	}
 
-	user, err := app.models.Users.Get(id.String())
+	users := app.users(r)
+	// Only the admins can see the soft-deleted users.
+	if r.URL.Query().Get("include_deleted") == "true" && app.contextGetCaller(r).Role == roleAdmin {
+		users.IncludeDeleted = true
+	}
+
+	user, err := users.Get(r.Context(), id.String())
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -94,20 +139,33 @@ func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	// The body of HEAD requests is discarded by the server, but its
+	// headers are kept.
+	headers := make(http.Header)
+	headers.Set("ETag", etag(user.Version))
+
+	// The age is derived from the date of birth, so it is never stored.
+	env := resourceEnvelope("user", app.shapeUser(r, user))
+	if age, ok := user.Age(); ok {
+		env["age"] = age
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := uuid.Parse(app.readParam(r, "id"))
-	if err != nil {
-		app.notFoundResponse(w, r)
+// showUserByEmail shows the user registered with the email, which
+// is looked up through the email index.
+func (app *application) showUserByEmail(w http.ResponseWriter, r *http.Request, email string) {
+	v := validator.New()
+	if v.Check(validator.Matches(email, validator.EmailRX), "email", "must be valid"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	user, err := app.models.Users.Get(id.String())
+	user, err := app.users(r).GetByEmail(r.Context(), email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -118,54 +176,505 @@ func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	headers := make(http.Header)
+	headers.Set("ETag", etag(user.Version))
+
+	err = app.writeJSON(w, http.StatusOK, resourceEnvelope("user", app.shapeUser(r, user)), headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// Bounds of the page size of a list of users.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 1000
+)
+
+// listUsersHandler streams a page of users, which continues from the
+// cursor of the previous page. The approximate total of users is given
+// with ?total=true. With ?email=, the user registered with the email is
+// shown instead.
+//
+// The users may be filtered and sorted as read by readListQuery. The scan
+// of the table has no order, so the users are sorted within their page.
+//
+// With ?ids=a,b,c, the users of the ids are fetched instead, as with
+// POST /v1/users/batch, and the other parameters don't apply.
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	if qs.Has("email") {
+		app.showUserByEmail(w, r, qs.Get("email"))
+		return
+	}
+
+	if qs.Has("ids") {
+		var ids []string
+		if s := qs.Get("ids"); s != "" {
+			ids = strings.Split(s, ",")
+		}
+		app.writeUsersBatch(w, r, ids)
+		return
+	}
+
+	// A page size which isn't an integer can't be parsed, while a page size
+	// out of bounds fails the validation.
+	pageSize := defaultPageSize
+	if s := qs.Get("page_size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("page_size must be an integer value"))
+			return
+		}
+		pageSize = n
+	}
+
+	v := validator.New()
+	v.Check(pageSize > 0, "page_size", "must be greater than zero")
+	v.Check(pageSize <= maxPageSize, "page_size", fmt.Sprintf("must be a maximum of %d", maxPageSize))
+	query := app.readListQuery(qs, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	startKey, err := decodeCursor(qs.Get("cursor"))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var total *int64
+	if qs.Get("total") == "true" {
+		count, err := app.approximateTotal(r.Context())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		total = &count
+	}
+
+	stream := newUserStream(w)
+	var sorted []*data.User
+	nextKey, err := app.models.Users.ListFunc(r.Context(), query.filter(), pageSize, startKey, func(usr *data.User) error {
+		if query.sort != "" {
+			sorted = append(sorted, usr)
+			return nil
+		}
+		return stream.write(app.shapeUser(r, usr))
+	})
+
+	// The users which can't be decoded are left out of the list.
+	var corrupt *user.CorruptItemsError
+	if errors.As(err, &corrupt) {
+		app.logError(r, err)
+		err = nil
+	}
+
+	if err == nil && query.sort != "" {
+		query.sortUsers(sorted)
+		for _, usr := range sorted {
+			if err = stream.write(app.shapeUser(r, usr)); err != nil {
+				break
+			}
+		}
+	}
+
+	var p pagination
+	if err == nil {
+		p, err = newPagination(pageSize, nextKey)
+		p.Total = total
+	}
+	truncated := err != nil
+	if truncated {
+		if !stream.started {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// The status is already sent, so the list is truncated instead,
+		// and the cause is only logged.
+		app.logError(r, err)
+	}
+
+	if err = stream.close(p, truncated); err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) showUsersBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var ids []string
+
+	err := app.readJSON(w, r, &ids)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.writeUsersBatch(w, r, ids)
+}
+
+// writeUsersBatch responds with the users of the ids, in their order, and
+// the ids which have no user or couldn't be fetched.
+func (app *application) writeUsersBatch(w http.ResponseWriter, r *http.Request, ids []string) {
+	v := validator.New()
+	v.Check(len(ids) > 0, "ids", "must be provided")
+	v.Check(len(ids) <= user.MaxBatchGetKeys, "ids", fmt.Sprintf("must not contain more than %d ids", user.MaxBatchGetKeys))
+	v.Check(validator.Unique(ids), "ids", "must not contain duplicate ids")
+	for i, id := range ids {
+		_, err := uuid.Parse(id)
+		v.Check(err == nil, fmt.Sprintf("id_%d", i+1), "must be a valid id")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The users which couldn't be fetched are reported as unavailable,
+	// so the client can request them again.
+	found, err := app.users(r).GetBatch(r.Context(), ids)
+	unavailable := make([]string, 0)
+	var batchErr *data.BatchError
+	switch {
+	case errors.As(err, &batchErr):
+		app.logError(r, err)
+		unavailable = batchErr.IDs
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	users := make([]*data.User, 0, len(found))
+	fetched := make(map[string]bool, len(found))
+	for _, usr := range found {
+		users = append(users, app.shapeUser(r, usr))
+		fetched[usr.ID] = true
+	}
+	missing := make([]string, 0)
+	for _, id := range ids {
+		if !fetched[id] && !validator.In(id, unavailable...) {
+			missing = append(missing, id)
+		}
+	}
+
+	env := resourceEnvelope("user", users)
+	env["missing"] = missing
+	env["unavailable"] = unavailable
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// maxBatchInsertUsers is the maximum number of users inserted by a single
+// batch insert.
+const maxBatchInsertUsers = 100
+
+// insertUsersBatchHandler registers the users of a JSON array all
+// together, for bulk onboarding.
+//
+// The users are validated like in createUserHandler, and the whole batch
+// is rejected when one of them is invalid, with the errors of the nth user
+// prefixed by user_<n>. The emails must be unique within the batch and
+// must not be registered to another user, otherwise the whole batch is
+// rejected too. The users which couldn't be inserted are reported as
+// unprocessed in a 207 Multi-Status response, so the client can insert
+// them again.
+func (app *application) insertUsersBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var input []struct {
+		Email                  string `json:"email"`
+		FirstName              string `json:"first_name"`
+		LastName               string `json:"last_name"`
+		ProvinceCode           string `json:"province_code"`
+		CountryCodeAlpha2      string `json:"country_code_alpha_2"`
+		AdministrativeDivision string `json:"administrative_division"`
+		Currency               string `json:"currency"`
+		DateOfBirth            string `json:"date_of_birth"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input) > 0, "users", "must be provided")
+	v.Check(len(input) <= maxBatchInsertUsers, "users", fmt.Sprintf("must not contain more than %d users", maxBatchInsertUsers))
+
+	users := make([]*data.User, 0, len(input))
+	emails := make([]string, 0, len(input))
+	createdAt := app.now().Format("2006-01-02")
+	for i, in := range input {
+		usr := &data.User{
+			ID:                     uuid.New().String(),
+			Email:                  in.Email,
+			FirstName:              in.FirstName,
+			LastName:               in.LastName,
+			ProvinceCode:           in.ProvinceCode,
+			CountryCodeAlpha2:      in.CountryCodeAlpha2,
+			AdministrativeDivision: in.AdministrativeDivision,
+			Currency:               in.Currency,
+			DateOfBirth:            in.DateOfBirth,
+			CreatedAt:              createdAt,
+			Version:                1,
+		}
+		data.Normalize(usr)
+
+		userV := validator.New()
+		app.rules.FillDefaults(userV, usr)
+		app.rules.ValidateUser(userV, usr)
+		for field, message := range userV.Errors {
+			v.AddError(fmt.Sprintf("user_%d_%s", i+1, field), message)
+		}
+
+		users = append(users, usr)
+		emails = append(emails, usr.Email)
+	}
+	v.Check(validator.Unique(emails), "users", "must not contain duplicate emails")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.InsertBatch(r.Context(), users)
+	unprocessed := make([]string, 0)
+	var batchErr *data.BatchError
+	var duplicateErr *data.DuplicateEmailsError
+	switch {
+	case errors.As(err, &duplicateErr):
+		for i, usr := range users {
+			if validator.In(usr.ID, duplicateErr.IDs...) {
+				v.AddError(fmt.Sprintf("user_%d_email", i+1), "a user with this email address already exists")
+			}
+		}
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case errors.As(err, &batchErr):
+		app.logError(r, err)
+		unprocessed = batchErr.IDs
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	inserted := make([]*data.User, 0, len(users))
+	for _, usr := range users {
+		if !validator.In(usr.ID, unprocessed...) {
+			inserted = append(inserted, app.shapeUser(r, usr))
+		}
+	}
+
+	status := http.StatusCreated
+	if len(unprocessed) > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	env := resourceEnvelope("user", inserted)
+	env["unprocessed"] = unprocessed
+	err = app.writeJSON(w, status, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// filterMeta enforces the allowed meta namespaces on the meta fields
+// written to the user, and logs the meta fields dropped.
+func (app *application) filterMeta(v *validator.Validator, id string, meta []user.MetaField) []user.MetaField {
+	kept, dropped := app.rules.FilterMeta(v, meta)
+	if len(dropped) > 0 {
+		fields := make([]string, 0, len(dropped))
+		for _, field := range dropped {
+			fields = append(fields, field.Namespace+"."+field.Key)
+		}
+		app.logger.PrintInfo("meta fields dropped", map[string]string{
+			"user_id": id,
+			"meta":    strings.Join(fields, ","),
+		})
+	}
+
+	return kept
+}
+
+// serverAttributes are the attributes set by the server, which are left
+// out of the updates sent by the clients. The activation and the phone are
+// only set through their verification flows.
+var serverAttributes = []string{
+	"userID", "createdAt", "deletedAt",
+	"activated", "verification", "phone", "phoneVerified", "phoneVerification",
+}
+
+// updatedUser returns the user as it is once updated with the new
+// attributes, leaving the stored user as is.
+func updatedUser(old *data.User, newAttributes map[string]interface{}) (*data.User, error) {
+	item, err := attributevalue.MarshalMap(old)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := attributevalue.MarshalMap(newAttributes)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range attributes {
+		item[k] = v
+	}
+
+	var usr data.User
+	if err = attributevalue.UnmarshalMap(item, &usr); err != nil {
+		return nil, err
+	}
+	return &usr, nil
+}
+
+// invalidUpdateError holds the validation errors of a user once updated.
+type invalidUpdateError map[string]string
+
+func (e invalidUpdateError) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return "invalid update of " + strings.Join(fields, ", ")
+}
+
+func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.readIDParam(w, r)
+	if !ok {
+		return
+	}
+
 	input := data.User{}
-	err = app.readJSON(w, r, &input)
+	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	newAttributes := make(map[string]interface{})
-	val := reflect.ValueOf(input)
-	typ := reflect.TypeOf(input)
-	for i := 0; i < typ.NumField(); i++ {
-		field := typ.Field(i)
-		fieldValue := val.Field(i)
-		if !fieldValue.IsZero() {
-			fieldName := strings.ToLower(field.Name[:1]) + field.Name[1:]
-			newAttributes[fieldName] = fieldValue.Interface()
+	// The email and the codes are stored normalized, like on creation, so
+	// the email is checked and found in its normalized form. The fields
+	// left out of the update stay empty.
+	data.Normalize(&input)
+
+	if input.Meta != nil {
+		v := validator.New()
+		if input.Meta = app.filterMeta(v, id.String(), input.Meta); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	}
+
+	newAttributes := data.BuildUpdateAttributes(input, data.UpdateOptions{Exclude: serverAttributes})
+
+	// An update without any attribute would only bump the version.
+	if len(newAttributes) == 0 {
+		if app.config.emptyUpdate == "noop" {
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
+		app.badRequestResponse(w, r, errors.New("no updatable fields provided"))
+		return
+	}
+
+	if limit := app.config.maxUpdateAttributes; limit > 0 && len(newAttributes) > limit {
+		v := validator.New()
+		v.AddError("body", fmt.Sprintf("must not update more than %d attributes", limit))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	attributes, err := app.models.Users.Update(user, newAttributes)
+	// Identical concurrent updates of the same user share a single
+	// read-modify-write, instead of conflicting with each other.
+	outcome, err := app.dedupeUpdate(r.Context(), id.String(), newAttributes, func(ctx context.Context) (*updateOutcome, error) {
+		old, err := app.models.Users.Get(ctx, id.String())
+		if err != nil {
+			return nil, err
+		}
+
+		// The updated user must stay valid, and its immutable fields may
+		// only be given their current value.
+		usr, err := updatedUser(old, newAttributes)
+		if err != nil {
+			return nil, err
+		}
+		v := validator.New()
+		app.rules.ValidateUser(v, usr)
+		for _, field := range app.changedImmutableFields(old, usr) {
+			v.AddError(field, "cannot be changed")
+		}
+		if !v.Valid() {
+			return nil, invalidUpdateError(v.Errors)
+		}
+
+		attributes, err := app.models.Users.Update(ctx, old, newAttributes)
+		if err != nil {
+			return nil, err
+		}
+
+		// The attributes returned by the update are the ones stored, once
+		// transformed by the model. The update is conditioned on the
+		// version of old, so the user is old along with them, without
+		// being read again.
+		usr, err = updatedUser(usr, attributes)
+		if err != nil {
+			return nil, err
+		}
+
+		return &updateOutcome{user: usr, diff: diffUsers(old, usr)}, nil
+	})
+	var invalid invalidUpdateError
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail), errors.Is(err, data.ErrPendingVerification):
+			v := validator.New()
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &invalid):
+			app.failedValidationResponse(w, r, invalid)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"user": attributes}, nil)
+	diff, err := json.Marshal(app.shapeDiff(r, outcome.diff))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.logger.PrintInfo("user updated", map[string]string{
+		"user_id": id.String(),
+		"diff":    string(diff),
+	})
+
+	env := resourceEnvelope("user", app.shapeUser(r, outcome.user))
+	if r.URL.Query().Get("return") == "diff" {
+		env["diff"] = app.shapeDiff(r, outcome.diff)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := uuid.Parse(app.readParam(r, "id"))
-	if err != nil {
-		app.notFoundResponse(w, r)
+	id, ok := app.readIDParam(w, r)
+	if !ok {
 		return
 	}
 
-	err = app.models.Users.Delete(&data.User{ID: id.String()})
+	err := app.models.Users.Delete(r.Context(), &data.User{ID: id.String()})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
@@ -0,0 +1,927 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/singleflight"
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/testsupport"
+	"user-service.mykapital.io/internal/testsupport/usertest"
+	"user-service.mykapital.io/internal/user"
+)
+
+func TestCreateUserHandlerWarnings(t *testing.T) {
+	tests := map[string]struct {
+		body             string
+		expectedWarnings map[string]string
+	}{
+		`missing last name`: {
+			body:             `{"email":"john.doe@example.com","first_name":"John","province_code":"ON","country_code_alpha_2":"CA"}`,
+			expectedWarnings: map[string]string{"last_name": "should be provided"},
+		},
+		`complete user`: {
+			body:             `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`,
+			expectedWarnings: nil,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			app.createUserHandler(rr, req)
+
+			require.Equal(t, http.StatusCreated, rr.Code)
+			require.Equal(t, 1, fake.CallCount("PutItem"))
+
+			var response struct {
+				Warnings map[string]string `json:"warnings"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Equal(t, tt.expectedWarnings, response.Warnings)
+		})
+	}
+}
+
+func TestShowUsersBatchHandler(t *testing.T) {
+	const (
+		johnID    = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+		janeID    = "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22"
+		missingID = "9f3e6d1a-2b4c-4d8e-b7f1-6a5c3e2d1b33"
+	)
+
+	tests := map[string]struct {
+		body            string
+		expectedStatus  int
+		expectedUsers   []string
+		expectedMissing []string
+		expectedErrors  []string
+	}{
+		`found and missing ids`: {
+			body:            `["` + janeID + `","` + missingID + `","` + johnID + `"]`,
+			expectedStatus:  http.StatusOK,
+			expectedUsers:   []string{janeID, johnID},
+			expectedMissing: []string{missingID},
+		},
+		`malformed id`: {
+			body:           `["` + johnID + `","not-a-uuid"]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"id_2"},
+		},
+		`duplicate ids`: {
+			body:           `["` + johnID + `","` + johnID + `"]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"ids"},
+		},
+		`too many ids`: {
+			body:           `[` + strings.TrimSuffix(strings.Repeat(`"`+johnID+`",`, 101), ",") + `]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"ids"},
+		},
+		`no ids`: {
+			body:           `[]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"ids"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			seedUsers(t, fake,
+				&data.User{ID: johnID, FirstName: "John"},
+				&data.User{ID: janeID, FirstName: "Jane"},
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/batch", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+
+			app.showUsersBatchHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+
+			var response struct {
+				Users   []data.User       `json:"users"`
+				Missing []string          `json:"missing"`
+				Error   map[string]string `json:"error"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+
+			var users []string
+			for _, usr := range response.Users {
+				users = append(users, usr.ID)
+			}
+			require.Equal(t, tt.expectedUsers, users)
+			if tt.expectedMissing != nil {
+				require.Equal(t, tt.expectedMissing, response.Missing)
+			}
+			for _, key := range tt.expectedErrors {
+				require.Contains(t, response.Error, key)
+			}
+		})
+	}
+}
+
+// unprocessedWrites leaves the batch writes of the users with the email
+// unprocessed, as if they were throttled.
+type unprocessedWrites struct {
+	*testsupport.FakeDynamoDB
+	email string
+}
+
+func (t *unprocessedWrites) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	requests := make(map[string][]types.WriteRequest)
+	unprocessed := make(map[string][]types.WriteRequest)
+	for table, writes := range params.RequestItems {
+		for _, write := range writes {
+			if email, ok := write.PutRequest.Item["email"].(*types.AttributeValueMemberS); ok && email.Value == t.email {
+				unprocessed[table] = append(unprocessed[table], write)
+			} else {
+				requests[table] = append(requests[table], write)
+			}
+		}
+	}
+
+	out, err := t.FakeDynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{RequestItems: requests}, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	out.UnprocessedItems = unprocessed
+	return out, nil
+}
+
+func TestInsertUsersBatchHandler(t *testing.T) {
+	const (
+		john = `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+		jane = `{"email":"jane.doe@example.com","first_name":"Jane","last_name":"Doe","province_code":"QC","country_code_alpha_2":"CA"}`
+	)
+
+	tests := map[string]struct {
+		body                string
+		registeredEmail     string
+		unprocessedEmail    string
+		expectedStatus      int
+		expectedUsers       int
+		expectedUnprocessed int
+		expectedErrors      []string
+	}{
+		`inserted`: {
+			body:           `[` + john + `,` + jane + `]`,
+			expectedStatus: http.StatusCreated,
+			expectedUsers:  2,
+		},
+		`partially inserted`: {
+			body:                `[` + john + `,` + jane + `]`,
+			unprocessedEmail:    "jane.doe@example.com",
+			expectedStatus:      http.StatusMultiStatus,
+			expectedUsers:       1,
+			expectedUnprocessed: 1,
+		},
+		`invalid user`: {
+			body:           `[` + john + `,{"email":"jane","first_name":"Jane","province_code":"QC","country_code_alpha_2":"CA"}]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"user_2_email"},
+		},
+		`invalid currency`: {
+			body:           `[` + john + `,{"email":"jane.doe@example.com","first_name":"Jane","province_code":"QC","country_code_alpha_2":"CA","currency":"CADX"}]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"user_2_currency"},
+		},
+		`duplicate emails`: {
+			body:           `[` + john + `,` + john + `]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"users"},
+		},
+		`registered email`: {
+			body:            `[` + john + `,` + jane + `]`,
+			registeredEmail: "jane.doe@example.com",
+			expectedStatus:  http.StatusUnprocessableEntity,
+			expectedErrors:  []string{"user_2_email"},
+		},
+		`no users`: {
+			body:           `[]`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedErrors: []string{"users"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			if tt.unprocessedEmail != "" {
+				app.models.Users.DynamoDbClient = &unprocessedWrites{FakeDynamoDB: fake, email: tt.unprocessedEmail}
+			}
+			registered := 0
+			if tt.registeredEmail != "" {
+				seedUsers(t, fake, validUser("5b1f6a3e-2c4d-4e8f-9a7b-1c2d3e4f5a6b", usertest.WithEmail(tt.registeredEmail)))
+				registered = 1
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/users/batch/insert", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			app.insertUsersBatchHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code, rr.Body.String())
+
+			var response struct {
+				Users       []data.User       `json:"users"`
+				Unprocessed []string          `json:"unprocessed"`
+				Error       map[string]string `json:"error"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Len(t, response.Users, tt.expectedUsers)
+			require.Len(t, response.Unprocessed, tt.expectedUnprocessed)
+			require.Len(t, fake.Items, tt.expectedUsers+registered)
+			for _, key := range tt.expectedErrors {
+				require.Contains(t, response.Error, key)
+			}
+		})
+	}
+}
+
+// versionedTable fails every update but the first one with a version
+// conflict, as concurrent updates reading the same version would.
+type versionedTable struct {
+	*testsupport.FakeDynamoDB
+	mu      sync.Mutex
+	updates int
+}
+
+func (v *versionedTable) UpdateItem(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	v.mu.Lock()
+	v.updates++
+	first := v.updates == 1
+	v.mu.Unlock()
+
+	if !first {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	return &dynamodb.UpdateItemOutput{
+		Attributes: map[string]types.AttributeValue{"version": &types.AttributeValueMemberN{Value: "2"}},
+	}, nil
+}
+
+func TestUpdateUserHandlerDedupe(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	table := &versionedTable{FakeDynamoDB: fake}
+	app.models.Users.DynamoDbClient = table
+	app.updates = &singleflight.Group{}
+	seedUsers(t, fake, validUser(id))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{"Occupation":"Engineer"}`))
+			rr := httptest.NewRecorder()
+
+			app.updateUserHandler(rr, withParams(req, "id", id))
+			codes[i] = rr.Code
+		}(i)
+	}
+	wg.Wait()
+
+	require.Equal(t, []int{http.StatusOK, http.StatusOK}, codes)
+	require.Equal(t, 1, table.updates)
+}
+
+// contextTable fails the updates once their context is done.
+type contextTable struct {
+	*testsupport.FakeDynamoDB
+}
+
+func (c contextTable) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.FakeDynamoDB.UpdateItem(ctx, params, optFns...)
+}
+
+func TestUpdateUserHandlerDedupeDetached(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	app.models.Users.DynamoDbClient = contextTable{FakeDynamoDB: fake}
+	app.updates = &singleflight.Group{}
+	seedUsers(t, fake, validUser(id))
+
+	// The request starting the shared update is gone, the update must
+	// still complete for the requests sharing it.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{"Occupation":"Engineer"}`)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	app.updateUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	stored, err := app.models.Users.Get(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, "Engineer", stored.Occupation)
+}
+
+func TestUpdateUserHandlerConflict(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	// A concurrent update already took the version the handler reads.
+	app.models.Users.DynamoDbClient = &versionedTable{FakeDynamoDB: fake, updates: 1}
+	seedUsers(t, fake, validUser(id))
+
+	req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{"Occupation":"Engineer"}`))
+	rr := httptest.NewRecorder()
+
+	app.updateUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestShowUserHandlerHead(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	seedUsers(t, fake, &data.User{ID: id, FirstName: "John", Version: 3})
+
+	srv := httptest.NewServer(app.router())
+	defer srv.Close()
+
+	get, err := http.Get(srv.URL + "/v1/users/" + id)
+	require.NoError(t, err)
+	body, err := io.ReadAll(get.Body)
+	get.Body.Close()
+	require.NoError(t, err)
+
+	head, err := http.Head(srv.URL + "/v1/users/" + id)
+	require.NoError(t, err)
+	headBody, err := io.ReadAll(head.Body)
+	head.Body.Close()
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, head.StatusCode)
+	require.Empty(t, headBody)
+	require.Equal(t, `"3"`, head.Header.Get("ETag"))
+	require.Equal(t, get.Header.Get("ETag"), head.Header.Get("ETag"))
+	require.Equal(t, strconv.Itoa(len(body)), head.Header.Get("Content-Length"))
+
+	missing, err := http.Head(srv.URL + "/v1/users/5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22")
+	require.NoError(t, err)
+	missing.Body.Close()
+	require.Equal(t, http.StatusNotFound, missing.StatusCode)
+}
+
+func TestShowUserHandlerAge(t *testing.T) {
+	app, fake := newTestApplication(t)
+	usr := &data.User{ID: "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", FirstName: "John", DateOfBirth: "1990-01-15", Version: 1}
+	seedUsers(t, fake, usr, &data.User{ID: "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22", FirstName: "Jane", Version: 1})
+	expected, _ := usr.Age()
+
+	for id, age := range map[string]*int{usr.ID: &expected, "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22": nil} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil)
+		rr := httptest.NewRecorder()
+
+		app.showUserHandler(rr, withParams(req, "id", id))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var response struct {
+			Age *int `json:"age"`
+		}
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		require.Equal(t, age, response.Age)
+	}
+
+	item, ok := fake.Items[usr.ID]
+	require.True(t, ok)
+	require.NotContains(t, item, "age")
+}
+
+func TestShowUserHandlerMissing(t *testing.T) {
+	app, fake := newTestApplication(t)
+	seedUsers(t, fake, &data.User{ID: "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", FirstName: "John", Version: 1})
+
+	const id = "5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22"
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/"+id, nil)
+	rr := httptest.NewRecorder()
+
+	app.showUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestCreateUserHandlerCurrency(t *testing.T) {
+	tests := map[string]struct {
+		currency         string
+		expectedStatus   int
+		expectedCurrency string
+	}{
+		`given currency`:     {currency: "usd", expectedStatus: http.StatusCreated, expectedCurrency: "USD"},
+		`country currency`:   {currency: "", expectedStatus: http.StatusCreated, expectedCurrency: "CAD"},
+		`unknown currency`:   {currency: "XYZ", expectedStatus: http.StatusUnprocessableEntity},
+		`malformed currency`: {currency: "US", expectedStatus: http.StatusUnprocessableEntity},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+
+			body := `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA","currency":"` + tt.currency + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			app.createUserHandler(rr, req)
+
+			require.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus != http.StatusCreated {
+				return
+			}
+			var response struct {
+				User data.User `json:"user"`
+			}
+			require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+			require.Equal(t, tt.expectedCurrency, response.User.Currency)
+		})
+	}
+}
+
+func TestCreateUserHandlerClock(t *testing.T) {
+	app, _ := newTestApplication(t)
+	app.clock = func() time.Time { return time.Date(2023, 3, 1, 23, 30, 0, 0, time.UTC) }
+
+	body := `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	app.createUserHandler(rr, req)
+
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var response struct {
+		User data.User `json:"user"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Equal(t, "2023-03-01", response.User.CreatedAt)
+}
+
+func TestCreateUserHandlerExistingEmail(t *testing.T) {
+	const body = `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+
+	tests := map[string]struct {
+		activated bool
+		expected  int
+	}{
+		`pending verification`: {activated: false, expected: http.StatusConflict},
+		`activated user`:       {activated: true, expected: http.StatusUnprocessableEntity},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.models.Users.PendingWindow = 72 * time.Hour
+			seedUsers(t, fake, &data.User{
+				ID:        "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11",
+				Email:     "john.doe@example.com",
+				Activated: tt.activated,
+				CreatedAt: time.Now().Format("2006-01-02"),
+			})
+
+			rr := httptest.NewRecorder()
+			app.createUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+
+			require.Equal(t, tt.expected, rr.Code)
+			require.Equal(t, 0, fake.CallCount("PutItem"))
+		})
+	}
+}
+
+func TestUpdateUserHandlerImmutableFields(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		body     string
+		expected int
+	}{
+		`changed immutable field`:   {body: `{"country_code_alpha_2":"US"}`, expected: http.StatusUnprocessableEntity},
+		`unchanged immutable field`: {body: `{"country_code_alpha_2":"CA","first_name":"Jack"}`, expected: http.StatusOK},
+		`mutable field`:             {body: `{"first_name":"Jack"}`, expected: http.StatusOK},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.immutableFields = []string{"country_code_alpha_2", "created_at"}
+			seedUsers(t, fake, validUser(id))
+
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			app.updateUserHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+			if tt.expected != http.StatusOK {
+				require.Contains(t, rr.Body.String(), `"country_code_alpha_2":"cannot be changed"`)
+				require.Equal(t, 0, fake.CallCount("UpdateItem"))
+				return
+			}
+
+			stored, err := app.models.Users.Get(context.Background(), id)
+			require.NoError(t, err)
+			require.Equal(t, "Jack", stored.FirstName)
+		})
+	}
+}
+
+func TestUpdateUserHandlerInvalid(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	seedUsers(t, fake, validUser(id))
+
+	req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{"currency":"XYZ","date_of_birth":"2999-01-01"}`))
+	rr := httptest.NewRecorder()
+	app.updateUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	require.Contains(t, rr.Body.String(), `"currency":"must be a valid ISO 4217 code"`)
+	require.Contains(t, rr.Body.String(), `"date_of_birth":"must not be in the future"`)
+	require.Equal(t, 0, fake.CallCount("UpdateItem"))
+}
+
+func TestUpdateUserHandlerDuplicateEmail(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	app.models.Users.EmailTableName = "UserEmail"
+	seedUsers(t, fake, validUser(id))
+	err := app.models.Users.Create(context.Background(), validUser("5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22", usertest.WithEmail("jane.doe@example.com")))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{"email":"jane.doe@example.com"}`))
+	rr := httptest.NewRecorder()
+	app.updateUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	require.Contains(t, rr.Body.String(), `"email":"a user with this email address already exists"`)
+}
+
+func TestUpdateUserHandlerMixedCaseEmail(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		emailTable string
+	}{
+		`email index`:  {emailTable: ""},
+		`email claims`: {emailTable: "UserEmail"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.models.Users.EmailTableName = tt.emailTable
+			seedUsers(t, fake, validUser(id))
+			err := app.models.Users.Create(context.Background(), validUser("5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22", usertest.WithEmail("jane.doe@example.com")))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{"email":" Jane.Doe@Example.com"}`))
+			rr := httptest.NewRecorder()
+			app.updateUserHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+			require.Contains(t, rr.Body.String(), `"email":"a user with this email address already exists"`)
+		})
+	}
+}
+
+func TestUpdateUserHandlerMaxAttributes(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		body     string
+		expected int
+	}{
+		`within the cap`: {body: `{"first_name":"Jack","last_name":"Smith"}`, expected: http.StatusOK},
+		`above the cap`:  {body: `{"first_name":"Jack","last_name":"Smith","occupation":"Teacher"}`, expected: http.StatusUnprocessableEntity},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.maxUpdateAttributes = 2
+			seedUsers(t, fake, validUser(id))
+
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			app.updateUserHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+			if tt.expected != http.StatusOK {
+				require.Contains(t, rr.Body.String(), `"body":"must not update more than 2 attributes"`)
+				require.Equal(t, 0, fake.CallCount("UpdateItem"))
+			}
+		})
+	}
+}
+
+func TestCreateUserHandlerCharset(t *testing.T) {
+	const body = `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+
+	tests := map[string]struct {
+		contentType string
+		expected    int
+	}{
+		`utf-8 charset`:     {contentType: "application/json; charset=UTF-8", expected: http.StatusCreated},
+		`no charset`:        {contentType: "application/json", expected: http.StatusCreated},
+		`no content type`:   {contentType: "", expected: http.StatusCreated},
+		`non-utf-8 charset`: {contentType: "application/json; charset=iso-8859-1", expected: http.StatusUnsupportedMediaType},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.requireUTF8 = true
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+
+			app.createUserHandler(rr, req)
+
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+			if tt.expected == http.StatusUnsupportedMediaType {
+				require.Equal(t, 0, fake.CallCount("PutItem"))
+			}
+		})
+	}
+}
+
+func TestCreateUserHandlerTrailingData(t *testing.T) {
+	const body = `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+
+	app, fake := newTestApplication(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body+body))
+	rr := httptest.NewRecorder()
+	app.createUserHandler(rr, req)
+
+	require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+	require.Contains(t, rr.Body.String(), "body must only contain a single JSON value")
+	require.Equal(t, 0, fake.CallCount("PutItem"))
+}
+
+func TestCreateUserHandlerCanceled(t *testing.T) {
+	const body = `{"email":"john.doe@example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+
+	app, fake := newTestApplication(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	app.createUserHandler(rr, req)
+
+	require.Equal(t, http.StatusInternalServerError, rr.Code, rr.Body.String())
+	require.Empty(t, fake.Items)
+}
+
+func TestUpdateUserHandlerEmpty(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		emptyUpdate string
+		expected    int
+	}{
+		`rejected`: {emptyUpdate: "reject", expected: http.StatusBadRequest},
+		`ignored`:  {emptyUpdate: "noop", expected: http.StatusNotModified},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.config.emptyUpdate = tt.emptyUpdate
+			seedUsers(t, fake, &data.User{ID: id, FirstName: "John", CountryCodeAlpha2: "CA", Version: 1})
+
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{}`))
+			rr := httptest.NewRecorder()
+			app.updateUserHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+			require.Equal(t, 0, fake.CallCount("UpdateItem"))
+		})
+	}
+}
+
+func TestUpdateUserHandlerServerFields(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	app.config.immutableFields = nil
+	seedUsers(t, fake, validUser(id, func(usr *user.User) { usr.CreatedAt = "2023-01-01" }))
+
+	body := `{"id":"5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22","created_at":"1999-01-01","first_name":"Jack",` +
+		`"activated":true,"phone":"+15145550100","phone_verified":true}`
+	req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	app.updateUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	stored, err := app.models.Users.Get(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, "Jack", stored.FirstName)
+	require.Equal(t, "2023-01-01", stored.CreatedAt)
+	require.Equal(t, id, stored.ID)
+	require.False(t, stored.Activated)
+	require.Empty(t, stored.Phone)
+	require.False(t, stored.PhoneVerified)
+	require.Len(t, fake.Items, 1)
+}
+
+func TestMalformedID(t *testing.T) {
+	tests := map[string]struct {
+		reject   bool
+		expected int
+	}{
+		`not found`:   {reject: false, expected: http.StatusNotFound},
+		`bad request`: {reject: true, expected: http.StatusBadRequest},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, _ := newTestApplication(t)
+			app.config.rejectMalformedIDs = tt.reject
+
+			srv := httptest.NewServer(app.router())
+			defer srv.Close()
+
+			for _, method := range []string{http.MethodGet, http.MethodDelete} {
+				req, err := http.NewRequest(method, srv.URL+"/v1/users/not-a-uuid", nil)
+				require.NoError(t, err)
+				res, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				res.Body.Close()
+
+				require.Equal(t, tt.expected, res.StatusCode, method)
+			}
+
+			// A well-formed but unknown id is always not found.
+			res, err := http.Get(srv.URL + "/v1/users/5b1c7a4e-8d2f-4b6a-a1e3-9c4d2f7b8e22")
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, http.StatusNotFound, res.StatusCode)
+		})
+	}
+}
+
+func TestUpdateUserHandlerResponse(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	app.config.maskSupportContacts = true
+	usr := validUser(id)
+	seedUsers(t, fake, usr)
+
+	req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(`{"first_name":"Jack"}`))
+	req = app.contextSetCaller(req, &caller{Key: "key", Role: roleSupport})
+	rr := httptest.NewRecorder()
+	app.updateUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response struct {
+		User data.User `json:"user"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	// The whole user is shown, as it is by the other handlers.
+	require.Equal(t, id, response.User.ID)
+	require.Equal(t, "Jack", response.User.FirstName)
+	require.Equal(t, usr.LastName, response.User.LastName)
+	require.Equal(t, maskEmail(usr.Email), response.User.Email)
+}
+
+func TestUpdateUserHandlerDiff(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	app, fake := newTestApplication(t)
+	seedUsers(t, fake, validUser(id))
+
+	req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id+"?return=diff", strings.NewReader(`{"first_name":"Jack"}`))
+	rr := httptest.NewRecorder()
+	app.updateUserHandler(rr, withParams(req, "id", id))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var response struct {
+		Diff map[string][2]interface{} `json:"diff"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	require.Equal(t, [2]interface{}{"John", "Jack"}, response.Diff["firstName"])
+	require.Equal(t, [2]interface{}{float64(1), float64(2)}, response.Diff["version"])
+	// The diff is derived from the update, without reading the user again.
+	require.Equal(t, 1, fake.CallCount("GetItem"))
+}
+
+func TestUpdateUserHandlerMetaNamespaces(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+	const body = `{"meta":[{"key":"theme","namespace":"ui","value":"dark"},{"key":"campaign","namespace":"marketing","value":"spring"}]}`
+
+	tests := map[string]struct {
+		policy   user.MetaPolicy
+		expected int
+		stored   []string
+	}{
+		`passthrough`: {policy: user.MetaPassthrough, expected: http.StatusOK, stored: []string{"ui", "marketing"}},
+		`strip`:       {policy: user.MetaStrip, expected: http.StatusOK, stored: []string{"ui"}},
+		`reject`:      {policy: user.MetaReject, expected: http.StatusUnprocessableEntity},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			app.rules.MetaNamespaces = []string{"ui"}
+			app.rules.MetaPolicy = tt.policy
+			seedUsers(t, fake, validUser(id))
+
+			req := httptest.NewRequest(http.MethodPatch, "/v1/users/"+id, strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			app.updateUserHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+
+			stored, err := app.models.Users.Get(context.Background(), id)
+			require.NoError(t, err)
+			var namespaces []string
+			for _, field := range stored.Meta {
+				namespaces = append(namespaces, field.Namespace)
+			}
+			require.Equal(t, tt.stored, namespaces)
+		})
+	}
+}
+
+func TestShowUserHandlerDeleted(t *testing.T) {
+	const id = "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11"
+
+	tests := map[string]struct {
+		role     string
+		query    string
+		expected int
+	}{
+		`hidden by default`:        {role: roleAdmin, query: "", expected: http.StatusNotFound},
+		`included for admins`:      {role: roleAdmin, query: "?include_deleted=true", expected: http.StatusOK},
+		`hidden from support`:      {role: roleSupport, query: "?include_deleted=true", expected: http.StatusNotFound},
+		`hidden from anonymous`:    {role: "", query: "?include_deleted=true", expected: http.StatusNotFound},
+		`not a boolean for admins`: {role: roleAdmin, query: "?include_deleted=yes", expected: http.StatusNotFound},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			app, fake := newTestApplication(t)
+			seedUsers(t, fake, &data.User{ID: id, FirstName: "John", DeletedAt: "2023-03-01", Version: 2})
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/users/"+id+tt.query, nil)
+			if tt.role != "" {
+				req = app.contextSetCaller(req, &caller{Key: "key", Role: tt.role})
+			}
+			rr := httptest.NewRecorder()
+			app.showUserHandler(rr, withParams(req, "id", id))
+
+			require.Equal(t, tt.expected, rr.Code, rr.Body.String())
+			if tt.expected == http.StatusOK {
+				require.Contains(t, rr.Body.String(), `"deleted_at":"2023-03-01"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// sendVerificationEmail sends the verification token to the user in the
+// background.
+func (app *application) sendVerificationEmail(usr *data.User, token string) {
+	email, id := usr.Email, usr.ID
+
+	app.background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		body := fmt.Sprintf("Welcome to Kapital!\n\nUse the token below to verify your email, it expires in %s.\n\n%s\n", user.VerificationTTL, token)
+
+		err := app.notifier.Send(ctx, email, "Verify your email", body)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": id})
+		}
+	})
+}
+
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.readIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	usr, err := app.models.Users.Get(r.Context(), id.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Token != "", "token", "must be provided")
+	if v.Valid() && !usr.Activated {
+		v.Check(usr.Verification.Matches(input.Token, time.Now()), "token", "invalid or expired verification token")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !usr.Activated {
+		err = app.models.Users.Activate(r.Context(), usr)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflictResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, resourceEnvelope("user", usr), nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
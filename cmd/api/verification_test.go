@@ -0,0 +1,72 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerificationEmail(t *testing.T) {
+	app, _ := newTestApplication(t)
+	notifier := app.notifier.(*fakeNotifier)
+
+	body := `{"email":"John.Doe@Example.com","first_name":"John","last_name":"Doe","province_code":"ON","country_code_alpha_2":"CA"}`
+	rr := httptest.NewRecorder()
+	app.createUserHandler(rr, httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(body)))
+	require.Equal(t, http.StatusCreated, rr.Code)
+	require.NotContains(t, rr.Body.String(), "tokenHash")
+
+	var created struct {
+		User struct{ ID string } `json:"user"`
+	}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+
+	app.wg.Wait()
+
+	sent := notifier.sent()
+	require.Len(t, sent, 1)
+	require.Equal(t, "john.doe@example.com", sent[0].to)
+
+	lines := strings.Split(strings.TrimSpace(sent[0].body), "\n")
+	token := lines[len(lines)-1]
+	require.Len(t, token, 26)
+
+	activate := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/v1/users/"+created.User.ID+"/verification", strings.NewReader(`{"token":"`+token+`"}`))
+		rr := httptest.NewRecorder()
+		app.activateUserHandler(rr, withParams(req, "id", created.User.ID))
+		return rr
+	}
+
+	rr = activate("AAAAAAAAAAAAAAAAAAAAAAAAAA")
+	require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	rr = activate(token)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	stored, err := app.models.Users.Get(context.Background(), created.User.ID)
+	require.NoError(t, err)
+	require.True(t, stored.Activated)
+	require.Nil(t, stored.Verification)
+}
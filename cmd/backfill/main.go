@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command backfill populates the email index key of the users stored
+// before emails were normalized.
+//
+// It can be resumed from the last reported id with -start-after. When the
+// API claims the emails, -email-claims must be set so the claims move
+// along with the emails.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strconv"
+
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/jsonlog"
+	"user-service.mykapital.io/internal/user"
+)
+
+func main() {
+	env := flag.String("env", "development", "Environment (development|staging|production)")
+	az := flag.String("availability-zone", "us-east-1", "AWS Availability Zone")
+	table := flag.String("table", "User", "DynamoDB table holding the users")
+	tenant := flag.String("tenant", "", "Tenant prefixing the table name, in multi-tenant deployments")
+	startAfter := flag.String("start-after", "", "Resume the backfill after this user id")
+	dryRun := flag.Bool("dry-run", false, "Report the users to update without writing")
+	emailClaims := flag.Bool("email-claims", false, "Move the claims of the emails in the UserEmail table, when the API claims them")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	sdkCfg, err := data.LoadSDKConfig(*env, *az, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	model, err := user.Model{DynamoDbClient: data.NewDynamoDBClient(sdkCfg), TableName: *table}.ForTenant(*tenant)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	if *emailClaims {
+		model.EmailTableName, err = user.TenantName(*tenant, "UserEmail")
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	}
+
+	report, err := model.BackfillEmailIndex(context.Background(), *startAfter, *dryRun, func(report user.BackfillReport) {
+		logger.PrintInfo("backfill progress", reportProperties(report, *dryRun))
+	})
+	if err != nil {
+		logger.PrintFatal(err, reportProperties(report, *dryRun))
+	}
+
+	logger.PrintInfo("backfill completed", reportProperties(report, *dryRun))
+}
+
+// reportProperties returns the log properties of a backfill report.
+func reportProperties(report user.BackfillReport, dryRun bool) map[string]string {
+	return map[string]string{
+		"updated":   strconv.Itoa(report.Updated),
+		"populated": strconv.Itoa(report.Populated),
+		"skipped":   strconv.Itoa(report.Skipped),
+		"last_id":   report.LastID,
+		"dry_run":   strconv.FormatBool(dryRun),
+	}
+}
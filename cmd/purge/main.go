@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command purge hard-deletes the users soft-deleted before the retention
+// window.
+//
+// It is meant to be run on a schedule, and with -dry-run to report the
+// users it would delete.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"strconv"
+	"time"
+
+	"user-service.mykapital.io/internal/data"
+	"user-service.mykapital.io/internal/jsonlog"
+	"user-service.mykapital.io/internal/user"
+)
+
+func main() {
+	env := flag.String("env", "development", "Environment (development|staging|production)")
+	az := flag.String("availability-zone", "us-east-1", "AWS Availability Zone")
+	table := flag.String("table", "User", "DynamoDB table holding the users")
+	emailTable := flag.String("email-table", "", "DynamoDB table claiming the emails of the users, whose claims are purged along with them")
+	tenant := flag.String("tenant", "", "Tenant prefixing the table names, in multi-tenant deployments")
+	retention := flag.Duration("retention", 30*24*time.Hour, "How long the soft-deleted users are kept before being purged")
+	dryRun := flag.Bool("dry-run", false, "Report the users to purge without deleting them")
+
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	sdkCfg, err := data.LoadSDKConfig(*env, *az, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	model := user.Model{DynamoDbClient: data.NewDynamoDBClient(sdkCfg), TableName: *table, EmailTableName: *emailTable}
+	model, err = model.ForTenant(*tenant)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	before := time.Now().Add(-*retention)
+	properties := map[string]string{
+		"before":  before.Format("2006-01-02"),
+		"dry_run": strconv.FormatBool(*dryRun),
+	}
+
+	purged, err := model.PurgeDeleted(context.Background(), before, *dryRun)
+	properties["purged"] = strconv.Itoa(purged)
+	if err != nil {
+		logger.PrintFatal(err, properties)
+	}
+
+	logger.PrintInfo("purge completed", properties)
+}
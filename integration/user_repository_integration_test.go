@@ -25,12 +25,14 @@ import (
 	"github.com/docker/go-connections/nat"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	dbtype "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/docker/docker/api/types"
@@ -39,6 +41,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	xerrors "user-service.mykapital.io/internal/errors"
+	"user-service.mykapital.io/internal/testsupport"
 	"user-service.mykapital.io/internal/user"
 )
 
@@ -49,21 +52,27 @@ func TestRepositoryIntegration(t *testing.T) {
 	}{
 		{`create a new table then confirm the table exists`, testNewTable},
 		{`add a new item and get it back to confirm the operation`, testNewItem},
+		{`get the new item back by its email through the email index`, testGetByEmail},
+		{`insert the item again, rejected as a duplicate, then replace it`, testDuplicateItem},
 		{`update the new item and get it back to confirm the operation`, testUpdateItem},
 		{`try to update the new item, but get an edit conflict error`, testEditConflict},
+		{`cancel a transaction on a failing condition, and confirm nothing is written`, testTransactAtomicity},
+		{`insert users together with a duplicate, and confirm none is inserted`, testTransactInsert},
+		{`purge the users soft-deleted before a cutoff, and confirm the others are kept`, testPurgeDeleted},
 		{`remove the item and confirm the item is removed`, testRemoveItem},
+		{`run the self-test and confirm it leaves nothing behind`, testSelfTest},
 		{`remove the table and confirm the table is removed`, testRemoveTable},
 	}
 	runTestsOnDynamoDB(t, scenarioSteps)
 }
 
 func testNewTable(t *testing.T, model user.Model) {
-	_, err := model.CreateTable()
+	err := model.EnsureTable(context.Background())
 	if err != nil {
 		t.Fatalf("table %s is not created: %v", model.TableName, err)
 	}
 
-	exists, err := model.TableExists()
+	exists, err := model.TableExists(context.Background())
 	if err != nil {
 		t.Fatalf("table search was intrupted: %v", err)
 	}
@@ -87,12 +96,20 @@ func testNewItem(t *testing.T, model user.Model) {
 		Version:                1,
 	}
 
-	err := model.Insert(&usr)
+	err := model.Insert(context.Background(), &usr)
 	if err != nil {
 		t.Fatalf("failed to insert user into %s: %v", model.TableName, err)
 	}
 
-	response, err := model.Get(usr.ID)
+	// The read is retried, in case the model reads eventually consistent.
+	var response *user.User
+	err = testsupport.Eventually(5*time.Second, func() (err error) {
+		response, err = model.Get(context.Background(), usr.ID)
+		if errors.Is(err, xerrors.ErrRecordNotFound) {
+			err = fmt.Errorf("user %s isn't present yet", usr.ID)
+		}
+		return err
+	})
 	if err != nil {
 		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
 	}
@@ -100,8 +117,56 @@ func testNewItem(t *testing.T, model user.Model) {
 	require.EqualValuesf(t, usr, *response, "user inserted into the table, but was not retrieved")
 }
 
+func testGetByEmail(t *testing.T, model user.Model) {
+	// The index is eventually consistent, so the read is retried.
+	var usr *user.User
+	err := testsupport.Eventually(5*time.Second, func() (err error) {
+		usr, err = model.GetByEmail(context.Background(), "John.Doe@example.com")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to get user by email from %s: %v", model.TableName, err)
+	}
+	require.Equal(t, "f8ae3ad1-d5c7-4465-b446-2e931606e938", usr.ID, "the user of the email was not retrieved")
+	require.Equal(t, "John", usr.FirstName, "the user was not fetched in full")
+
+	_, err = model.GetByEmail(context.Background(), "nobody@example.com")
+	require.ErrorIsf(t, err, xerrors.ErrRecordNotFound, "a user was retrieved for an unknown email")
+}
+
+func testDuplicateItem(t *testing.T, model user.Model) {
+	usr, err := model.Get(context.Background(), "f8ae3ad1-d5c7-4465-b446-2e931606e938")
+	if err != nil {
+		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
+	}
+
+	duplicate := *usr
+	duplicate.FirstName = "Jack"
+	err = model.Insert(context.Background(), &duplicate)
+	require.ErrorIsf(t, err, xerrors.ErrDuplicateUser, "the existing user was overwritten by an insert")
+
+	response, err := model.Get(context.Background(), usr.ID)
+	if err != nil {
+		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
+	}
+	require.Equal(t, "John", response.FirstName, "the existing user was overwritten by an insert")
+
+	if err = model.InsertOrReplace(context.Background(), &duplicate); err != nil {
+		t.Fatalf("failed to replace user in %s: %v", model.TableName, err)
+	}
+	response, err = model.Get(context.Background(), usr.ID)
+	if err != nil {
+		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
+	}
+	require.Equal(t, "Jack", response.FirstName, "the existing user was not replaced")
+
+	if err = model.InsertOrReplace(context.Background(), usr); err != nil {
+		t.Fatalf("failed to restore user in %s: %v", model.TableName, err)
+	}
+}
+
 func testUpdateItem(t *testing.T, model user.Model) {
-	usr, err := model.Get("f8ae3ad1-d5c7-4465-b446-2e931606e938")
+	usr, err := model.Get(context.Background(), "f8ae3ad1-d5c7-4465-b446-2e931606e938")
 	if err != nil {
 		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
 	}
@@ -111,12 +176,12 @@ func testUpdateItem(t *testing.T, model user.Model) {
 		},
 	}
 
-	_, err = model.Update(usr, newAttributes)
+	_, err = model.Update(context.Background(), usr, newAttributes)
 	if err != nil {
 		t.Fatalf("failed to update the user in %s: %v", model.TableName, err)
 	}
 
-	response, err := model.Get(usr.ID)
+	response, err := model.Get(context.Background(), usr.ID)
 	if err != nil {
 		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
 	}
@@ -135,42 +200,140 @@ func testEditConflict(t *testing.T, model user.Model) {
 		},
 	}
 
-	usr, err := model.Get(usrWithID.ID)
+	usr, err := model.Get(context.Background(), usrWithID.ID)
 	if err != nil {
 		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
 	}
 
 	usr.Version -= 1
 
-	_, err = model.Update(usr, newAttributes)
+	_, err = model.Update(context.Background(), usr, newAttributes)
 	if !errors.Is(err, xerrors.ErrEditConflict) {
 		t.Errorf("No edit conflicts detected")
 	}
 }
 
+func testTransactAtomicity(t *testing.T, model user.Model) {
+	existing := user.User{ID: "f8ae3ad1-d5c7-4465-b446-2e931606e938"}
+	added := user.User{ID: "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", Email: "jane.doe@example.com", FirstName: "Jane", Version: 1}
+	missing := user.User{ID: "9f3e6d1a-2b4c-4d8e-b7f1-6a5c3e2d1b33"}
+
+	before, err := model.Get(context.Background(), existing.ID)
+	if err != nil {
+		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
+	}
+
+	err = model.Transact(context.Background(),
+		user.PutOp(added),
+		user.UpdateOp(existing.GetKey(), expression.Set(expression.Name("firstName"), expression.Value("Jack"))),
+		user.CheckOp(missing.GetKey(), expression.AttributeExists(expression.Name("userID"))),
+	)
+	var transactErr *user.TransactionError
+	if !errors.As(err, &transactErr) {
+		t.Fatalf("transaction was not canceled: %v", err)
+	}
+	require.Equal(t, []int{2}, transactErr.ConditionFailed(), "failed to report the failing condition")
+
+	_, err = model.Get(context.Background(), added.ID)
+	require.ErrorIsf(t, err, xerrors.ErrRecordNotFound, "the put of a canceled transaction was applied")
+
+	after, err := model.Get(context.Background(), existing.ID)
+	if err != nil {
+		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
+	}
+	require.Equal(t, before.FirstName, after.FirstName, "the update of a canceled transaction was applied")
+}
+
+func testTransactInsert(t *testing.T, model user.Model) {
+	added := &user.User{ID: "0e7d2b8c-1f39-4c5e-9a5c-3b8a7f0e4a11", Email: "jane.doe@example.com", FirstName: "Jane", Version: 1}
+	existing := &user.User{ID: "f8ae3ad1-d5c7-4465-b446-2e931606e938", Email: "jack.doe@example.com", FirstName: "Jack", Version: 1}
+
+	err := model.TransactInsert(context.Background(), []*user.User{added, existing})
+	var duplicateErr *user.DuplicateUsersError
+	if !errors.As(err, &duplicateErr) {
+		t.Fatalf("the duplicate user was not reported: %v", err)
+	}
+	require.Equal(t, []string{existing.ID}, duplicateErr.IDs, "failed to report the duplicate user")
+
+	_, err = model.Get(context.Background(), added.ID)
+	require.ErrorIsf(t, err, xerrors.ErrRecordNotFound, "a user of a canceled transaction was inserted")
+
+	usr, err := model.Get(context.Background(), existing.ID)
+	if err != nil {
+		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
+	}
+	require.NotEqual(t, "Jack", usr.FirstName, "the existing user was overwritten by a canceled transaction")
+}
+
+func testPurgeDeleted(t *testing.T, model user.Model) {
+	old := &user.User{ID: "3c9d2e7f-5a1b-4c8d-9e6f-2b7a4d1c8e55", Email: "old@example.com", DeletedAt: "2022-06-15", Version: 1}
+	recent := &user.User{ID: "7a4b1c9e-2d6f-4e3a-8b5c-1f9e7d3a6c44", Email: "recent@example.com", DeletedAt: "2023-03-01", Version: 1}
+	for _, usr := range []*user.User{old, recent} {
+		if err := model.Insert(context.Background(), usr); err != nil {
+			t.Fatalf("failed to insert user into %s: %v", model.TableName, err)
+		}
+	}
+	defer model.Delete(context.Background(), recent)
+
+	purged, err := model.PurgeDeleted(context.Background(), time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), false)
+	if err != nil {
+		t.Fatalf("failed to purge users from %s: %v", model.TableName, err)
+	}
+	require.Equal(t, 1, purged, "failed to purge the old soft-deleted user only")
+
+	model.IncludeDeleted = true
+	_, err = model.Get(context.Background(), old.ID)
+	require.ErrorIsf(t, err, xerrors.ErrRecordNotFound, "the old soft-deleted user was not purged")
+	_, err = model.Get(context.Background(), recent.ID)
+	require.NoError(t, err, "the recently soft-deleted user was purged")
+	_, err = model.Get(context.Background(), "f8ae3ad1-d5c7-4465-b446-2e931606e938")
+	require.NoError(t, err, "an active user was purged")
+}
+
 func testRemoveItem(t *testing.T, model user.Model) {
-	err := model.Delete(&user.User{ID: "f8ae3ad1-d5c7-4465-b446-2e931606e938"})
+	err := model.Delete(context.Background(), &user.User{ID: "f8ae3ad1-d5c7-4465-b446-2e931606e938"})
 	if err != nil {
 		t.Fatalf("failed to delete user from %s: %v", model.TableName, err)
 	}
 
-	usr, err := model.Get("f8ae3ad1-d5c7-4465-b446-2e931606e938")
+	_, err = model.Get(context.Background(), "f8ae3ad1-d5c7-4465-b446-2e931606e938")
+	require.ErrorIsf(t, err, xerrors.ErrRecordNotFound, "failed to confirm that the user is deleted")
+}
+
+func testSelfTest(t *testing.T, model user.Model) {
+	var steps []string
+	err := model.SelfTest(context.Background(), func(step string, err error) {
+		if err != nil {
+			t.Errorf("self-test step %q failed: %v", step, err)
+		}
+		steps = append(steps, step)
+	})
 	if err != nil {
-		t.Fatalf("failed to get user from %s: %v", model.TableName, err)
+		t.Fatalf("self-test failed on %s: %v", model.TableName, err)
 	}
+	require.Equal(t, []string{user.SelfTestDescribe, user.SelfTestPut, user.SelfTestGet, user.SelfTestDelete}, steps)
 
-	require.EqualValuesf(t, &user.User{}, usr, "failed to confirm that the user is deleted")
+	model.IncludeDeleted = true
+	err = model.ForEach(context.Background(), expression.ConditionBuilder{}, func(usr *user.User) error {
+		if strings.HasPrefix(usr.ID, user.SelfTestIDPrefix) {
+			t.Errorf("the throwaway user %s wasn't deleted", usr.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to scan %s: %v", model.TableName, err)
+	}
 }
 
 func testRemoveTable(t *testing.T, model user.Model) {
-	err := model.DeleteTable()
+	err := model.DeleteTable(context.Background())
 	if err != nil {
 		t.Fatalf("failed to delete table %s: %v", model.TableName, err)
 	}
 
 	var notFoundEx *dbtype.ResourceNotFoundException
 
-	exists, err := model.TableExists()
+	exists, err := model.TableExists(context.Background())
 	if !errors.As(err, &notFoundEx) {
 		t.Fatalf("table search was intrupted: %v", err)
 	}
@@ -209,10 +372,13 @@ func runTestsOnDynamoDB(t *testing.T, scenarioSteps []struct {
 	// Run the scenario steps
 	var mutex sync.Mutex
 	prevStatus := true
+	// The reads are consistent, so they see the previous writes on real
+	// DynamoDB as well.
 	model := user.Model{
 		DynamoDbClient: dynamodbClient,
 		TableName:      "User",
 		IndexName:      "email",
+		ConsistentRead: true,
 	}
 	for _, step := range scenarioSteps {
 		t.Run(step.name, func(t *testing.T) {
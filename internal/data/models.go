@@ -19,17 +19,40 @@ limitations under the License.
 package data
 
 import (
-	"errors"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	xerrors "user-service.mykapital.io/internal/errors"
 	"user-service.mykapital.io/internal/user"
 )
 
 // Possible errors passed from a model.
 var (
-	ErrRecordNotFound = errors.New("record not found")
-	ErrEditConflict   = errors.New("edit conflict")
+	ErrRecordNotFound = xerrors.ErrRecordNotFound
+	ErrEditConflict   = xerrors.ErrEditConflict
+	ErrDuplicateEmail = xerrors.ErrDuplicateEmail
+	// ErrDuplicateUser is returned when inserting a user whose id is
+	// already taken.
+	ErrDuplicateUser = xerrors.ErrDuplicateUser
+	// ErrPendingVerification is returned when registering an email which
+	// is pending verification.
+	ErrPendingVerification = xerrors.ErrPendingVerification
+	// ErrConditionFailed is returned when an update doesn't meet one of
+	// its conditions.
+	ErrConditionFailed = xerrors.ErrConditionFailed
+	// ErrInvalidPhoneCode is returned for a wrong or expired phone
+	// verification code.
+	ErrInvalidPhoneCode = user.ErrInvalidPhoneCode
+	// ErrPhoneLocked is returned once a phone verification got too many
+	// wrong codes.
+	ErrPhoneLocked = user.ErrPhoneLocked
 )
 
+// BatchError reports the items a batch operation couldn't process.
+type BatchError = xerrors.BatchError
+
+// DuplicateEmailsError reports the users of a batch whose email is
+// already registered.
+type DuplicateEmailsError = user.DuplicateEmailsError
+
 // Models represents the internal models for the server.
 type Models struct {
 	Users user.Model
@@ -37,9 +60,19 @@ type Models struct {
 
 // NewModels creates Models.
 //
-// For the user model, a DynamoDB client is passed.
-func NewModels(client *dynamodb.Client) Models {
-	return Models{
-		Users: user.Model{DynamoDbClient: client, TableName: "User"},
+// For the user model, a DynamoDB client is passed. The retry budget is
+// shared by every model. The tables of a non-empty tenant are prefixed
+// with the tenant, which must match user.TenantRX.
+func NewModels(client *dynamodb.Client, retryBudget *user.RetryBudget, tenant string) (Models, error) {
+	users, err := user.Model{
+		DynamoDbClient: client,
+		TableName:      "User",
+		IndexName:      "email",
+		RetryBudget:    retryBudget,
+	}.ForTenant(tenant)
+	if err != nil {
+		return Models{}, err
 	}
+
+	return Models{Users: users}, nil
 }
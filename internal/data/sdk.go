@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	sdkConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"user-service.mykapital.io/internal/jsonlog"
+	"user-service.mykapital.io/internal/user"
+)
+
+// LoadSDKConfig loads the AWS SDK config of the availability zone, logging
+// with the logger.
+//
+// In the development environment, the services are reached on the local
+// DynamoDB at localhost:8000.
+func LoadSDKConfig(env, az string, logger *jsonlog.Logger) (aws.Config, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sdkCfg, err := sdkConfig.LoadDefaultConfig(
+		ctx,
+		sdkConfig.WithRegion(az),
+		sdkConfig.WithLogger(logger),
+	)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if env == "development" {
+		sdkCfg.EndpointResolverWithOptions = aws.EndpointResolverWithOptionsFunc(
+			func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+				return aws.Endpoint{URL: "http://localhost:8000"}, nil
+			})
+	}
+
+	return sdkCfg, nil
+}
+
+// NewDynamoDBClient creates a DynamoDB client from the SDK config,
+// retrying with user.NewRetryer.
+func NewDynamoDBClient(sdkCfg aws.Config) *dynamodb.Client {
+	return dynamodb.NewFromConfig(sdkCfg, func(o *dynamodb.Options) { o.Retryer = user.NewRetryer() })
+}
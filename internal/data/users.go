@@ -0,0 +1,80 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package data
+
+import (
+	"time"
+
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// User is the user handled by the API.
+type User = user.User
+
+// ValidateUser validates User data.
+//
+// Refer to user.ValidateUser for the validation rules.
+func ValidateUser(v *validator.Validator, u *User) {
+	user.ValidateUser(v, u)
+}
+
+// Normalize normalizes the codes of the user.
+//
+// Refer to user.Normalize for the normalized fields.
+func Normalize(u *User) {
+	user.Normalize(u)
+}
+
+// NewVerification generates the email verification token of a new user.
+//
+// Refer to user.NewVerification for the token expiry.
+func NewVerification(now time.Time) (string, *user.Verification, error) {
+	return user.NewVerification(now)
+}
+
+// NewPhoneVerification generates the code verifying the phone of a user.
+//
+// Refer to user.NewPhoneVerification for the code expiry.
+func NewPhoneVerification(phone string, now time.Time) (string, *user.PhoneVerification, error) {
+	return user.NewPhoneVerification(phone, now)
+}
+
+// AgeBucket returns the range of the age of a user born on dob.
+//
+// Refer to user.AgeBuckets for the ranges.
+func AgeBucket(dob string, now time.Time) string {
+	return user.AgeBucket(dob, now)
+}
+
+// IncomeBucket returns the range of an income, in whole units of currency.
+//
+// Refer to user.IncomeBuckets for the ranges.
+func IncomeBucket(amount int64) string {
+	return user.IncomeBucket(amount)
+}
+
+// UpdateOptions configures the attributes built by BuildUpdateAttributes.
+type UpdateOptions = user.UpdateOptions
+
+// BuildUpdateAttributes returns the new attributes of an update from the
+// fields of a struct, keyed by their dynamodbav tags.
+//
+// Refer to user.BuildUpdateAttributes for the fields left out.
+func BuildUpdateAttributes(v interface{}, opts UpdateOptions) map[string]interface{} {
+	return user.BuildUpdateAttributes(v, opts)
+}
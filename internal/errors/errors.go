@@ -0,0 +1,61 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package errors declares the errors shared by the models and the API.
+//
+// It is usually imported as xerrors to avoid shadowing the standard
+// library errors package.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Possible errors passed from a model.
+var (
+	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
+	ErrTableExists    = errors.New("table already exists")
+	ErrDuplicateEmail = errors.New("duplicate email")
+	// ErrDuplicateUser is returned when inserting a user whose id is
+	// already taken.
+	ErrDuplicateUser = errors.New("duplicate user")
+	// ErrPendingVerification is returned for an email registered recently
+	// by a user who has not verified it yet.
+	ErrPendingVerification = errors.New("pending verification")
+	// ErrConditionFailed is returned when an update is rejected by a
+	// condition of the caller, rather than by the version check.
+	ErrConditionFailed = errors.New("condition failed")
+)
+
+// BatchError reports the items a batch operation couldn't process, while
+// the other items of the batch were processed.
+type BatchError struct {
+	// IDs are the ids of the unprocessed items.
+	IDs []string
+	// Err is why the items couldn't be processed.
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("couldn't process %d items (%s): %v", len(e.IDs), strings.Join(e.IDs, ", "), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
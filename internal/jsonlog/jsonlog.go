@@ -30,7 +30,9 @@ import (
 type Level int8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -38,8 +40,12 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
@@ -75,8 +81,20 @@ func (l *Logger) PrintFatal(err error, properties map[string]string) {
 	os.Exit(1) // For entries at the FATAL level, we also terminate the application.
 }
 
+// Logf implements the logging.Logger interface of the AWS SDK.
+//
+// The SDK warnings and debug messages are printed at the WARN and DEBUG
+// levels, with an "aws-sdk" source property.
 func (l *Logger) Logf(classification logging.Classification, format string, v ...interface{}) {
-	l.PrintError(fmt.Errorf(format, v...), nil)
+	level := LevelInfo
+	switch classification {
+	case logging.Warn:
+		level = LevelWarn
+	case logging.Debug:
+		level = LevelDebug
+	}
+
+	l.print(level, fmt.Sprintf(format, v...), map[string]string{"source": "aws-sdk"})
 }
 
 func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
@@ -0,0 +1,71 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/smithy-go/logging"
+)
+
+func TestLogf(t *testing.T) {
+	tests := map[string]struct {
+		classification logging.Classification
+		minLevel       Level
+		expected       string
+	}{
+		`warning`:                 {classification: logging.Warn, minLevel: LevelInfo, expected: "WARN"},
+		`debug`:                   {classification: logging.Debug, minLevel: LevelDebug, expected: "DEBUG"},
+		`debug above threshold`:   {classification: logging.Debug, minLevel: LevelInfo, expected: ""},
+		`warning above threshold`: {classification: logging.Warn, minLevel: LevelError, expected: ""},
+		`unknown classification`:  {classification: "TRACE", minLevel: LevelInfo, expected: "INFO"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			New(&out, tt.minLevel).Logf(tt.classification, "retrying %s", "PutItem")
+
+			if tt.expected == "" {
+				if out.Len() != 0 {
+					t.Fatalf("unexpected log line: %s", out.String())
+				}
+				return
+			}
+
+			var line struct {
+				Level      string            `json:"level"`
+				Message    string            `json:"message"`
+				Properties map[string]string `json:"properties"`
+			}
+			if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			if line.Level != tt.expected {
+				t.Errorf("unexpected level: got %q, want %q", line.Level, tt.expected)
+			}
+			if line.Message != "retrying PutItem" {
+				t.Errorf("unexpected message: %q", line.Message)
+			}
+			if line.Properties["source"] != "aws-sdk" {
+				t.Errorf("unexpected source: %q", line.Properties["source"])
+			}
+		})
+	}
+}
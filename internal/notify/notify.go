@@ -0,0 +1,47 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends notifications, such as verification emails, to
+// the users.
+package notify
+
+import (
+	"context"
+
+	"user-service.mykapital.io/internal/jsonlog"
+)
+
+// Notifier sends a message to a recipient.
+type Notifier interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// Log is a Notifier writing the messages to a logger instead of sending
+// them. It is meant for development.
+type Log struct {
+	Logger *jsonlog.Logger
+}
+
+// Send logs the message.
+func (l Log) Send(_ context.Context, to, subject, body string) error {
+	l.Logger.PrintInfo("notification", map[string]string{
+		"to":      to,
+		"subject": subject,
+		"body":    body,
+	})
+
+	return nil
+}
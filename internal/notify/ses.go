@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// SES is a Notifier sending emails through the Amazon SES v2 API.
+//
+// The request is signed with the credentials of the SDK configuration,
+// so no SES client is required.
+type SES struct {
+	// Config provides the region and the credentials.
+	Config aws.Config
+	// From is the verified address the emails are sent from.
+	From string
+	// Endpoint overrides the regional SES endpoint when it is not empty.
+	Endpoint string
+	// Client sends the requests. http.DefaultClient is used when it is nil.
+	Client *http.Client
+}
+
+// sesMessage is the body of a SendEmail request.
+type sesMessage struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Simple struct {
+			Subject sesContent `json:"Subject"`
+			Body    struct {
+				Text sesContent `json:"Text"`
+			} `json:"Body"`
+		} `json:"Simple"`
+	} `json:"Content"`
+}
+
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+// Send sends a plain text email.
+func (s SES) Send(ctx context.Context, to, subject, body string) error {
+	var message sesMessage
+	message.FromEmailAddress = s.From
+	message.Destination.ToAddresses = []string{to}
+	message.Content.Simple.Subject = sesContent{Data: subject, Charset: "UTF-8"}
+	message.Content.Simple.Body.Text = sesContent{Data: body, Charset: "UTF-8"}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://email.%s.amazonaws.com", s.Config.Region)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/v2/email/outbound-emails", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	credentials, err := s.Config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve the credentials. Here's why: %v", err)
+	}
+
+	hash := sha256.Sum256(payload)
+	err = v4.NewSigner().SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "ses", s.Config.Region, time.Now())
+	if err != nil {
+		return fmt.Errorf("couldn't sign the email request. Here's why: %v", err)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't send email to %s. Here's why: %v", to, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		reason, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("couldn't send email to %s. Here's why: %s: %s", to, res.Status, reason)
+	}
+
+	return nil
+}
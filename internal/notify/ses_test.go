@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestSESSend(t *testing.T) {
+	var message sesMessage
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/email/outbound-emails" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("failed to decode message: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	ses := SES{
+		Config: aws.Config{
+			Region:      "us-east-1",
+			Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		},
+		From:     "no-reply@mykapital.io",
+		Endpoint: srv.URL,
+	}
+
+	err := ses.Send(context.Background(), "john.doe@example.com", "Verify your email", "token: abc")
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/") {
+		t.Errorf("request is not signed: %q", authorization)
+	}
+	if got := message.Destination.ToAddresses; len(got) != 1 || got[0] != "john.doe@example.com" {
+		t.Errorf("unexpected recipients: %v", got)
+	}
+	if message.FromEmailAddress != ses.From || message.Content.Simple.Body.Text.Data != "token: abc" {
+		t.Errorf("unexpected message: %+v", message)
+	}
+}
+
+func TestSESSendRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"Email address is not verified."}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	ses := SES{
+		Config: aws.Config{
+			Region:      "us-east-1",
+			Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		},
+		Endpoint: srv.URL,
+	}
+
+	err := ses.Send(context.Background(), "john.doe@example.com", "subject", "body")
+	if err == nil || !strings.Contains(err.Error(), "not verified") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
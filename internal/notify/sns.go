@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// SNS is a Notifier sending text messages through the Amazon SNS API.
+//
+// The recipient is a phone number in the E.164 format, and the subject is
+// dropped as text messages don't have any. Like SES, the request is signed
+// with the credentials of the SDK configuration.
+type SNS struct {
+	// Config provides the region and the credentials.
+	Config aws.Config
+	// Endpoint overrides the regional SNS endpoint when it is not empty.
+	Endpoint string
+	// Client sends the requests. http.DefaultClient is used when it is nil.
+	Client *http.Client
+}
+
+// Send sends the body as a transactional text message.
+func (s SNS) Send(ctx context.Context, to, _, body string) error {
+	form := url.Values{
+		"Action":                         {"Publish"},
+		"Version":                        {"2010-03-31"},
+		"PhoneNumber":                    {to},
+		"Message":                        {body},
+		"MessageAttributes.entry.1.Name": {"AWS.SNS.SMS.SMSType"},
+		"MessageAttributes.entry.1.Value.DataType":    {"String"},
+		"MessageAttributes.entry.1.Value.StringValue": {"Transactional"},
+	}
+	payload := form.Encode()
+
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://sns.%s.amazonaws.com", s.Config.Region)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", strings.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	credentials, err := s.Config.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve the credentials. Here's why: %v", err)
+	}
+
+	hash := sha256.Sum256([]byte(payload))
+	err = v4.NewSigner().SignHTTP(ctx, credentials, req, hex.EncodeToString(hash[:]), "sns", s.Config.Region, time.Now())
+	if err != nil {
+		return fmt.Errorf("couldn't sign the text message request. Here's why: %v", err)
+	}
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("couldn't send text message to %s. Here's why: %v", to, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		reason, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("couldn't send text message to %s. Here's why: %s: %s", to, res.Status, reason)
+	}
+
+	return nil
+}
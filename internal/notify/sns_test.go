@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestSNSSend(t *testing.T) {
+	var phone, message, authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		if action := r.PostForm.Get("Action"); action != "Publish" {
+			t.Errorf("unexpected action: %s", action)
+		}
+		phone, message = r.PostForm.Get("PhoneNumber"), r.PostForm.Get("Message")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sns := SNS{
+		Config: aws.Config{
+			Region:      "us-east-1",
+			Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		},
+		Endpoint: srv.URL,
+	}
+
+	err := sns.Send(context.Background(), "+15145550123", "Verify your phone", "code: 123456")
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKID/") {
+		t.Errorf("request is not signed: %q", authorization)
+	}
+	if phone != "+15145550123" || message != "code: 123456" {
+		t.Errorf("unexpected message to %s: %q", phone, message)
+	}
+}
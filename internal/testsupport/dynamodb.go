@@ -0,0 +1,551 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testsupport contains helpers shared by the unit tests.
+//
+// * SHOULD ONLY BE USED DURING TESTING *
+package testsupport
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// KeyName is the name of the primary key of the faked table.
+const KeyName = "userID"
+
+// EmailKeyName is the name of the primary key of the faked email claims.
+// The tables are not told apart, so the claims share the faked table.
+const EmailKeyName = "email"
+
+// FakeDynamoDB is an in-memory DynamoDB table keyed by KeyName.
+//
+// Only the operations used by the models are supported. Condition, filter,
+// update and projection expressions are evaluated on top-level attributes.
+type FakeDynamoDB struct {
+	mu sync.Mutex
+	// Items are the stored items by primary key.
+	Items map[string]map[string]types.AttributeValue
+	// Calls counts the calls received by operation name.
+	Calls map[string]int
+	// Errs are the errors returned by operation name.
+	Errs map[string]error
+	// Unprocessed are the primary keys BatchGetItem and BatchWriteItem
+	// leave unprocessed.
+	Unprocessed map[string]bool
+}
+
+// NewFakeDynamoDB creates an empty FakeDynamoDB.
+func NewFakeDynamoDB() *FakeDynamoDB {
+	return &FakeDynamoDB{
+		Items: make(map[string]map[string]types.AttributeValue),
+		Calls: make(map[string]int),
+		Errs:  make(map[string]error),
+
+		Unprocessed: make(map[string]bool),
+	}
+}
+
+// FailWith makes every call of an operation return err.
+func (f *FakeDynamoDB) FailWith(operation string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Errs[operation] = err
+}
+
+// LeaveUnprocessed makes every BatchGetItem and BatchWriteItem call leave
+// the keys unprocessed, as if their reads and writes were throttled.
+func (f *FakeDynamoDB) LeaveUnprocessed(keys ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, key := range keys {
+		f.Unprocessed[key] = true
+	}
+}
+
+// CallCount returns the number of calls received by an operation.
+func (f *FakeDynamoDB) CallCount(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.Calls[operation]
+}
+
+// Put stores an item directly, bypassing the call counters.
+func (f *FakeDynamoDB) Put(item map[string]types.AttributeValue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Items[keyOf(item)] = item
+}
+
+func (f *FakeDynamoDB) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	if err := f.record(ctx, "CreateTable"); err != nil {
+		return nil, err
+	}
+	return &dynamodb.CreateTableOutput{
+		TableDescription: &types.TableDescription{TableName: params.TableName},
+	}, nil
+}
+
+func (f *FakeDynamoDB) DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	if err := f.record(ctx, "DescribeTable"); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &dynamodb.DescribeTableOutput{
+		Table: &types.TableDescription{
+			TableName:   params.TableName,
+			TableStatus: types.TableStatusActive,
+			ItemCount:   aws.Int64(int64(len(f.Items))),
+		},
+	}, nil
+}
+
+func (f *FakeDynamoDB) DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error) {
+	if err := f.record(ctx, "DeleteTable"); err != nil {
+		return nil, err
+	}
+	return &dynamodb.DeleteTableOutput{
+		TableDescription: &types.TableDescription{TableName: params.TableName},
+	}, nil
+}
+
+func (f *FakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if err := f.record(ctx, "PutItem"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := keyOf(params.Item)
+	err := f.check(f.Items[key], params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Items[key] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *FakeDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if err := f.record(ctx, "GetItem"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item := project(f.Items[keyOf(params.Key)], params.ProjectionExpression, params.ExpressionAttributeNames)
+	return &dynamodb.GetItemOutput{Item: item}, nil
+}
+
+// UpdateItem applies the update expression to the item, creating it when
+// it is missing.
+func (f *FakeDynamoDB) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if err := f.record(ctx, "UpdateItem"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := keyOf(params.Key)
+	old := f.Items[key]
+	err := f.check(old, params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	item := make(map[string]types.AttributeValue, len(old))
+	for name, value := range old {
+		item[name] = value
+	}
+	for name, value := range params.Key {
+		item[name] = value
+	}
+	if params.UpdateExpression != nil {
+		update := newExpression(*params.UpdateExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+		if err = update.update(item); err != nil {
+			return nil, err
+		}
+	}
+	f.Items[key] = item
+
+	out := &dynamodb.UpdateItemOutput{}
+	switch params.ReturnValues {
+	case types.ReturnValueAllOld:
+		out.Attributes = old
+	case types.ReturnValueAllNew:
+		out.Attributes = item
+	case types.ReturnValueUpdatedOld, types.ReturnValueUpdatedNew:
+		out.Attributes = make(map[string]types.AttributeValue)
+		for name, value := range item {
+			if !reflect.DeepEqual(old[name], value) {
+				if params.ReturnValues == types.ReturnValueUpdatedNew {
+					out.Attributes[name] = value
+				} else if old[name] != nil {
+					out.Attributes[name] = old[name]
+				}
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func (f *FakeDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if err := f.record(ctx, "DeleteItem"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := keyOf(params.Key)
+	err := f.check(f.Items[key], params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(f.Items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+// TransactWriteItems applies the operations all together, or cancels the
+// transaction when the condition of one of them fails.
+func (f *FakeDynamoDB) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, _ ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := f.record(ctx, "TransactWriteItems"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	items := make(map[string]map[string]types.AttributeValue, len(params.TransactItems))
+	deleted := make(map[string]bool)
+	reasons := make([]types.CancellationReason, len(params.TransactItems))
+	canceled := false
+	for i, op := range params.TransactItems {
+		var key string
+		var condition, update *string
+		var names map[string]string
+		var values map[string]types.AttributeValue
+		switch {
+		case op.Put != nil:
+			key, condition, names, values = keyOf(op.Put.Item), op.Put.ConditionExpression, op.Put.ExpressionAttributeNames, op.Put.ExpressionAttributeValues
+		case op.Update != nil:
+			key, condition, names, values = keyOf(op.Update.Key), op.Update.ConditionExpression, op.Update.ExpressionAttributeNames, op.Update.ExpressionAttributeValues
+			update = op.Update.UpdateExpression
+		case op.Delete != nil:
+			key, condition, names, values = keyOf(op.Delete.Key), op.Delete.ConditionExpression, op.Delete.ExpressionAttributeNames, op.Delete.ExpressionAttributeValues
+		case op.ConditionCheck != nil:
+			key, condition, names, values = keyOf(op.ConditionCheck.Key), op.ConditionCheck.ConditionExpression, op.ConditionCheck.ExpressionAttributeNames, op.ConditionCheck.ExpressionAttributeValues
+		}
+
+		reasons[i].Code = aws.String("None")
+		old := f.Items[key]
+		if err := f.check(old, condition, names, values); err != nil {
+			var ccf *types.ConditionalCheckFailedException
+			if !errors.As(err, &ccf) {
+				return nil, err
+			}
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			reasons[i].Message = ccf.Message
+			canceled = true
+			continue
+		}
+
+		switch {
+		case op.Put != nil:
+			items[key] = op.Put.Item
+		case op.Update != nil:
+			item := make(map[string]types.AttributeValue, len(old))
+			for name, value := range old {
+				item[name] = value
+			}
+			for name, value := range op.Update.Key {
+				item[name] = value
+			}
+			if err := newExpression(*update, names, values).update(item); err != nil {
+				return nil, err
+			}
+			items[key] = item
+		case op.Delete != nil:
+			deleted[key] = true
+		}
+	}
+	if canceled {
+		return nil, &types.TransactionCanceledException{
+			Message:             aws.String("Transaction cancelled, please refer cancellation reasons for specific reasons"),
+			CancellationReasons: reasons,
+		}
+	}
+
+	for key, item := range items {
+		f.Items[key] = item
+	}
+	for key := range deleted {
+		delete(f.Items, key)
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// BatchGetItem returns the requested items of the faked table which exist,
+// except the Unprocessed ones which are returned as unprocessed keys.
+func (f *FakeDynamoDB) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	if err := f.record(ctx, "BatchGetItem"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &dynamodb.BatchGetItemOutput{
+		Responses:       make(map[string][]map[string]types.AttributeValue),
+		UnprocessedKeys: make(map[string]types.KeysAndAttributes),
+	}
+	for table, request := range params.RequestItems {
+		if len(request.Keys) > 100 {
+			return nil, errors.New("fake dynamodb: too many keys requested")
+		}
+		for _, key := range request.Keys {
+			if f.Unprocessed[keyOf(key)] {
+				unprocessed := out.UnprocessedKeys[table]
+				unprocessed.Keys = append(unprocessed.Keys, key)
+				unprocessed.ConsistentRead = request.ConsistentRead
+				out.UnprocessedKeys[table] = unprocessed
+				continue
+			}
+			if item, ok := f.Items[keyOf(key)]; ok {
+				out.Responses[table] = append(out.Responses[table], item)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// BatchWriteItem stores and deletes the requested items of the faked
+// table, except the Unprocessed ones which are returned as unprocessed
+// items.
+func (f *FakeDynamoDB) BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	if err := f.record(ctx, "BatchWriteItem"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out := &dynamodb.BatchWriteItemOutput{
+		UnprocessedItems: make(map[string][]types.WriteRequest),
+	}
+	for table, requests := range params.RequestItems {
+		if len(requests) > 25 {
+			return nil, errors.New("fake dynamodb: too many items written")
+		}
+		for _, request := range requests {
+			var key string
+			switch {
+			case request.PutRequest != nil:
+				key = keyOf(request.PutRequest.Item)
+			case request.DeleteRequest != nil:
+				key = keyOf(request.DeleteRequest.Key)
+			default:
+				return nil, errors.New("fake dynamodb: empty write request")
+			}
+
+			if f.Unprocessed[key] {
+				out.UnprocessedItems[table] = append(out.UnprocessedItems[table], request)
+				continue
+			}
+			if request.PutRequest != nil {
+				f.Items[key] = request.PutRequest.Item
+			} else {
+				delete(f.Items, key)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// Scan returns the items ordered by primary key, honoring Limit and
+// ExclusiveStartKey.
+func (f *FakeDynamoDB) Scan(ctx context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if err := f.record(ctx, "Scan"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.Items))
+	for key := range f.Items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if params.ExclusiveStartKey != nil {
+		startKey := keyOf(params.ExclusiveStartKey)
+		start = sort.SearchStrings(keys, startKey)
+		if start < len(keys) && keys[start] == startKey {
+			start++
+		}
+	}
+
+	// The limit applies to the scanned items, before filtering.
+	out := &dynamodb.ScanOutput{}
+	for i, key := range keys[start:] {
+		if params.Limit != nil && i == int(*params.Limit) {
+			out.LastEvaluatedKey = map[string]types.AttributeValue{
+				KeyName: &types.AttributeValueMemberS{Value: keys[start+i-1]},
+			}
+			break
+		}
+		out.ScannedCount++
+
+		item := f.Items[key]
+		if params.FilterExpression != nil {
+			filter := newExpression(*params.FilterExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues)
+			ok, err := filter.evaluate(item)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		out.Items = append(out.Items, project(item, params.ProjectionExpression, params.ExpressionAttributeNames))
+	}
+	out.Count = int32(len(out.Items))
+
+	return out, nil
+}
+
+// Query returns the items ordered by primary key which match the key
+// condition and the filter expressions, honoring Limit.
+//
+// The queried index is ignored, so an index key condition is evaluated
+// against the whole table, as for a global secondary index projecting
+// every attribute.
+func (f *FakeDynamoDB) Query(ctx context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if err := f.record(ctx, "Query"); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.Items))
+	for key := range f.Items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := &dynamodb.QueryOutput{}
+	var lastKey string
+	for _, key := range keys {
+		if params.Limit != nil && len(out.Items) == int(*params.Limit) {
+			out.LastEvaluatedKey = map[string]types.AttributeValue{
+				KeyName: &types.AttributeValueMemberS{Value: lastKey},
+			}
+			break
+		}
+
+		item := f.Items[key]
+		for _, condition := range []*string{params.KeyConditionExpression, params.FilterExpression} {
+			if condition == nil || item == nil {
+				continue
+			}
+			ok, err := newExpression(*condition, params.ExpressionAttributeNames, params.ExpressionAttributeValues).evaluate(item)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				item = nil
+			}
+		}
+		if item == nil {
+			continue
+		}
+
+		lastKey = key
+		out.Items = append(out.Items, project(item, params.ProjectionExpression, params.ExpressionAttributeNames))
+	}
+	out.Count = int32(len(out.Items))
+	out.ScannedCount = out.Count
+
+	return out, nil
+}
+
+// check evaluates a condition expression against an item, failing with
+// a ConditionalCheckFailedException when it is not met.
+func (f *FakeDynamoDB) check(item map[string]types.AttributeValue, condition *string, names map[string]string, values map[string]types.AttributeValue) error {
+	if condition == nil {
+		return nil
+	}
+
+	ok, err := newExpression(*condition, names, values).evaluate(item)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+	}
+	return nil
+}
+
+// record increments the call counter of an operation and returns the
+// error it should fail with. Like the client, the operation fails with
+// the error of ctx once it is done.
+func (f *FakeDynamoDB) record(ctx context.Context, operation string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls[operation]++
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return f.Errs[operation]
+}
+
+// keyOf returns the primary key value of an item.
+//
+// The items without a KeyName, such as the email claims of another table,
+// are keyed by their EmailKeyName.
+func keyOf(item map[string]types.AttributeValue) string {
+	if key, ok := item[KeyName].(*types.AttributeValueMemberS); ok {
+		return key.Value
+	}
+	if key, ok := item[EmailKeyName].(*types.AttributeValueMemberS); ok {
+		return key.Value
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsupport
+
+import "time"
+
+// EventuallyInterval is the delay between the calls of Eventually.
+var EventuallyInterval = 50 * time.Millisecond
+
+// Eventually calls fn until it succeeds, or the timeout elapses. It
+// returns the last error of fn, or nil once fn succeeded.
+//
+// It lets read-after-write tests tolerate the eventual consistency of
+// DynamoDB, such as the reads of a global secondary index.
+func Eventually(timeout time.Duration, fn func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := fn()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(EventuallyInterval)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsupport
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventually(t *testing.T) {
+	errAbsent := errors.New("value is not present yet")
+
+	// present appears after the delay.
+	present := func(delay time.Duration) func() error {
+		start := time.Now()
+		return func() error {
+			if time.Since(start) < delay {
+				return errAbsent
+			}
+			return nil
+		}
+	}
+
+	if err := Eventually(time.Second, present(120*time.Millisecond)); err != nil {
+		t.Errorf("unexpected error for a value appearing before the timeout: %v", err)
+	}
+	if err := Eventually(100*time.Millisecond, present(time.Minute)); err != errAbsent {
+		t.Errorf("unexpected error for a value appearing after the timeout: got %v, want %v", err, errAbsent)
+	}
+
+	var calls int32
+	err := Eventually(time.Second, func() error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("expected a single call for a present value, got %d calls and %v", calls, err)
+	}
+}
@@ -0,0 +1,562 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testsupport
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// expression evaluates the DynamoDB expressions built by the expression
+// package against an item.
+//
+// Only top-level attributes are supported.
+type expression struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+	tokens []string
+	pos    int
+}
+
+// newExpression tokenizes an expression with its placeholders.
+func newExpression(s string, names map[string]string, values map[string]types.AttributeValue) *expression {
+	return &expression{names: names, values: values, tokens: tokenize(s)}
+}
+
+// tokenize splits an expression into placeholders, keywords and symbols.
+func tokenize(s string) []string {
+	var tokens []string
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("(),+-", c):
+			tokens = append(tokens, string(c))
+			i++
+		case strings.ContainsRune("<>=", c):
+			j := i + 1
+			for j < len(s) && strings.ContainsRune("<>=", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(s) && !unicode.IsSpace(rune(s[j])) && !strings.ContainsRune("(),<>=+-", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+func (e *expression) peek() string {
+	if e.pos < len(e.tokens) {
+		return e.tokens[e.pos]
+	}
+	return ""
+}
+
+func (e *expression) next() string {
+	token := e.peek()
+	e.pos++
+	return token
+}
+
+func (e *expression) expect(token string) error {
+	if got := e.next(); got != token {
+		return fmt.Errorf("fake dynamodb: expected %q, got %q", token, got)
+	}
+	return nil
+}
+
+// name resolves an attribute name placeholder.
+func (e *expression) name(token string) (string, error) {
+	if name, ok := e.names[token]; ok {
+		return name, nil
+	}
+	if strings.HasPrefix(token, "#") {
+		return "", fmt.Errorf("fake dynamodb: unknown name %s", token)
+	}
+	return token, nil
+}
+
+// evaluate evaluates a condition or filter expression against an item.
+func (e *expression) evaluate(item map[string]types.AttributeValue) (bool, error) {
+	ok, err := e.or(item)
+	if err != nil {
+		return false, err
+	}
+	if e.pos != len(e.tokens) {
+		return false, fmt.Errorf("fake dynamodb: unexpected %q", e.peek())
+	}
+	return ok, nil
+}
+
+func (e *expression) or(item map[string]types.AttributeValue) (bool, error) {
+	ok, err := e.and(item)
+	for err == nil && e.peek() == "OR" {
+		e.next()
+		var right bool
+		right, err = e.and(item)
+		ok = ok || right
+	}
+	return ok, err
+}
+
+func (e *expression) and(item map[string]types.AttributeValue) (bool, error) {
+	ok, err := e.not(item)
+	for err == nil && e.peek() == "AND" {
+		e.next()
+		var right bool
+		right, err = e.not(item)
+		ok = ok && right
+	}
+	return ok, err
+}
+
+func (e *expression) not(item map[string]types.AttributeValue) (bool, error) {
+	if e.peek() == "NOT" {
+		e.next()
+		ok, err := e.not(item)
+		return !ok, err
+	}
+	return e.primary(item)
+}
+
+func (e *expression) primary(item map[string]types.AttributeValue) (bool, error) {
+	switch token := e.peek(); token {
+	case "(":
+		e.next()
+		ok, err := e.or(item)
+		if err != nil {
+			return false, err
+		}
+		return ok, e.expect(")")
+	case "attribute_exists", "attribute_not_exists", "begins_with", "contains":
+		e.next()
+		args, err := e.arguments(item)
+		if err != nil {
+			return false, err
+		}
+		return function(token, args)
+	}
+
+	left, err := e.operand(item)
+	if err != nil {
+		return false, err
+	}
+
+	switch comparator := e.next(); comparator {
+	case "IN":
+		list, err := e.arguments(item)
+		if err != nil {
+			return false, err
+		}
+		for _, candidate := range list {
+			if equal(left, candidate) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "BETWEEN":
+		low, err := e.operand(item)
+		if err != nil {
+			return false, err
+		}
+		if err = e.expect("AND"); err != nil {
+			return false, err
+		}
+		high, err := e.operand(item)
+		if err != nil {
+			return false, err
+		}
+		return compare(left, low) >= 0 && compare(left, high) <= 0, nil
+	case "=", "<>", "<", "<=", ">", ">=":
+		right, err := e.operand(item)
+		if err != nil {
+			return false, err
+		}
+		if left == nil || right == nil {
+			return comparator == "<>" && (left != nil || right != nil), nil
+		}
+		switch comparator {
+		case "=":
+			return equal(left, right), nil
+		case "<>":
+			return !equal(left, right), nil
+		case "<":
+			return compare(left, right) < 0, nil
+		case "<=":
+			return compare(left, right) <= 0, nil
+		case ">":
+			return compare(left, right) > 0, nil
+		default:
+			return compare(left, right) >= 0, nil
+		}
+	default:
+		return false, fmt.Errorf("fake dynamodb: unsupported comparator %q", comparator)
+	}
+}
+
+// arguments reads a parenthesized list of operands. Names are passed as
+// their value in the item, or as a string holding the name when missing.
+func (e *expression) arguments(item map[string]types.AttributeValue) ([]types.AttributeValue, error) {
+	if err := e.expect("("); err != nil {
+		return nil, err
+	}
+
+	var args []types.AttributeValue
+	for {
+		token := e.peek()
+		switch {
+		case token == "list_append" || token == "if_not_exists":
+			// The functions of SET values may be nested.
+			arg, err := e.setValue(item)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		case strings.HasPrefix(token, "#"):
+			name, err := e.name(e.next())
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, &pathValue{name: name, value: item[name]})
+		default:
+			arg, err := e.operand(item)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+
+		switch e.next() {
+		case ",":
+		case ")":
+			return args, nil
+		default:
+			return nil, fmt.Errorf("fake dynamodb: malformed argument list")
+		}
+	}
+}
+
+// operand resolves a name, a value or a size function into a value.
+func (e *expression) operand(item map[string]types.AttributeValue) (types.AttributeValue, error) {
+	token := e.next()
+	switch {
+	case token == "size":
+		args, err := e.arguments(item)
+		if err != nil || len(args) != 1 {
+			return nil, fmt.Errorf("fake dynamodb: malformed size")
+		}
+		return &types.AttributeValueMemberN{Value: strconv.Itoa(size(resolve(args[0])))}, nil
+	case strings.HasPrefix(token, ":"):
+		value, ok := e.values[token]
+		if !ok {
+			return nil, fmt.Errorf("fake dynamodb: unknown value %s", token)
+		}
+		return value, nil
+	default:
+		name, err := e.name(token)
+		if err != nil {
+			return nil, err
+		}
+		return item[name], nil
+	}
+}
+
+// update applies an update expression to an item.
+func (e *expression) update(item map[string]types.AttributeValue) error {
+	for e.pos < len(e.tokens) {
+		action := e.next()
+		for {
+			name, err := e.name(e.next())
+			if err != nil {
+				return err
+			}
+
+			switch action {
+			case "SET":
+				if err = e.expect("="); err != nil {
+					return err
+				}
+				value, err := e.setValue(item)
+				if err != nil {
+					return err
+				}
+				item[name] = value
+			case "ADD":
+				value, err := e.operand(item)
+				if err != nil {
+					return err
+				}
+				sum, err := add(item[name], value)
+				if err != nil {
+					return err
+				}
+				item[name] = sum
+			case "REMOVE":
+				delete(item, name)
+			default:
+				return fmt.Errorf("fake dynamodb: unsupported update action %q", action)
+			}
+
+			if e.peek() != "," {
+				break
+			}
+			e.next()
+		}
+	}
+	return nil
+}
+
+// setValue reads the value of a SET action, supporting additions and
+// the list_append and if_not_exists functions.
+func (e *expression) setValue(item map[string]types.AttributeValue) (types.AttributeValue, error) {
+	var value types.AttributeValue
+	var err error
+	switch token := e.peek(); token {
+	case "list_append", "if_not_exists":
+		e.next()
+		args, err := e.arguments(item)
+		if err != nil || len(args) != 2 {
+			return nil, fmt.Errorf("fake dynamodb: malformed %s", token)
+		}
+		first, second := resolve(args[0]), resolve(args[1])
+		if token == "if_not_exists" {
+			if first != nil {
+				value = first
+			} else {
+				value = second
+			}
+		} else {
+			var list []types.AttributeValue
+			if l, ok := first.(*types.AttributeValueMemberL); ok {
+				list = append(list, l.Value...)
+			}
+			if l, ok := second.(*types.AttributeValueMemberL); ok {
+				list = append(list, l.Value...)
+			}
+			value = &types.AttributeValueMemberL{Value: list}
+		}
+	default:
+		if value, err = e.operand(item); err != nil {
+			return nil, err
+		}
+	}
+
+	switch e.peek() {
+	case "+", "-":
+		operator := e.next()
+		right, err := e.operand(item)
+		if err != nil {
+			return nil, err
+		}
+		if operator == "-" {
+			right = &types.AttributeValueMemberN{Value: negate(right)}
+		}
+		return add(value, right)
+	}
+	return value, nil
+}
+
+// pathValue is an attribute passed by name to a function.
+type pathValue struct {
+	types.AttributeValueMemberNULL
+	name  string
+	value types.AttributeValue
+}
+
+// resolve returns the value of an attribute passed by name.
+func resolve(av types.AttributeValue) types.AttributeValue {
+	if path, ok := av.(*pathValue); ok {
+		return path.value
+	}
+	return av
+}
+
+func function(name string, args []types.AttributeValue) (bool, error) {
+	switch name {
+	case "attribute_exists":
+		return len(args) == 1 && resolve(args[0]) != nil, nil
+	case "attribute_not_exists":
+		return len(args) == 1 && resolve(args[0]) == nil, nil
+	}
+
+	if len(args) != 2 {
+		return false, fmt.Errorf("fake dynamodb: malformed %s", name)
+	}
+	subject, operand := resolve(args[0]), resolve(args[1])
+
+	switch name {
+	case "begins_with":
+		s, ok1 := subject.(*types.AttributeValueMemberS)
+		prefix, ok2 := operand.(*types.AttributeValueMemberS)
+		return ok1 && ok2 && strings.HasPrefix(s.Value, prefix.Value), nil
+	default:
+		switch s := subject.(type) {
+		case *types.AttributeValueMemberS:
+			sub, ok := operand.(*types.AttributeValueMemberS)
+			return ok && strings.Contains(s.Value, sub.Value), nil
+		case *types.AttributeValueMemberL:
+			for _, element := range s.Value {
+				if equal(element, operand) {
+					return true, nil
+				}
+			}
+		case *types.AttributeValueMemberSS:
+			if sub, ok := operand.(*types.AttributeValueMemberS); ok {
+				for _, element := range s.Value {
+					if element == sub.Value {
+						return true, nil
+					}
+				}
+			}
+		}
+		return false, nil
+	}
+}
+
+func equal(a, b types.AttributeValue) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if an, ok := a.(*types.AttributeValueMemberN); ok {
+		if bn, ok := b.(*types.AttributeValueMemberN); ok {
+			return compare(an, bn) == 0
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// compare orders two numbers or two strings.
+func compare(a, b types.AttributeValue) int {
+	switch av := a.(type) {
+	case *types.AttributeValueMemberN:
+		bv, ok := b.(*types.AttributeValueMemberN)
+		if !ok {
+			return -1
+		}
+		x, _ := strconv.ParseFloat(av.Value, 64)
+		y, _ := strconv.ParseFloat(bv.Value, 64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case *types.AttributeValueMemberS:
+		bv, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return -1
+		}
+		return strings.Compare(av.Value, bv.Value)
+	}
+	return -1
+}
+
+func size(av types.AttributeValue) int {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberL:
+		return len(v.Value)
+	case *types.AttributeValueMemberM:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		return len(v.Value)
+	case *types.AttributeValueMemberNS:
+		return len(v.Value)
+	}
+	return 0
+}
+
+// add adds a number to a number, or a set to a set. A missing attribute
+// is created.
+func add(current, delta types.AttributeValue) (types.AttributeValue, error) {
+	switch d := delta.(type) {
+	case *types.AttributeValueMemberN:
+		sum, _ := strconv.ParseInt(d.Value, 10, 64)
+		if c, ok := current.(*types.AttributeValueMemberN); ok {
+			value, err := strconv.ParseInt(c.Value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("fake dynamodb: only integers can be added")
+			}
+			sum += value
+		} else if current != nil {
+			return nil, fmt.Errorf("fake dynamodb: type mismatch in addition")
+		}
+		return &types.AttributeValueMemberN{Value: strconv.FormatInt(sum, 10)}, nil
+	case *types.AttributeValueMemberSS:
+		set := &types.AttributeValueMemberSS{}
+		if c, ok := current.(*types.AttributeValueMemberSS); ok {
+			set.Value = append(set.Value, c.Value...)
+		}
+		for _, value := range d.Value {
+			found := false
+			for _, existing := range set.Value {
+				found = found || existing == value
+			}
+			if !found {
+				set.Value = append(set.Value, value)
+			}
+		}
+		return set, nil
+	}
+	return nil, fmt.Errorf("fake dynamodb: unsupported addition of %T", delta)
+}
+
+func negate(av types.AttributeValue) string {
+	if n, ok := av.(*types.AttributeValueMemberN); ok {
+		if strings.HasPrefix(n.Value, "-") {
+			return n.Value[1:]
+		}
+		return "-" + n.Value
+	}
+	return "0"
+}
+
+// project keeps the attributes of a projection expression.
+func project(item map[string]types.AttributeValue, projection *string, names map[string]string) map[string]types.AttributeValue {
+	if projection == nil || item == nil {
+		return item
+	}
+
+	projected := make(map[string]types.AttributeValue)
+	for _, token := range strings.Split(*projection, ",") {
+		name := strings.TrimSpace(token)
+		if resolved, ok := names[name]; ok {
+			name = resolved
+		}
+		if value, ok := item[name]; ok {
+			projected[name] = value
+		}
+	}
+	return projected
+}
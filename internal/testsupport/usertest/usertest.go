@@ -0,0 +1,110 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package usertest builds valid users for the tests.
+//
+// It is apart from testsupport, which the tests of the user package
+// import, so that it can depend on the user package.
+package usertest
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// firstNames and lastNames are the names of the random users.
+var (
+	firstNames = []string{"John", "Jane", "Amelia", "Noah", "Olivia", "Liam", "Chloé", "Mateo"}
+	lastNames  = []string{"Doe", "Smith", "Tremblay", "Garcia", "Nguyen", "Martin", "Roy", "Brown"}
+)
+
+// countries are the countries of the random users: the countries of
+// user.DefaultRegions whose subdivisions are known, so their provinces can
+// be drawn.
+var countries = func() []string {
+	var codes []string
+	for code := range user.DefaultRegions {
+		if _, ok := validator.Subdivisions[code]; ok {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}()
+
+// Option overrides fields of a random user.
+type Option func(*user.User)
+
+// WithEmail sets the email of the user.
+func WithEmail(email string) Option {
+	return func(usr *user.User) {
+		usr.Email = email
+	}
+}
+
+// WithCountry sets the country and the province of the user, along with
+// the administrative division and the currency of the country.
+func WithCountry(country, province string) Option {
+	return func(usr *user.User) {
+		region := user.DefaultRegions[country]
+		usr.CountryCodeAlpha2 = country
+		usr.ProvinceCode = province
+		usr.AdministrativeDivision = ""
+		if len(region.AdministrativeDivisions) > 0 {
+			usr.AdministrativeDivision = region.AdministrativeDivisions[0]
+		}
+		usr.Currency = region.Currency
+	}
+}
+
+// RandomUser returns a new user with random values, which passes
+// user.ValidateUser, and then applies the options in order.
+//
+// The user has a unique id and email, a country of user.DefaultRegions
+// along with one of its provinces, and the administrative division and
+// the currency of the country. Its date of birth is between 18 and 80
+// years ago.
+func RandomUser(opts ...Option) *user.User {
+	id := uuid.New().String()
+	country := countries[rand.Intn(len(countries))]
+	provinces := validator.Subdivisions[country]
+	firstName := firstNames[rand.Intn(len(firstNames))]
+	now := time.Now().UTC()
+
+	usr := &user.User{
+		ID:          id,
+		Email:       fmt.Sprintf("user-%s@example.com", id),
+		FirstName:   firstName,
+		LastName:    lastNames[rand.Intn(len(lastNames))],
+		DateOfBirth: now.AddDate(-18-rand.Intn(62), 0, -rand.Intn(365)).Format("2006-01-02"),
+		CreatedAt:   now.Format("2006-01-02"),
+		Version:     1,
+	}
+	WithCountry(country, provinces[rand.Intn(len(provinces))])(usr)
+	usr.Income = user.MinorUnits(rand.Int63n(20_000_000), usr.Currency)
+
+	for _, opt := range opts {
+		opt(usr)
+	}
+
+	return usr
+}
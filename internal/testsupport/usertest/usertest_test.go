@@ -0,0 +1,68 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package usertest
+
+import (
+	"testing"
+
+	"user-service.mykapital.io/internal/user"
+	"user-service.mykapital.io/internal/validator"
+)
+
+func TestRandomUser(t *testing.T) {
+	emails := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		usr := RandomUser()
+
+		v := validator.New()
+		user.ValidateUser(v, usr)
+		if !v.Valid() || len(v.Warnings) > 0 {
+			t.Fatalf("invalid random user %+v: errors %v, warnings %v", usr, v.Errors, v.Warnings)
+		}
+		if emails[usr.Email] {
+			t.Fatalf("duplicate email %s", usr.Email)
+		}
+		emails[usr.Email] = true
+	}
+}
+
+func TestRandomUserOptions(t *testing.T) {
+	usr := RandomUser(
+		WithEmail("jane.doe@example.com"),
+		WithCountry("US", "TX"),
+		func(usr *user.User) { usr.FirstName = "Jane" },
+	)
+
+	if usr.Email != "jane.doe@example.com" || usr.FirstName != "Jane" {
+		t.Errorf("unexpected user: got %s %s", usr.FirstName, usr.Email)
+	}
+	if usr.CountryCodeAlpha2 != "US" || usr.ProvinceCode != "TX" || usr.AdministrativeDivision != "state" || usr.Currency != "USD" {
+		t.Errorf("unexpected region: got %s, %s, %s in %s", usr.ProvinceCode, usr.CountryCodeAlpha2, usr.AdministrativeDivision, usr.Currency)
+	}
+
+	v := validator.New()
+	user.ValidateUser(v, usr)
+	if !v.Valid() {
+		t.Errorf("unexpected errors: %v", v.Errors)
+	}
+
+	// The options apply in order.
+	usr = RandomUser(WithEmail("first@example.com"), WithEmail("second@example.com"))
+	if usr.Email != "second@example.com" {
+		t.Errorf("unexpected email: got %s, want second@example.com", usr.Email)
+	}
+}
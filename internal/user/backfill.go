@@ -0,0 +1,175 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	xerrors "user-service.mykapital.io/internal/errors"
+)
+
+// NormalizeEmail returns the form of the email address used as the key
+// of the email index.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// BackfillReport counts the users visited by a backfill.
+type BackfillReport struct {
+	// Updated is the number of users whose index key was populated.
+	Updated int
+	// Populated is the number of users whose index key was already populated.
+	Populated int
+	// Skipped is the number of users without an email, modified during
+	// the backfill, or whose normalized email is claimed by another user.
+	Skipped int
+	// LastID is the id of the last visited user. The backfill is resumed
+	// by starting after it.
+	LastID string
+}
+
+// BackfillEmailIndex populates the email index key of the users stored
+// before emails were normalized.
+//
+// The table is scanned after the user startAfter (from the start when
+// empty), and every email which is not normalized is replaced by its
+// normalized form with an update conditioned on the version read, and
+// incrementing it like Update, so concurrent changes are never
+// overwritten and the clients holding the user see it changed. With an
+// EmailTableName, the normalized email is claimed and the previous one
+// released in the same transaction, like Update, and the users whose
+// normalized email is claimed by another user are skipped.
+//
+// Nothing is written during a dry run. The report is passed to progress
+// after every page, so an interrupted backfill can be resumed from its
+// LastID.
+func (m Model) BackfillEmailIndex(ctx context.Context, startAfter string, dryRun bool, progress func(BackfillReport)) (BackfillReport, error) {
+	var report BackfillReport
+
+	proj := expression.NamesList(expression.Name("userID"), expression.Name("email"), expression.Name("version"))
+	expr, err := expression.NewBuilder().WithProjection(proj).Build()
+	if err != nil {
+		return report, fmt.Errorf("couldn't build expression for backfill. Here's why: %v", err)
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(m.TableName),
+		ProjectionExpression:     expr.Projection(),
+		ExpressionAttributeNames: expr.Names(),
+	}
+	if startAfter != "" {
+		input.ExclusiveStartKey = User{ID: startAfter}.GetKey()
+	}
+
+	paginator := dynamodb.NewScanPaginator(m.DynamoDbClient, input)
+	for paginator.HasMorePages() {
+		page, err := m.nextPage(ctx, paginator)
+		if err != nil {
+			return report, fmt.Errorf("couldn't scan table %v. Here's why: %v", m.TableName, err)
+		}
+
+		for _, item := range page.Items {
+			var user User
+			if err = attributevalue.UnmarshalMap(item, &user); err != nil {
+				return report, fmt.Errorf("couldn't unmarshal scan response. Here's why: %v", err)
+			}
+			report.LastID = user.ID
+
+			normalized := NormalizeEmail(user.Email)
+			switch {
+			case user.Email == "":
+				report.Skipped++
+			case user.Email == normalized:
+				report.Populated++
+			case dryRun:
+				report.Updated++
+			default:
+				err = m.replaceEmail(ctx, &user, normalized)
+				switch {
+				case errors.Is(err, xerrors.ErrConditionFailed), errors.Is(err, xerrors.ErrDuplicateEmail):
+					report.Skipped++
+				case err != nil:
+					return report, err
+				default:
+					report.Updated++
+				}
+			}
+		}
+
+		if progress != nil {
+			progress(report)
+		}
+	}
+
+	return report, nil
+}
+
+// replaceEmail sets the email of the user, on condition it is unchanged,
+// moving its claim with an EmailTableName.
+//
+// The users stored before the versions have none, and are matched as
+// version 0 whatever the VersionGrace of the model.
+// xerrors.ErrConditionFailed is returned when the user changed, and
+// xerrors.ErrDuplicateEmail when another user claimed the email.
+func (m Model) replaceEmail(ctx context.Context, user *User, email string) error {
+	m.VersionGrace = true
+	update := expression.Set(expression.Name("email"), expression.Value(email)).
+		Set(expression.Name("version"), expression.Value(user.Version+1))
+	condition := m.versionCondition(user.Version)
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("couldn't build expression for backfill. Here's why: %v", err)
+	}
+
+	if m.EmailTableName != "" {
+		return claimError(m.Transact(ctx,
+			UpdateOp(user.GetKey(), update).If(condition),
+			m.claimOp(&User{ID: user.ID, Email: email}),
+			m.releaseOp(user.Email, user.ID),
+		))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.retry(ctx, func() error {
+		_, err := m.DynamoDbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(m.TableName),
+			Key:                       user.GetKey(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+		})
+		return err
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return xerrors.ErrConditionFailed
+	}
+	return err
+}
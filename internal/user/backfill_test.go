@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+func backfillFixtures() []User {
+	return []User{
+		{ID: "1", Email: "John.Doe@Example.com", Version: 3},
+		{ID: "2", Email: "jane.doe@example.com"},
+		{ID: "3", Email: ""},
+		{ID: "4", Email: " MARY@example.com "},
+	}
+}
+
+func TestBackfillEmailIndex(t *testing.T) {
+	model, fake := newFakeModel(t, backfillFixtures()...)
+
+	var pages int
+	report, err := model.BackfillEmailIndex(context.Background(), "", false, func(BackfillReport) { pages++ })
+	if err != nil {
+		t.Fatalf("failed to backfill: %v", err)
+	}
+
+	expected := BackfillReport{Updated: 2, Populated: 1, Skipped: 1, LastID: "4"}
+	if report != expected {
+		t.Errorf("unexpected report: got %+v, want %+v", report, expected)
+	}
+	if pages == 0 {
+		t.Errorf("progress was never reported")
+	}
+
+	for id, email := range map[string]string{"1": "john.doe@example.com", "4": "mary@example.com"} {
+		stored := fake.Items[id]["email"].(*types.AttributeValueMemberS).Value
+		if stored != email {
+			t.Errorf("unexpected email of %s: got '%s', want '%s'", id, stored, email)
+		}
+	}
+	for id, version := range map[string]string{"1": "4", "4": "1"} {
+		stored := fake.Items[id]["version"].(*types.AttributeValueMemberN).Value
+		if stored != version {
+			t.Errorf("unexpected version of %s: got %s, want %s", id, stored, version)
+		}
+	}
+}
+
+// bumpingTable changes the version of the users before every update, as
+// a concurrent update would.
+type bumpingTable struct {
+	*testsupport.FakeDynamoDB
+}
+
+func (b bumpingTable) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	id := params.Key["userID"].(*types.AttributeValueMemberS).Value
+	b.Items[id]["version"] = &types.AttributeValueMemberN{Value: "9"}
+	return b.FakeDynamoDB.UpdateItem(ctx, params, optFns...)
+}
+
+func TestBackfillEmailIndexConcurrentUpdate(t *testing.T) {
+	model, fake := newFakeModel(t, backfillFixtures()...)
+	model.DynamoDbClient = bumpingTable{FakeDynamoDB: fake}
+
+	report, err := model.BackfillEmailIndex(context.Background(), "", false, nil)
+	if err != nil {
+		t.Fatalf("failed to backfill: %v", err)
+	}
+
+	expected := BackfillReport{Updated: 0, Populated: 1, Skipped: 3, LastID: "4"}
+	if report != expected {
+		t.Errorf("unexpected report: got %+v, want %+v", report, expected)
+	}
+	if stored := fake.Items["1"]["email"].(*types.AttributeValueMemberS).Value; stored != "John.Doe@Example.com" {
+		t.Errorf("the concurrent update was overwritten: got '%s'", stored)
+	}
+}
+
+func TestBackfillEmailIndexDryRunResumed(t *testing.T) {
+	model, fake := newFakeModel(t, backfillFixtures()...)
+
+	report, err := model.BackfillEmailIndex(context.Background(), "2", true, nil)
+	if err != nil {
+		t.Fatalf("failed to backfill: %v", err)
+	}
+
+	expected := BackfillReport{Updated: 1, Populated: 0, Skipped: 1, LastID: "4"}
+	if report != expected {
+		t.Errorf("unexpected report: got %+v, want %+v", report, expected)
+	}
+	if calls := fake.CallCount("UpdateItem"); calls != 0 {
+		t.Errorf("dry run wrote %d items", calls)
+	}
+}
+
+func TestBackfillEmailIndexClaims(t *testing.T) {
+	model, fake := newFakeModel(t,
+		User{ID: "1", Email: "John.Doe@Example.com", Version: 3},
+		User{ID: "4", Email: " MARY@example.com "},
+	)
+	model.EmailTableName = "UserEmail"
+	for _, claim := range []emailClaim{{Email: "John.Doe@Example.com", Owner: "1"}, {Email: "mary@example.com", Owner: "2"}} {
+		item, err := attributevalue.MarshalMap(claim)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fake.Put(item)
+	}
+
+	if _, err := model.BackfillEmailIndex(context.Background(), "", false, nil); err != nil {
+		t.Fatalf("failed to backfill: %v", err)
+	}
+
+	if owner := claimOwner(t, fake, "john.doe@example.com"); owner != "1" {
+		t.Errorf("unexpected owner of the normalized email: got '%s', want '1'", owner)
+	}
+	if owner := claimOwner(t, fake, "John.Doe@Example.com"); owner != "" {
+		t.Errorf("the previous email is still claimed by '%s'", owner)
+	}
+	// The normalized email of 4 is claimed by another user.
+	if stored := fake.Items["4"]["email"].(*types.AttributeValueMemberS).Value; stored != " MARY@example.com " {
+		t.Errorf("unexpected email of 4: got '%s', want ' MARY@example.com '", stored)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	xerrors "user-service.mykapital.io/internal/errors"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// GetBatcher coalesces the concurrent Get calls of a Model into BatchGet
+// calls, to reduce the number of requests under read-heavy bursts.
+//
+// The ids requested within Window of the first one are fetched together,
+// unless MaxSize ids are requested sooner. A GetBatcher must only serve a
+// single Model.
+type GetBatcher struct {
+	// Window is how long a batch waits for more ids.
+	Window time.Duration
+	// MaxSize is the number of ids sending a batch before the end of its
+	// window. It is capped to MaxBatchGetKeys.
+	MaxSize int
+
+	mu      sync.Mutex
+	pending *getBatch
+}
+
+// getBatch is a set of ids fetched together.
+type getBatch struct {
+	ids  []string
+	seen map[string]bool
+	// done is closed once users and err are set.
+	done  chan struct{}
+	users map[string]*User
+	err   error
+}
+
+// get adds the id to the pending batch, and waits for the batch to be
+// fetched with m, or for ctx to be done.
+//
+// The batch is shared by several callers, so it isn't canceled along with
+// ctx, and is fetched within the default timeout of each of its requests.
+func (b *GetBatcher) get(ctx context.Context, m Model, id string) (*User, error) {
+	maxSize := b.MaxSize
+	if maxSize <= 0 || maxSize > MaxBatchGetKeys {
+		maxSize = MaxBatchGetKeys
+	}
+
+	b.mu.Lock()
+	batch := b.pending
+	if batch == nil {
+		batch = &getBatch{seen: make(map[string]bool), done: make(chan struct{})}
+		b.pending = batch
+		time.AfterFunc(b.Window, func() {
+			if b.detach(batch) {
+				batch.fetch(m)
+			}
+		})
+	}
+	if !batch.seen[id] {
+		batch.seen[id] = true
+		batch.ids = append(batch.ids, id)
+	}
+	if len(batch.ids) >= maxSize {
+		b.pending = nil
+		go batch.fetch(m)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if batch.err != nil && !batch.fetched(id) {
+		return nil, batch.err
+	}
+
+	user, ok := batch.users[id]
+	if !ok {
+		return nil, xerrors.ErrRecordNotFound
+	}
+
+	return user, nil
+}
+
+// detach removes the batch from pending, and reports whether it was still
+// pending.
+func (b *GetBatcher) detach(batch *getBatch) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending != batch {
+		return false
+	}
+	b.pending = nil
+
+	return true
+}
+
+// fetched reports whether the id was fetched, even though the batch
+// failed partially.
+func (batch *getBatch) fetched(id string) bool {
+	var batchErr *xerrors.BatchError
+	if batch.users == nil || !errors.As(batch.err, &batchErr) {
+		return false
+	}
+
+	return !validator.In(id, batchErr.IDs...)
+}
+
+// fetch gets the users of the batch with m, and wakes up its callers.
+func (batch *getBatch) fetch(m Model) {
+	// Like get, the batch gets the soft-deleted users as well, which Get
+	// then leaves out.
+	m.IncludeDeleted = true
+	batch.users, batch.err = m.BatchGet(context.Background(), batch.ids)
+	close(batch.done)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	xerrors "user-service.mykapital.io/internal/errors"
+)
+
+func TestGetBatcher(t *testing.T) {
+	var users []User
+	for i := 0; i < 50; i += 2 {
+		users = append(users, User{ID: fmt.Sprintf("%d", i), FirstName: "John"})
+	}
+	model, fake := newFakeModel(t, users...)
+	model.Batcher = &GetBatcher{Window: 20 * time.Millisecond, MaxSize: 100}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			usr, err := model.Get(context.Background(), fmt.Sprintf("%d", i))
+			switch {
+			case i%2 == 1 && err != xerrors.ErrRecordNotFound:
+				errs <- fmt.Errorf("user %d: unexpected error for a missing user: %v", i, err)
+			case i%2 == 0 && err != nil:
+				errs <- err
+			case i%2 == 0 && usr.FirstName != "John":
+				errs <- fmt.Errorf("user %d: unexpected user %+v", i, usr)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if calls := fake.CallCount("GetItem"); calls != 0 {
+		t.Errorf("unexpected GetItem calls: got %d, want 0", calls)
+	}
+	if calls := fake.CallCount("BatchGetItem"); calls == 0 || calls > 5 {
+		t.Errorf("unexpected BatchGetItem calls: got %d, want between 1 and 5", calls)
+	}
+}
+
+func TestGetBatcherMaxSize(t *testing.T) {
+	model, fake := newFakeModel(t)
+	// The window is long enough for the batches to be sent by their size.
+	model.Batcher = &GetBatcher{Window: time.Minute, MaxSize: 5}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if _, err := model.Get(context.Background(), fmt.Sprintf("%d", i)); err != xerrors.ErrRecordNotFound {
+				t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrRecordNotFound)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if calls := fake.CallCount("BatchGetItem"); calls != 2 {
+		t.Errorf("unexpected BatchGetItem calls: got %d, want 2", calls)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Buckets are the ascending lower bounds of ranges of values, used to
+// report a value without its precise amount.
+//
+// The bounds 18 and 25 make the ranges "<18", "18-24" and "25+".
+type Buckets []int64
+
+// AgeBuckets are the ranges of ages used by AgeBucket.
+var AgeBuckets = Buckets{18, 25, 35, 45, 55, 65}
+
+// IncomeBuckets are the ranges of incomes used by IncomeBucket, in whole
+// units of currency.
+var IncomeBuckets = Buckets{0, 25000, 50000, 75000, 100000, 150000, 250000}
+
+// ParseBuckets parses comma-separated ascending bounds, such as
+// "18,25,35".
+func ParseBuckets(s string) (Buckets, error) {
+	var buckets Buckets
+	for _, field := range strings.Split(s, ",") {
+		bound, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			return nil, errors.New("bucket bounds must be integers")
+		}
+		if len(buckets) > 0 && bound <= buckets[len(buckets)-1] {
+			return nil, errors.New("bucket bounds must be ascending")
+		}
+		buckets = append(buckets, bound)
+	}
+
+	return buckets, nil
+}
+
+// Label returns the label of the range of the value, or an empty string
+// when there are no buckets.
+func (b Buckets) Label(value int64) string {
+	if len(b) == 0 {
+		return ""
+	}
+	if value < b[0] {
+		return "<" + strconv.FormatInt(b[0], 10)
+	}
+
+	for i := 1; i < len(b); i++ {
+		if value < b[i] {
+			return strconv.FormatInt(b[i-1], 10) + "-" + strconv.FormatInt(b[i]-1, 10)
+		}
+	}
+
+	return strconv.FormatInt(b[len(b)-1], 10) + "+"
+}
+
+// AgeBucket returns the range of the age of a user born on dob, formatted
+// as "2006-01-02", following AgeBuckets. It is empty when dob is missing
+// or invalid.
+func AgeBucket(dob string, now time.Time) string {
+	age, ok := ageAt(dob, now)
+	if !ok {
+		return ""
+	}
+
+	return AgeBuckets.Label(int64(age))
+}
+
+// ageAt returns the age at now of a user born on dob, formatted as
+// "2006-01-02". It is not ok when dob is missing or invalid.
+func ageAt(dob string, now time.Time) (int, bool) {
+	birth, err := time.Parse("2006-01-02", dob)
+	if err != nil {
+		return 0, false
+	}
+
+	age := now.Year() - birth.Year()
+	if !birthdayPassed(birth, now) {
+		age--
+	}
+
+	return age, true
+}
+
+// birthdayPassed reports whether the birthday is reached in the year of
+// now.
+func birthdayPassed(birth, now time.Time) bool {
+	if now.Month() != birth.Month() {
+		return now.Month() > birth.Month()
+	}
+	return now.Day() >= birth.Day()
+}
+
+// IncomeBucket returns the range of the income amount, in whole units of
+// currency, following IncomeBuckets.
+func IncomeBucket(amount int64) string {
+	return IncomeBuckets.Label(amount)
+}
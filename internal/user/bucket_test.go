@@ -0,0 +1,112 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgeBucket(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		dob      string
+		expected string
+	}{
+		`17, the day before 18`: {dob: "2005-03-02", expected: "<18"},
+		`18 on the birthday`:    {dob: "2005-03-01", expected: "18-24"},
+		`24`:                    {dob: "1998-03-02", expected: "18-24"},
+		`25`:                    {dob: "1998-03-01", expected: "25-34"},
+		`64`:                    {dob: "1958-12-31", expected: "55-64"},
+		`65`:                    {dob: "1958-01-01", expected: "65+"},
+		`missing`:               {dob: "", expected: ""},
+		`invalid`:               {dob: "01/03/1990", expected: ""},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := AgeBucket(tt.dob, now); got != tt.expected {
+				t.Errorf("unexpected bucket: got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAgeAt(t *testing.T) {
+	tests := map[string]struct {
+		dob      string
+		now      time.Time
+		expected int
+		ok       bool
+	}{
+		`birthday passed`:                 {dob: "1990-01-15", now: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), expected: 33, ok: true},
+		`birthday not yet this year`:      {dob: "1990-12-15", now: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), expected: 32, ok: true},
+		`leap day on a leap year`:         {dob: "2000-02-29", now: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), expected: 24, ok: true},
+		`leap day, february 28`:           {dob: "2000-02-29", now: time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC), expected: 22, ok: true},
+		`leap day, march 1`:               {dob: "2000-02-29", now: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), expected: 23, ok: true},
+		`february 28 on a leap year`:      {dob: "2001-02-28", now: time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC), expected: 23, ok: true},
+		`missing date of birth`:           {dob: "", now: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+		`date of birth in another format`: {dob: "29/02/2000", now: time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			age, ok := ageAt(tt.dob, tt.now)
+			if age != tt.expected || ok != tt.ok {
+				t.Errorf("unexpected age: got %d (%v), want %d (%v)", age, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIncomeBucket(t *testing.T) {
+	tests := map[string]struct {
+		amount   int64
+		expected string
+	}{
+		`negative`:          {amount: -1, expected: "<0"},
+		`zero`:              {amount: 0, expected: "0-24999"},
+		`below a bound`:     {amount: 24999, expected: "0-24999"},
+		`at a bound`:        {amount: 25000, expected: "25000-49999"},
+		`at the last bound`: {amount: 250000, expected: "250000+"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IncomeBucket(tt.amount); got != tt.expected {
+				t.Errorf("unexpected bucket: got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseBuckets(t *testing.T) {
+	buckets, err := ParseBuckets("18, 30,50")
+	if err != nil {
+		t.Fatalf("failed to parse buckets: %v", err)
+	}
+	if got := buckets.Label(30); got != "30-49" {
+		t.Errorf("unexpected label: got %q, want %q", got, "30-49")
+	}
+
+	for _, s := range []string{"18,18", "30,18", "18,thirty", ""} {
+		if _, err := ParseBuckets(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+}
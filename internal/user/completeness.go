@@ -0,0 +1,102 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Weights weigh the optional sections of a user in its completeness, by
+// the JSON name of the section.
+type Weights map[string]int
+
+// completenessSections tell whether each optional section of a user is
+// filled.
+var completenessSections = map[string]func(*User) bool{
+	"date_of_birth": func(u *User) bool { return u.DateOfBirth != "" },
+	"income":        func(u *User) bool { return u.Income != 0 },
+	"spouse":        func(u *User) bool { return u.Spouse != nil },
+	"dependents":    func(u *User) bool { return len(u.Dependents) > 0 },
+	"goals":         func(u *User) bool { return len(u.Goals) > 0 },
+	"protections":   func(u *User) bool { return len(u.Protections) > 0 },
+	"debts":         func(u *User) bool { return len(u.Debts) > 0 },
+}
+
+// CompletenessWeights are the weights used by the API to score the
+// completeness of the users.
+var CompletenessWeights = Weights{
+	"date_of_birth": 20,
+	"income":        20,
+	"spouse":        10,
+	"dependents":    10,
+	"goals":         20,
+	"protections":   10,
+	"debts":         10,
+}
+
+// ParseWeights parses comma-separated weights of sections, such as
+// "date_of_birth:20,income:20". The sections left out weigh nothing.
+func ParseWeights(s string) (Weights, error) {
+	weights := make(Weights)
+	for _, field := range strings.Split(s, ",") {
+		section, value, ok := strings.Cut(strings.TrimSpace(field), ":")
+		if _, known := completenessSections[section]; !ok || !known {
+			return nil, fmt.Errorf("unknown section %q", section)
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 {
+			return nil, errors.New("weights must be positive integers")
+		}
+		weights[section] = weight
+	}
+
+	return weights, nil
+}
+
+// Completeness scores the completeness of the optional sections of the
+// user, as the percentage of the total weight of the sections which are
+// filled, rounded down. The missing sections are returned sorted.
+//
+// The score is 100 when the weights are all zero.
+func Completeness(user *User, weights Weights) (score int, missing []string) {
+	missing = []string{}
+	total, filled := 0, 0
+	for section, weight := range weights {
+		isFilled, ok := completenessSections[section]
+		if !ok || weight <= 0 {
+			continue
+		}
+
+		total += weight
+		if isFilled(user) {
+			filled += weight
+		} else {
+			missing = append(missing, section)
+		}
+	}
+	sort.Strings(missing)
+
+	if total == 0 {
+		return 100, missing
+	}
+
+	return filled * 100 / total, missing
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompleteness(t *testing.T) {
+	tests := map[string]struct {
+		user            User
+		expectedScore   int
+		expectedMissing []string
+	}{
+		`empty profile`: {
+			user:            User{},
+			expectedScore:   0,
+			expectedMissing: []string{"date_of_birth", "debts", "dependents", "goals", "income", "protections", "spouse"},
+		},
+		`partial profile`: {
+			user:            User{DateOfBirth: "1990-05-01", Income: 6000000, Goals: []Goal{{Title: "House"}}},
+			expectedScore:   60,
+			expectedMissing: []string{"debts", "dependents", "protections", "spouse"},
+		},
+		`full profile`: {
+			user: User{
+				DateOfBirth: "1990-05-01",
+				Income:      6000000,
+				Spouse:      &FamilyMember{FirstName: "Jane"},
+				Dependents:  []FamilyMember{{FirstName: "Jack"}},
+				Goals:       []Goal{{Title: "House"}},
+				Protections: []Protection{{}},
+				Debts:       []Debt{{}},
+			},
+			expectedScore:   100,
+			expectedMissing: []string{},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			score, missing := Completeness(&tt.user, CompletenessWeights)
+
+			if score != tt.expectedScore {
+				t.Errorf("unexpected score: got %d, want %d", score, tt.expectedScore)
+			}
+			if !reflect.DeepEqual(missing, tt.expectedMissing) {
+				t.Errorf("unexpected missing sections: got %v, want %v", missing, tt.expectedMissing)
+			}
+		})
+	}
+}
+
+func TestCompletenessWeights(t *testing.T) {
+	weights, err := ParseWeights("date_of_birth:3, goals:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	score, missing := Completeness(&User{DateOfBirth: "1990-05-01"}, weights)
+	if score != 75 || !reflect.DeepEqual(missing, []string{"goals"}) {
+		t.Errorf("unexpected completeness: got %d and %v", score, missing)
+	}
+
+	if score, _ = Completeness(&User{}, Weights{}); score != 100 {
+		t.Errorf("unexpected score without weights: got %d, want 100", score)
+	}
+
+	for _, s := range []string{"age:10", "goals:-1", "goals"} {
+		if _, err = ParseWeights(s); err == nil {
+			t.Errorf("expected an error for weights %q", s)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidMoney is returned when an amount of money can't be parsed.
+var ErrInvalidMoney = errors.New("must be a decimal amount with at most four decimal places")
+
+// moneyScale is the number of decimal places of Money, enough for the
+// minor units of every currency.
+const moneyScale = 4
+
+// currencyExponents are the exponents of the minor units of the
+// currencies which don't have cents, keyed by currency. The others have
+// two decimal places.
+var currencyExponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// CurrencyExponent returns the number of decimal places of the minor
+// units of the currency, such as 0 for JPY, 2 for USD or 3 for BHD.
+func CurrencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Money is an exact amount of the user's currency.
+//
+// Floats are never used: the amount is held in ten-thousandths, so it can
+// be decoded before the currency is known. The decimal places it may have
+// are those of the minor units of the currency, see CurrencyExponent and
+// FitsCurrency. It is represented as a decimal string, such as "100.5",
+// in JSON and in DynamoDB, but both a string and a number are accepted
+// when decoding JSON.
+type Money int64
+
+// MinorUnits returns the amount of the minor units of the currency, such
+// as cents for USD.
+func MinorUnits(amount int64, currency string) Money {
+	return Money(amount * pow10(moneyScale-CurrencyExponent(currency)))
+}
+
+// ParseMoney parses a decimal amount such as "-100.5" into Money.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+
+	negative := strings.HasPrefix(s, "-")
+	units, decimals := strings.TrimPrefix(s, "-"), ""
+	if i := strings.IndexByte(units, '.'); i >= 0 {
+		units, decimals = units[:i], units[i+1:]
+		if decimals == "" {
+			return 0, ErrInvalidMoney
+		}
+	}
+	if units == "" || len(decimals) > moneyScale || !isDigits(units) || !isDigits(decimals) {
+		return 0, ErrInvalidMoney
+	}
+
+	decimals += strings.Repeat("0", moneyScale-len(decimals))
+	amount, err := strconv.ParseInt(units+decimals, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMoney
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return Money(amount), nil
+}
+
+// Units returns the whole units of the amount, truncated toward zero.
+func (m Money) Units() int64 {
+	return int64(m) / pow10(moneyScale)
+}
+
+// FitsCurrency reports whether the amount has no more decimal places than
+// the minor units of the currency.
+func (m Money) FitsCurrency(currency string) bool {
+	return int64(m)%pow10(moneyScale-CurrencyExponent(currency)) == 0
+}
+
+// String returns the shortest decimal representation of the amount, such
+// as "100.5" or "100".
+func (m Money) String() string {
+	return m.format(0)
+}
+
+// Format returns the decimal representation of the amount with the
+// decimal places of the minor units of the currency, such as "100.50" in
+// USD or "100" in JPY. The amounts not fitting the currency keep their
+// extra decimal places.
+func (m Money) Format(currency string) string {
+	return m.format(CurrencyExponent(currency))
+}
+
+// format returns the decimal representation of the amount, with at least
+// places decimal places.
+func (m Money) format(places int) string {
+	amount, sign := int64(m), ""
+	if amount < 0 {
+		amount, sign = -amount, "-"
+	}
+
+	decimals := fmt.Sprintf("%0*d", moneyScale, amount%pow10(moneyScale))
+	for len(decimals) > places && decimals[len(decimals)-1] == '0' {
+		decimals = decimals[:len(decimals)-1]
+	}
+	if decimals == "" {
+		return fmt.Sprintf("%s%d", sign, amount/pow10(moneyScale))
+	}
+	return fmt.Sprintf("%s%d.%s", sign, amount/pow10(moneyScale), decimals)
+}
+
+// MarshalJSON encodes the amount as a decimal string.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+// UnmarshalJSON decodes the amount from a decimal string or number.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if strings.HasPrefix(s, `"`) {
+		var err error
+		if s, err = strconv.Unquote(s); err != nil {
+			return ErrInvalidMoney
+		}
+	}
+
+	amount, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+
+	*m = amount
+	return nil
+}
+
+// MarshalDynamoDBAttributeValue stores the amount as a decimal string.
+func (m Money) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberS{Value: m.String()}, nil
+}
+
+// UnmarshalDynamoDBAttributeValue reads the amount from a decimal string
+// or number. An empty string is read as zero.
+func (m *Money) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	var s string
+	switch v := av.(type) {
+	case *types.AttributeValueMemberS:
+		s = v.Value
+	case *types.AttributeValueMemberN:
+		s = v.Value
+	case *types.AttributeValueMemberNULL:
+		return nil
+	default:
+		return fmt.Errorf("unsupported attribute value %T for money", av)
+	}
+
+	if s == "" {
+		*m = 0
+		return nil
+	}
+
+	amount, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+
+	*m = amount
+	return nil
+}
+
+// isDigits returns true if s only contains decimal digits.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pow10 returns 10 to the power of n.
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected Money
+		valid    bool
+	}{
+		`decimal string`:    {input: `"100.50"`, expected: 1005000, valid: true},
+		`decimal number`:    {input: `100.5`, expected: 1005000, valid: true},
+		`integer number`:    {input: `100`, expected: 1000000, valid: true},
+		`negative string`:   {input: `"-0.05"`, expected: -500, valid: true},
+		`three decimals`:    {input: `"1.125"`, expected: 11250, valid: true},
+		`letters`:           {input: `"abc"`, valid: false},
+		`too many decimals`: {input: `1.00005`, valid: false},
+		`exponent`:          {input: `1e2`, valid: false},
+		`missing decimals`:  {input: `"1."`, valid: false},
+		`missing units`:     {input: `".5"`, valid: false},
+		`empty string`:      {input: `""`, valid: false},
+		`boolean`:           {input: `true`, valid: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var m Money
+			err := json.Unmarshal([]byte(tt.input), &m)
+
+			if tt.valid && err != nil {
+				t.Fatalf("unexpected error for %s: %v", tt.input, err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("expected an error for %s, got %d", tt.input, m)
+			}
+			if m != tt.expected {
+				t.Errorf("unexpected amount for %s: got %d, want %d", tt.input, m, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMoneyMarshal(t *testing.T) {
+	usr := User{Income: MinorUnits(10050, "USD"), Expenses: MinorUnits(-5, "USD")}
+
+	js, err := json.Marshal(struct{ Income, Expenses Money }{usr.Income, usr.Expenses})
+	if err != nil {
+		t.Fatalf("failed to marshal json: %v", err)
+	}
+	if string(js) != `{"Income":"100.5","Expenses":"-0.05"}` {
+		t.Errorf("unexpected json: got %s", js)
+	}
+
+	item, err := attributevalue.MarshalMap(usr)
+	if err != nil {
+		t.Fatalf("failed to marshal item: %v", err)
+	}
+	income, ok := item["income"].(*types.AttributeValueMemberS)
+	if !ok || income.Value != "100.5" {
+		t.Errorf("unexpected income attribute: got %#v", item["income"])
+	}
+
+	var out User
+	if err = attributevalue.UnmarshalMap(item, &out); err != nil {
+		t.Fatalf("failed to unmarshal item: %v", err)
+	}
+	if out.Income != usr.Income || out.Expenses != usr.Expenses {
+		t.Errorf("unexpected round trip: got %d and %d", out.Income, out.Expenses)
+	}
+}
+
+func TestMoneyCurrency(t *testing.T) {
+	tests := map[string]struct {
+		amount   string
+		currency string
+		fits     bool
+		expected string
+	}{
+		`cents in USD`:        {amount: "100.5", currency: "USD", fits: true, expected: "100.50"},
+		`whole amount in USD`: {amount: "100", currency: "USD", fits: true, expected: "100.00"},
+		`fils in BHD`:         {amount: "1.125", currency: "BHD", fits: true, expected: "1.125"},
+		`tenths in BHD`:       {amount: "1.1", currency: "BHD", fits: true, expected: "1.100"},
+		`whole amount in JPY`: {amount: "1000", currency: "JPY", fits: true, expected: "1000"},
+		`cents in JPY`:        {amount: "1000.50", currency: "JPY", fits: false, expected: "1000.5"},
+		`too many decimals`:   {amount: "1.125", currency: "USD", fits: false, expected: "1.125"},
+		`negative amount`:     {amount: "-0.05", currency: "EUR", fits: true, expected: "-0.05"},
+		`unknown currency`:    {amount: "2.5", currency: "", fits: true, expected: "2.50"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := ParseMoney(tt.amount)
+			if err != nil {
+				t.Fatalf("failed to parse %s: %v", tt.amount, err)
+			}
+
+			if got := m.FitsCurrency(tt.currency); got != tt.fits {
+				t.Errorf("unexpected fit of %s in %s: got %v, want %v", tt.amount, tt.currency, got, tt.fits)
+			}
+			if got := m.Format(tt.currency); got != tt.expected {
+				t.Errorf("unexpected format of %s in %s: got %s, want %s", tt.amount, tt.currency, got, tt.expected)
+			}
+		})
+	}
+
+	if m := MinorUnits(1125, "BHD"); m.String() != "1.125" {
+		t.Errorf("unexpected amount of 1125 fils: got %s", m)
+	}
+	if m := MinorUnits(1000, "JPY"); m.String() != "1000" {
+		t.Errorf("unexpected amount of 1000 yen: got %s", m)
+	}
+}
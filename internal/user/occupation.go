@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"user-service.mykapital.io/internal/validator"
+)
+
+// MaxOccupationLength is the maximum number of characters of an occupation.
+const MaxOccupationLength = 100
+
+// ISCOSubMajorGroups are the codes of the sub-major groups of the
+// International Standard Classification of Occupations (ISCO-08).
+var ISCOSubMajorGroups = []string{
+	"01", "02", "03",
+	"11", "12", "13", "14",
+	"21", "22", "23", "24", "25", "26",
+	"31", "32", "33", "34", "35",
+	"41", "42", "43", "44",
+	"51", "52", "53", "54",
+	"61", "62", "63",
+	"71", "72", "73", "74", "75",
+	"81", "82", "83",
+	"91", "92", "93", "94", "95", "96",
+}
+
+// ValidateOccupation validates the occupation of a user, when provided.
+//
+// The occupation is free-form, but must not be longer than
+// MaxOccupationLength or contain control characters. When occupations is
+// not empty, the occupation must be one of its codes instead.
+func ValidateOccupation(v *validator.Validator, occupation string, occupations []string) {
+	if occupation == "" {
+		return
+	}
+
+	if len(occupations) > 0 {
+		v.Check(validator.In(occupation, occupations...), "occupation", "must be a known occupation code")
+		return
+	}
+
+	v.Check(utf8.RuneCountInString(occupation) <= MaxOccupationLength, "occupation", fmt.Sprintf("must not be more than %d characters long", MaxOccupationLength))
+	v.Check(validator.Printable(occupation), "occupation", "must not contain control characters")
+	v.Check(strings.TrimSpace(occupation) != "", "occupation", "must not be blank")
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"strings"
+	"testing"
+
+	"user-service.mykapital.io/internal/validator"
+)
+
+func TestValidateOccupation(t *testing.T) {
+	tests := map[string]struct {
+		occupation  string
+		occupations []string
+		valid       bool
+	}{
+		`omitted`:                  {occupation: "", valid: true},
+		`free-form`:                {occupation: "Software engineer", valid: true},
+		`at the maximum length`:    {occupation: strings.Repeat("é", MaxOccupationLength), valid: true},
+		`above the maximum length`: {occupation: strings.Repeat("a", MaxOccupationLength+1), valid: false},
+		`control characters`:       {occupation: "Software\tengineer", valid: false},
+		`blank`:                    {occupation: "   ", valid: false},
+		`known code`:               {occupation: "25", occupations: ISCOSubMajorGroups, valid: true},
+		`unknown code`:             {occupation: "99", occupations: ISCOSubMajorGroups, valid: false},
+		`free-form with taxonomy`:  {occupation: "Software engineer", occupations: ISCOSubMajorGroups, valid: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateOccupation(v, tt.occupation, tt.occupations)
+
+			if _, found := v.Errors["occupation"]; found == tt.valid {
+				t.Errorf("unexpected validation of the occupation: errors %v", v.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// PhoneVerificationTTL is how long a phone verification code can be used.
+const PhoneVerificationTTL = 10 * time.Minute
+
+// PhoneResendCooldown is how long a user has to wait before being sent
+// another phone verification code.
+const PhoneResendCooldown = time.Minute
+
+// MaxPhoneAttempts is the number of wrong codes locking a phone
+// verification out until it expires.
+const MaxPhoneAttempts = 5
+
+// phoneCodeDigits is the number of digits of a phone verification code.
+const phoneCodeDigits = 6
+
+var (
+	// ErrInvalidPhoneCode is returned for a wrong or expired phone
+	// verification code.
+	ErrInvalidPhoneCode = errors.New("invalid or expired phone verification code")
+	// ErrPhoneLocked is returned once a phone verification got
+	// MaxPhoneAttempts wrong codes.
+	ErrPhoneLocked = errors.New("too many failed phone verification attempts")
+)
+
+// PhoneVerification is the pending verification of a phone number of a
+// user, sent a code by text message.
+//
+// As for the email, only the hash of the code is stored.
+type PhoneVerification struct {
+	Phone     string `dynamodbav:"phone"`
+	CodeHash  string `dynamodbav:"codeHash"`
+	ExpiresAt string `dynamodbav:"expiresAt"`
+	// Attempts is the number of wrong codes given so far.
+	Attempts int `dynamodbav:"attempts"`
+}
+
+// NewPhoneVerification generates a numeric code verifying the phone,
+// expiring after PhoneVerificationTTL.
+func NewPhoneVerification(phone string, now time.Time) (string, *PhoneVerification, error) {
+	max := big.NewInt(1)
+	for i := 0; i < phoneCodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", nil, err
+	}
+	code := fmt.Sprintf("%0*d", phoneCodeDigits, n)
+
+	return code, &PhoneVerification{
+		Phone:     phone,
+		CodeHash:  hashToken(code),
+		ExpiresAt: now.Add(PhoneVerificationTTL).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// Expired reports whether the verification has expired, or is missing.
+func (p *PhoneVerification) Expired(now time.Time) bool {
+	if p == nil {
+		return true
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, p.ExpiresAt)
+	return err != nil || !now.Before(expiresAt)
+}
+
+// Locked reports whether the verification is locked out by wrong codes,
+// until it expires.
+func (p *PhoneVerification) Locked(now time.Time) bool {
+	return !p.Expired(now) && p.Attempts >= MaxPhoneAttempts
+}
+
+// CoolingDown reports whether the code of the verification was sent less
+// than PhoneResendCooldown ago.
+func (p *PhoneVerification) CoolingDown(now time.Time) bool {
+	if p == nil {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, p.ExpiresAt)
+	if err != nil {
+		return false
+	}
+	sentAt := expiresAt.Add(-PhoneVerificationTTL)
+
+	return now.Before(sentAt.Add(PhoneResendCooldown))
+}
+
+// Check checks the code against the verification.
+//
+// ErrPhoneLocked is returned when the verification is locked, and
+// ErrInvalidPhoneCode when the code is wrong or expired.
+func (p *PhoneVerification) Check(code string, now time.Time) error {
+	switch {
+	case p.Locked(now):
+		return ErrPhoneLocked
+	case p.Expired(now):
+		return ErrInvalidPhoneCode
+	case subtle.ConstantTimeCompare([]byte(hashToken(code)), []byte(p.CodeHash)) != 1:
+		return ErrInvalidPhoneCode
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPhoneVerificationCheck(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	code, verification, err := NewPhoneVerification("+15145550123", now)
+	if err != nil {
+		t.Fatalf("failed to create phone verification: %v", err)
+	}
+	if len(code) != phoneCodeDigits {
+		t.Fatalf("unexpected code: %q", code)
+	}
+	locked := *verification
+	locked.Attempts = MaxPhoneAttempts
+
+	tests := []struct {
+		name         string
+		verification *PhoneVerification
+		code         string
+		now          time.Time
+		want         error
+	}{
+		{"valid code", verification, code, now.Add(time.Minute), nil},
+		{"wrong code", verification, code + "0", now.Add(time.Minute), ErrInvalidPhoneCode},
+		{"expired code", verification, code, now.Add(PhoneVerificationTTL), ErrInvalidPhoneCode},
+		{"locked out", &locked, code, now.Add(time.Minute), ErrPhoneLocked},
+		{"lockout expired", &locked, code, now.Add(PhoneVerificationTTL), ErrInvalidPhoneCode},
+		{"missing verification", nil, code, now, ErrInvalidPhoneCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.verification.Check(tt.code, tt.now); got != tt.want {
+				t.Errorf("unexpected check: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhoneVerificationCoolingDown(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	_, verification, err := NewPhoneVerification("+15145550123", now)
+	if err != nil {
+		t.Fatalf("failed to create phone verification: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		verification *PhoneVerification
+		now          time.Time
+		want         bool
+	}{
+		{"just sent", verification, now, true},
+		{"within the cooldown", verification, now.Add(PhoneResendCooldown - time.Second), true},
+		{"after the cooldown", verification, now.Add(PhoneResendCooldown), false},
+		{"missing verification", nil, now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.verification.CoolingDown(tt.now); got != tt.want {
+				t.Errorf("unexpected cooldown: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPhone(t *testing.T) {
+	_, verification, err := NewPhoneVerification("+15145550123", time.Now())
+	if err != nil {
+		t.Fatalf("failed to create phone verification: %v", err)
+	}
+	model, _ := newFakeModel(t, User{ID: "1", Version: 1, PhoneVerification: verification})
+
+	usr, err := model.Get(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if err = model.VerifyPhone(context.Background(), usr); err != nil {
+		t.Fatalf("failed to verify phone: %v", err)
+	}
+
+	stored, err := model.Get(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if stored.Phone != "+15145550123" || !stored.PhoneVerified || stored.PhoneVerification != nil || stored.Version != 2 {
+		t.Errorf("phone is not verified: %+v", stored)
+	}
+}
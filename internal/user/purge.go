@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	xerrors "user-service.mykapital.io/internal/errors"
+	"user-service.mykapital.io/internal/validator"
+)
+
+// PurgeDeleted hard-deletes the users soft-deleted before the day of the
+// cutoff, and returns how many were deleted. Nothing is deleted during a
+// dry run, but the users which would be are counted.
+//
+// The soft-deleted users are found by scanning the table, and deleted by
+// chunks of MaxBatchWriteItems. With an EmailTableName, the claims of
+// their emails are deleted in the same chunks. When some of them are still
+// unprocessed once the attempts run out, the others are deleted, and a
+// *xerrors.BatchError listing the ids of the users which weren't, or whose
+// claim wasn't, is returned along with the count of the deleted ones.
+func (m Model) PurgeDeleted(ctx context.Context, before time.Time, dryRun bool) (int, error) {
+	// The model scans the soft-deleted users only, which it would
+	// otherwise leave out.
+	m.IncludeDeleted = true
+	cutoff := before.Format("2006-01-02")
+	filter := expression.AttributeExists(expression.Name("deletedAt")).
+		And(expression.Name("deletedAt").LessThan(expression.Value(cutoff)))
+
+	var purged, pending int
+	var unpurged []string
+	var unpurgedErr error
+	// The requests of the chunk by table, and the ids of the users of the
+	// claims it deletes by email.
+	requests := make(map[string][]types.WriteRequest)
+	owners := make(map[string]string)
+	flush := func() error {
+		unprocessed, err := m.batchWrite(ctx, requests)
+		purged += len(requests[m.TableName]) - len(unprocessed[m.TableName])
+		for _, request := range unprocessed[m.TableName] {
+			unpurged = append(unpurged, keyID(request.DeleteRequest.Key))
+		}
+		for _, request := range unprocessed[m.EmailTableName] {
+			if id := owners[keyEmail(request.DeleteRequest.Key)]; !validator.In(id, unpurged...) {
+				unpurged = append(unpurged, id)
+			}
+		}
+		requests, owners, pending = make(map[string][]types.WriteRequest), make(map[string]string), 0
+		if len(unprocessed) > 0 {
+			unpurgedErr = err
+			return nil
+		}
+		return err
+	}
+
+	err := m.ForEach(ctx, filter, func(user *User) error {
+		if dryRun {
+			purged++
+			return nil
+		}
+
+		requests[m.TableName] = append(requests[m.TableName], types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: user.GetKey()}})
+		pending++
+		if m.EmailTableName != "" && user.Email != "" {
+			requests[m.EmailTableName] = append(requests[m.EmailTableName], types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: claimKey(user.Email)}})
+			owners[user.Email] = user.ID
+			pending++
+		}
+		// The next user may take two requests.
+		if pending < MaxBatchWriteItems-1 {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && pending > 0 {
+		err = flush()
+	}
+	if err != nil {
+		return purged, err
+	}
+
+	if len(unpurged) > 0 {
+		return purged, &xerrors.BatchError{IDs: unpurged, Err: unpurgedErr}
+	}
+
+	return purged, nil
+}
+
+// keyEmail returns the email of the key of a claim.
+func keyEmail(key map[string]types.AttributeValue) string {
+	if email, ok := key["email"].(*types.AttributeValueMemberS); ok {
+		return email.Value
+	}
+
+	return ""
+}
+
+// keyID returns the user id of the key of an item.
+func keyID(key map[string]types.AttributeValue) string {
+	if id, ok := key["userID"].(*types.AttributeValueMemberS); ok {
+		return id.Value
+	}
+
+	return ""
+}
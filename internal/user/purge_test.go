@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestPurgeDeleted(t *testing.T) {
+	users := []User{
+		{ID: "active", FirstName: "John"},
+		{ID: "recent", FirstName: "Jane", DeletedAt: "2023-03-01"},
+		{ID: "cutoff", FirstName: "Jack", DeletedAt: "2023-02-01"},
+	}
+	// More old users than a single batch write holds.
+	for i := 0; i < MaxBatchWriteItems+5; i++ {
+		users = append(users, User{ID: fmt.Sprintf("old-%d", i), DeletedAt: "2022-06-15"})
+	}
+	model, fake := newFakeModel(t, users...)
+	cutoff := time.Date(2023, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	purged, err := model.PurgeDeleted(context.Background(), cutoff, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != MaxBatchWriteItems+5 || len(fake.Items) != len(users) {
+		t.Errorf("unexpected dry run: got %d purged and %d users left", purged, len(fake.Items))
+	}
+
+	purged, err = model.PurgeDeleted(context.Background(), cutoff, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != MaxBatchWriteItems+5 {
+		t.Errorf("unexpected purged users: got %d, want %d", purged, MaxBatchWriteItems+5)
+	}
+	if len(fake.Items) != 3 {
+		t.Errorf("unexpected users left: got %d, want 3", len(fake.Items))
+	}
+	for _, id := range []string{"active", "recent", "cutoff"} {
+		if _, ok := fake.Items[id]; !ok {
+			t.Errorf("expected user %s not to be purged", id)
+		}
+	}
+}
+
+func TestPurgeDeletedClaims(t *testing.T) {
+	ctx := context.Background()
+	model, fake := newFakeModel(t)
+	model.EmailTableName = "UserEmail"
+	// More old users than a single batch write holds along with their
+	// claims.
+	for i := 0; i < MaxBatchWriteItems; i++ {
+		err := model.Create(ctx, &User{ID: fmt.Sprintf("old-%d", i), Email: fmt.Sprintf("old-%d@example.com", i), Version: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := model.Create(ctx, &User{ID: "active", Email: "active@example.com", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MaxBatchWriteItems; i++ {
+		fake.Items[fmt.Sprintf("old-%d", i)]["deletedAt"] = &types.AttributeValueMemberS{Value: "2022-06-15"}
+	}
+
+	purged, err := model.PurgeDeleted(ctx, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != MaxBatchWriteItems {
+		t.Errorf("unexpected purged users: got %d, want %d", purged, MaxBatchWriteItems)
+	}
+	// Only the active user and its claim are left.
+	if len(fake.Items) != 2 || claimOwner(t, fake, "active@example.com") != "active" {
+		t.Errorf("unexpected items left: %v", fake.Items)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import "user-service.mykapital.io/internal/validator"
+
+// Region declares the registration conventions of a country.
+type Region struct {
+	// AdministrativeDivisions are the allowed types of division within
+	// the country.
+	//
+	// The first division is used when the client omits it.
+	AdministrativeDivisions []string
+	// Currency is the default currency of the country.
+	Currency string
+}
+
+// DefaultRegions maps the two-letter country codes to their Region.
+//
+// It is the single source of truth for every value defaulted from the
+// country of the user.
+var DefaultRegions = map[string]Region{
+	"AU": {AdministrativeDivisions: []string{"state", "territory"}, Currency: "AUD"},
+	"CA": {AdministrativeDivisions: []string{"province", "territory"}, Currency: "CAD"},
+	"DE": {AdministrativeDivisions: []string{"state"}, Currency: "EUR"},
+	"FR": {AdministrativeDivisions: []string{"region"}, Currency: "EUR"},
+	"GB": {AdministrativeDivisions: []string{"country"}, Currency: "GBP"},
+	"IN": {AdministrativeDivisions: []string{"state", "union territory"}, Currency: "INR"},
+	"MX": {AdministrativeDivisions: []string{"state"}, Currency: "MXN"},
+	"US": {AdministrativeDivisions: []string{"state", "district", "territory"}, Currency: "USD"},
+}
+
+// FillDefaults sets the country dependent fields the client omitted.
+//
+// Fields that are already set are left untouched, so that a mismatch
+// is still reported by the validation. Nothing is set for a country
+// missing from the regions, except the currency: it falls back to the
+// DefaultCurrency with a warning, or is reported as an error with
+// StrictCurrency.
+func (r Rules) FillDefaults(v *validator.Validator, user *User) {
+	r.ReadDefaults(user)
+
+	if user.Currency != "" {
+		return
+	}
+
+	switch {
+	case r.StrictCurrency:
+		v.AddError("currency", "must be provided for this country")
+	case r.DefaultCurrency != "":
+		user.Currency = r.DefaultCurrency
+		v.AddWarning("currency", "was assumed to be "+r.DefaultCurrency+" for this country")
+	}
+}
+
+// ReadDefaults sets the country dependent fields missing from a stored
+// user, such as the users stored before the field was added, from the
+// region of its country. Unlike FillDefaults, nothing is assumed for the
+// countries missing from the regions.
+func (r Rules) ReadDefaults(user *User) {
+	region, ok := r.Regions[user.CountryCodeAlpha2]
+	if !ok {
+		return
+	}
+
+	if user.AdministrativeDivision == "" && len(region.AdministrativeDivisions) > 0 {
+		user.AdministrativeDivision = region.AdministrativeDivisions[0]
+	}
+	if user.Currency == "" {
+		user.Currency = region.Currency
+	}
+}
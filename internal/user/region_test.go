@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"reflect"
+	"testing"
+
+	"user-service.mykapital.io/internal/validator"
+)
+
+func TestFillDefaults(t *testing.T) {
+	tests := map[string]struct {
+		user             User
+		expectedDivision string
+		expectedCurrency string
+	}{
+		`canada is auto-filled`: {
+			user:             User{CountryCodeAlpha2: "CA"},
+			expectedDivision: "province",
+			expectedCurrency: "CAD",
+		},
+		`united states is auto-filled`: {
+			user:             User{CountryCodeAlpha2: "US"},
+			expectedDivision: "state",
+			expectedCurrency: "USD",
+		},
+		`provided values are kept`: {
+			user:             User{CountryCodeAlpha2: "CA", AdministrativeDivision: "territory", Currency: "USD"},
+			expectedDivision: "territory",
+			expectedCurrency: "USD",
+		},
+		`unknown country is left empty`: {
+			user:             User{CountryCodeAlpha2: "ZZ"},
+			expectedDivision: "",
+			expectedCurrency: "",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			DefaultRules.FillDefaults(v, &tt.user)
+
+			if tt.user.AdministrativeDivision != tt.expectedDivision {
+				t.Errorf("unexpected division: got '%s', want '%s'", tt.user.AdministrativeDivision, tt.expectedDivision)
+			}
+			if tt.user.Currency != tt.expectedCurrency {
+				t.Errorf("unexpected currency: got '%s', want '%s'", tt.user.Currency, tt.expectedCurrency)
+			}
+		})
+	}
+}
+
+func TestFillDefaultCurrency(t *testing.T) {
+	tests := map[string]struct {
+		rules            Rules
+		user             User
+		expectedCurrency string
+		expectedErrors   map[string]string
+		expectedWarnings map[string]string
+	}{
+		`no fallback`: {
+			rules:            Rules{Regions: DefaultRegions},
+			user:             User{CountryCodeAlpha2: "ZZ"},
+			expectedCurrency: "",
+			expectedErrors:   map[string]string{},
+			expectedWarnings: map[string]string{},
+		},
+		`lenient fallback`: {
+			rules:            Rules{Regions: DefaultRegions, DefaultCurrency: "USD"},
+			user:             User{CountryCodeAlpha2: "ZZ"},
+			expectedCurrency: "USD",
+			expectedErrors:   map[string]string{},
+			expectedWarnings: map[string]string{"currency": "was assumed to be USD for this country"},
+		},
+		`strict rejection`: {
+			rules:            Rules{Regions: DefaultRegions, DefaultCurrency: "USD", StrictCurrency: true},
+			user:             User{CountryCodeAlpha2: "ZZ"},
+			expectedCurrency: "",
+			expectedErrors:   map[string]string{"currency": "must be provided for this country"},
+			expectedWarnings: map[string]string{},
+		},
+		`country default wins`: {
+			rules:            Rules{Regions: DefaultRegions, DefaultCurrency: "USD", StrictCurrency: true},
+			user:             User{CountryCodeAlpha2: "CA"},
+			expectedCurrency: "CAD",
+			expectedErrors:   map[string]string{},
+			expectedWarnings: map[string]string{},
+		},
+		`provided currency`: {
+			rules:            Rules{Regions: DefaultRegions, DefaultCurrency: "USD", StrictCurrency: true},
+			user:             User{CountryCodeAlpha2: "ZZ", Currency: "EUR"},
+			expectedCurrency: "EUR",
+			expectedErrors:   map[string]string{},
+			expectedWarnings: map[string]string{},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			tt.rules.FillDefaults(v, &tt.user)
+
+			if tt.user.Currency != tt.expectedCurrency {
+				t.Errorf("unexpected currency: got '%s', want '%s'", tt.user.Currency, tt.expectedCurrency)
+			}
+			if !reflect.DeepEqual(v.Errors, tt.expectedErrors) {
+				t.Errorf("unexpected errors: got %v, want %v", v.Errors, tt.expectedErrors)
+			}
+			if !reflect.DeepEqual(v.Warnings, tt.expectedWarnings) {
+				t.Errorf("unexpected warnings: got %v, want %v", v.Warnings, tt.expectedWarnings)
+			}
+		})
+	}
+}
+
+func TestValidateAdministrativeDivision(t *testing.T) {
+	tests := map[string]struct {
+		country  string
+		division string
+		rules    Rules
+		valid    bool
+	}{
+		`allowed division`: {
+			country:  "CA",
+			division: "territory",
+			rules:    DefaultRules,
+			valid:    true,
+		},
+		`mismatched division`: {
+			country:  "CA",
+			division: "state",
+			rules:    DefaultRules,
+			valid:    false,
+		},
+		`unknown country is free-form`: {
+			country:  "ZZ",
+			division: "county",
+			rules:    DefaultRules,
+			valid:    true,
+		},
+		`configured division`: {
+			country:  "CA",
+			division: "county",
+			rules:    Rules{Regions: map[string]Region{"CA": {AdministrativeDivisions: []string{"county"}}}},
+			valid:    true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			usr := User{
+				Email:                  "john.doe@example.com",
+				FirstName:              "John",
+				CountryCodeAlpha2:      tt.country,
+				ProvinceCode:           "ON",
+				AdministrativeDivision: tt.division,
+			}
+
+			tt.rules.ValidateUser(v, &usr)
+
+			_, found := v.Errors["administrative_division"]
+			if found == tt.valid {
+				t.Errorf("unexpected validation of '%s' in '%s': errors %v", tt.division, tt.country, v.Errors)
+			}
+		})
+	}
+}
+
+func TestReadDefaults(t *testing.T) {
+	rules := DefaultRules
+	rules.DefaultCurrency = "USD"
+
+	usr := User{CountryCodeAlpha2: "CA"}
+	rules.ReadDefaults(&usr)
+	if usr.AdministrativeDivision != "province" || usr.Currency != "CAD" {
+		t.Errorf("unexpected defaults: got '%s' and '%s'", usr.AdministrativeDivision, usr.Currency)
+	}
+
+	// The DefaultCurrency is only assumed for new users, with a warning.
+	usr = User{CountryCodeAlpha2: "ZZ"}
+	rules.ReadDefaults(&usr)
+	if usr.AdministrativeDivision != "" || usr.Currency != "" {
+		t.Errorf("unexpected defaults for an unknown country: got '%s' and '%s'", usr.AdministrativeDivision, usr.Currency)
+	}
+}
@@ -20,6 +20,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -28,17 +31,105 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	xerrors "user-service.mykapital.io/internal/errors"
+	"user-service.mykapital.io/internal/validator"
 )
 
+// DynamoDBAPI is the part of the DynamoDB service client used by Model.
+//
+// It is implemented by *dynamodb.Client, and allows the table to be faked
+// during testing.
+type DynamoDBAPI interface {
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	DeleteTable(ctx context.Context, params *dynamodb.DeleteTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteTableOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
 // Model is a model that handles CRUD operations for User instances.
 // It contains a DynamoDB service client that is used to act on the specified table.
+//
+// The methods take the context of their caller, such as the one of an
+// HTTP request, so its cancellation and its deadline reach DynamoDB. Each
+// request to DynamoDB is bounded by a default timeout as well, which
+// applies on its own to the contexts without a deadline.
 type Model struct {
 	// DynamoDbClient is the dynamodb client for User
-	DynamoDbClient *dynamodb.Client
+	DynamoDbClient DynamoDBAPI
 	// TableName is the table holding the data for User
 	TableName string
 	// IndexName is the index used for range searching
 	IndexName string
+	// EmailTableName is the table claiming the emails of the users, keyed
+	// by email. When it is set, Create, CreateIfAbsent, Replace, InsertBatch
+	// and Update claim the email of the user in the same transaction as its
+	// write, and release the claim of its previous email, as Delete does,
+	// so concurrent registrations can't share an email.
+	EmailTableName string
+	// RetryBudget caps the retries of throttled calls. Every retry is
+	// allowed when it is nil.
+	RetryBudget *RetryBudget
+	// VersionGrace lets Update initialize the version of the legacy items
+	// stored without one, which are then considered at version 0.
+	VersionGrace bool
+	// PendingWindow is how long after its creation an unactivated user
+	// blocks the registration of its email with ErrPendingVerification.
+	PendingWindow time.Duration
+	// SkipCorruptItems lets ListFunc skip the items which can't be
+	// unmarshalled, reporting them in a *CorruptItemsError, instead of
+	// failing at the first one.
+	SkipCorruptItems bool
+	// Batcher coalesces the concurrent Get calls into BatchGet calls when
+	// it is set.
+	Batcher *GetBatcher
+	// ConsistentRead makes Get, GetRaw and BatchGet strongly consistent,
+	// instead of eventually consistent.
+	ConsistentRead bool
+	// WriteTransforms are applied in order to the users written by
+	// Insert, InsertBatch, Create, CreateIfAbsent and Replace, and to the
+	// attributes written by Update, before they are marshaled.
+	WriteTransforms []WriteTransform
+	// IncludeDeleted lets Get, BatchGet, ListFunc and ForEach return the
+	// soft-deleted users, which they report as missing or leave out
+	// otherwise.
+	IncludeDeleted bool
+	// OnThrottle is called on every throttled call, such as to report the
+	// throttling of a bulk write, when it is set.
+	OnThrottle func()
+}
+
+// CorruptItemsError reports the items skipped by a list as they couldn't
+// be unmarshalled.
+type CorruptItemsError struct {
+	// Keys are the IDs of the skipped items.
+	Keys []string
+	// Errs are the unmarshal errors of the skipped items, by key.
+	Errs map[string]error
+}
+
+func (e *CorruptItemsError) Error() string {
+	return fmt.Sprintf("couldn't unmarshal %d items: %s", len(e.Keys), strings.Join(e.Keys, ", "))
+}
+
+// add records the corrupt item.
+func (e *CorruptItemsError) add(item map[string]types.AttributeValue, err error) {
+	var key string
+	if id, ok := item["userID"].(*types.AttributeValueMemberS); ok {
+		key = id.Value
+	}
+
+	e.Keys = append(e.Keys, key)
+	if e.Errs == nil {
+		e.Errs = make(map[string]error)
+	}
+	e.Errs[key] = err
 }
 
 // CreateTable creates a DynamoDB table with a primary key defined as
@@ -47,10 +138,11 @@ type Model struct {
 // * SHOULD ONLY BE USED DURING TESTING *
 //
 // This function uses NewTableExistsWaiter to wait for the table to be created by
-// DynamoDB before it returns.
-func (m Model) CreateTable() (*types.TableDescription, error) {
+// DynamoDB before it returns. If the table is already in use,
+// xerrors.ErrTableExists is returned.
+func (m Model) CreateTable(ctx context.Context) (*types.TableDescription, error) {
 	var tableDesc *types.TableDescription
-	ctx, cancel := context.WithTimeout(context.Background(), 7*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 7*time.Minute)
 	defer cancel()
 
 	table, err := m.DynamoDbClient.CreateTable(ctx, &dynamodb.CreateTableInput{
@@ -87,6 +179,10 @@ func (m Model) CreateTable() (*types.TableDescription, error) {
 		}},
 	})
 	if err != nil {
+		var inUseEx *types.ResourceInUseException
+		if errors.As(err, &inUseEx) {
+			return nil, xerrors.ErrTableExists
+		}
 		return nil, fmt.Errorf("Couldn't create table %v. Here's why: %v\n", m.TableName, err)
 	}
 
@@ -103,14 +199,90 @@ func (m Model) CreateTable() (*types.TableDescription, error) {
 	return tableDesc, nil
 }
 
+// EnsureTable creates the table unless it already exists.
+//
+// A table which already exists may still be being created, such as by
+// a concurrent call, so it is waited for until it is active.
+//
+// * SHOULD ONLY BE USED DURING TESTING *
+func (m Model) EnsureTable(ctx context.Context) error {
+	_, err := m.CreateTable(ctx)
+	if errors.Is(err, xerrors.ErrTableExists) {
+		err = m.waitForTable(ctx, m.TableName)
+	}
+	if err != nil {
+		return err
+	}
+
+	if m.EmailTableName != "" {
+		err = m.createEmailTable(ctx)
+		if errors.Is(err, xerrors.ErrTableExists) {
+			err = m.waitForTable(ctx, m.EmailTableName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForTable waits for the table to exist and be active.
+func (m Model) waitForTable(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 7*time.Minute)
+	defer cancel()
+
+	waiter := dynamodb.NewTableExistsWaiter(m.DynamoDbClient)
+	err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)}, 5*time.Minute)
+	if err != nil {
+		return fmt.Errorf("wait for table exists failed. Here's why: %v", err)
+	}
+
+	return nil
+}
+
+// createEmailTable creates the EmailTableName table with a primary key
+// defined as a string named `email`.
+//
+// * SHOULD ONLY BE USED DURING TESTING *
+func (m Model) createEmailTable(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 7*time.Minute)
+	defer cancel()
+
+	_, err := m.DynamoDbClient.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: aws.String(m.EmailTableName),
+		AttributeDefinitions: []types.AttributeDefinition{{
+			AttributeName: aws.String("email"),
+			AttributeType: types.ScalarAttributeTypeS,
+		}},
+		KeySchema: []types.KeySchemaElement{{
+			AttributeName: aws.String("email"),
+			KeyType:       types.KeyTypeHash,
+		}},
+		ProvisionedThroughput: &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(1),
+			WriteCapacityUnits: aws.Int64(1),
+		},
+	})
+	if err != nil {
+		var inUseEx *types.ResourceInUseException
+		if errors.As(err, &inUseEx) {
+			return xerrors.ErrTableExists
+		}
+		return fmt.Errorf("couldn't create table %v. Here's why: %v", m.EmailTableName, err)
+	}
+
+	return m.waitForTable(ctx, m.EmailTableName)
+}
+
 // TableExists determines whether a DynamoDB table exists.
 //
 // * SHOULD ONLY BE USED DURING TESTING *
 //
 // If the table does not exist, a not found errors is returned
 // along with false.
-func (m Model) TableExists() (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m Model) TableExists(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	_, err := m.DynamoDbClient.DescribeTable(
@@ -128,19 +300,85 @@ func (m Model) TableExists() (bool, error) {
 	return true, nil
 }
 
+// ApproximateCount returns the number of users in the table, as last
+// reported by DynamoDB. The count is refreshed about every six hours, but
+// it is cheap to get.
+func (m Model) ApproximateCount(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var response *dynamodb.DescribeTableOutput
+	err := m.retry(ctx, func() (err error) {
+		response, err = m.DynamoDbClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(m.TableName),
+		})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't describe table %v. Here's why: %v", m.TableName, err)
+	}
+
+	return aws.ToInt64(response.Table.ItemCount), nil
+}
+
 // Insert inserts a new user in the table.
 //
+// xerrors.ErrDuplicateUser is returned when a user with the same id
+// already exists. InsertOrReplace overwrites it instead. Unlike Create,
+// the email isn't checked against the email index, but with an
+// EmailTableName it is claimed, and xerrors.ErrDuplicateEmail is returned
+// when another user claimed it.
+func (m Model) Insert(ctx context.Context, user *User) error {
+	m.transform(user)
+	return m.insert(ctx, user)
+}
+
+// insert inserts the user, already transformed, unless its id is taken.
+// With an EmailTableName, its email is claimed in the same transaction.
+func (m Model) insert(ctx context.Context, user *User) error {
+	condition := expression.AttributeNotExists(expression.Name("userID"))
+
+	var err error
+	if m.EmailTableName != "" {
+		err = m.putClaimingEmail(ctx, user, condition, "")
+	} else {
+		err = m.put(ctx, user, condition)
+	}
+	if errors.Is(err, xerrors.ErrConditionFailed) {
+		return xerrors.ErrDuplicateUser
+	}
+
+	return err
+}
+
+// InsertOrReplace inserts a new user in the table.
+//
 // If the user already exists, the user get replaced by the new user.
-func (m Model) Insert(user *User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+//
+// With an EmailTableName, the email of the user is claimed and the claim
+// of the email it replaces is released, in the same transaction as the
+// write. xerrors.ErrDuplicateEmail is returned when another user claimed
+// the email, and xerrors.ErrEditConflict when the replaced user changed
+// concurrently.
+func (m Model) InsertOrReplace(ctx context.Context, user *User) error {
+	m.transform(user)
+
+	if m.EmailTableName != "" {
+		return m.insertOrReplaceClaimingEmail(ctx, user)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	item, err := attributevalue.MarshalMap(user)
 	if err != nil {
 		panic(err)
 	}
-	_, err = m.DynamoDbClient.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(m.TableName), Item: item,
+	err = m.retry(ctx, func() error {
+		_, err := m.DynamoDbClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(m.TableName), Item: item,
+		})
+		return err
 	})
 	if err != nil {
 		return fmt.Errorf("couldn't add item to table. Here's why: %v", err)
@@ -149,121 +387,1563 @@ func (m Model) Insert(user *User) error {
 	return nil
 }
 
-// Get retrieves the user with the specific id.
+// insertOrReplaceClaimingEmail writes the user, already transformed, like
+// InsertOrReplace with an EmailTableName.
+func (m Model) insertOrReplaceClaimingEmail(ctx context.Context, user *User) error {
+	// The soft-deleted users are replaced as well.
+	m.IncludeDeleted = true
+
+	// The stored email is the previous email of the user as long as it
+	// is unchanged.
+	condition := expression.AttributeNotExists(expression.Name("userID"))
+	previousEmail := ""
+	stored, err := m.getConsistent(ctx, user.ID)
+	switch {
+	case errors.Is(err, xerrors.ErrRecordNotFound):
+	case err != nil:
+		return err
+	default:
+		condition = expression.Name("email").Equal(expression.Value(stored.Email))
+		previousEmail = stored.Email
+	}
+
+	err = m.putClaimingEmail(ctx, user, condition, previousEmail)
+	if errors.Is(err, xerrors.ErrConditionFailed) {
+		return xerrors.ErrEditConflict
+	}
+
+	return err
+}
+
+// MaxBatchWriteItems is the maximum number of items of a single
+// BatchWriteItem call.
+const MaxBatchWriteItems = 25
+
+// DuplicateEmailsError reports the users of InsertBatch whose email is
+// already registered.
 //
-// If no user was found with the given id, nothing will be returned.
-func (m Model) Get(id string) (*User, error) {
-	userIn := User{ID: id}
-	userOut := &User{}
+// It matches xerrors.ErrDuplicateEmail with errors.Is.
+type DuplicateEmailsError struct {
+	// IDs are the ids of the users whose email is registered.
+	IDs []string
+}
+
+func (e *DuplicateEmailsError) Error() string {
+	return "duplicate emails of users (" + strings.Join(e.IDs, ", ") + ")"
+}
+
+func (e *DuplicateEmailsError) Is(target error) bool {
+	return target == xerrors.ErrDuplicateEmail
+}
+
+// InsertBatch inserts the users in the table, replacing the existing
+// users like InsertOrReplace.
+//
+// The emails of the users are checked like in Create beforehand, and a
+// *DuplicateEmailsError listing the users whose email is already
+// registered, or pending verification, is returned without inserting any
+// user. The emails must be unique within the batch.
+//
+// The users are written by chunks of MaxBatchWriteItems, and the items
+// left unprocessed by DynamoDB are written again with backoff. With an
+// EmailTableName, they are written one transaction at a time instead,
+// each claiming the email of its user.
+//
+// When some items are still unprocessed once the attempts run out, the
+// other users are inserted, and a *xerrors.BatchError listing the ids of
+// the users which weren't is returned.
+func (m Model) InsertBatch(ctx context.Context, users []*User) error {
+	duplicates := &DuplicateEmailsError{}
+	for _, user := range users {
+		m.transform(user)
+		err := m.checkEmail(ctx, user)
+		switch {
+		case errors.Is(err, xerrors.ErrDuplicateEmail), errors.Is(err, xerrors.ErrPendingVerification):
+			duplicates.IDs = append(duplicates.IDs, user.ID)
+		case err != nil:
+			return err
+		}
+	}
+	if len(duplicates.IDs) > 0 {
+		return duplicates
+	}
+
+	if m.EmailTableName != "" {
+		return m.insertClaimingEmails(ctx, users)
+	}
+
+	var unwritten []string
+	var unwrittenErr error
+
+	for start := 0; start < len(users); start += MaxBatchWriteItems {
+		end := start + MaxBatchWriteItems
+		if end > len(users) {
+			end = len(users)
+		}
+
+		requests := make([]types.WriteRequest, 0, end-start)
+		for _, user := range users[start:end] {
+			item, err := attributevalue.MarshalMap(user)
+			if err != nil {
+				panic(err)
+			}
+			requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+		}
+
+		unprocessed, err := m.batchWrite(ctx, map[string][]types.WriteRequest{m.TableName: requests})
+		if len(unprocessed) > 0 {
+			for _, request := range unprocessed[m.TableName] {
+				var user User
+				if err := attributevalue.UnmarshalMap(request.PutRequest.Item, &user); err != nil {
+					return fmt.Errorf("couldn't unmarshal unprocessed item. Here's why: %v", err)
+				}
+				unwritten = append(unwritten, user.ID)
+			}
+			unwrittenErr = err
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(unwritten) > 0 {
+		return &xerrors.BatchError{IDs: unwritten, Err: unwrittenErr}
+	}
+
+	return nil
+}
+
+// insertClaimingEmails inserts the users, already transformed, like
+// InsertBatch, one transaction at a time, each claiming the email of its
+// user like InsertOrReplace. The users whose write is rejected are
+// reported in a *xerrors.BatchError, like the unprocessed ones of
+// InsertBatch.
+func (m Model) insertClaimingEmails(ctx context.Context, users []*User) error {
+	var unwritten []string
+	var unwrittenErr error
+
+	for _, user := range users {
+		err := m.insertOrReplaceClaimingEmail(ctx, user)
+		switch {
+		case errors.Is(err, xerrors.ErrEditConflict), errors.Is(err, xerrors.ErrDuplicateEmail):
+			unwritten = append(unwritten, user.ID)
+			unwrittenErr = err
+		case err != nil:
+			return err
+		}
+	}
+
+	if len(unwritten) > 0 {
+		return &xerrors.BatchError{IDs: unwritten, Err: unwrittenErr}
+	}
+
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// batchWrite writes a chunk of requests by table, until no request is
+// left unprocessed or the attempts run out. The requests still unprocessed
+// are returned by table along with the error.
+func (m Model) batchWrite(ctx context.Context, requestItems map[string][]types.WriteRequest) (map[string][]types.WriteRequest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	response, err := m.DynamoDbClient.GetItem(ctx, &dynamodb.GetItemInput{
-		Key: userIn.GetKey(), TableName: aws.String(m.TableName),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("couldn't get info about %v. Here's why: %v", id, err)
-	} else {
-		err = attributevalue.UnmarshalMap(response.Item, userOut)
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		var response *dynamodb.BatchWriteItemOutput
+		err := m.retry(ctx, func() (err error) {
+			response, err = m.DynamoDbClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: requestItems,
+			})
+			return err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("couldn't unmarshal response. Here's why: %v", err)
+			return nil, fmt.Errorf("couldn't write batch of users. Here's why: %v", err)
+		}
+
+		requestItems = response.UnprocessedItems
+		var unprocessed int
+		for _, requests := range requestItems {
+			unprocessed += len(requests)
+		}
+		if unprocessed == 0 {
+			return nil, nil
 		}
+		if attempt == maxAttempts {
+			return requestItems, fmt.Errorf("couldn't write %d unprocessed items", unprocessed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return requestItems, fmt.Errorf("couldn't write unprocessed items. Here's why: %v", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Create inserts a new user, unless another user already registered its
+// email.
+//
+// xerrors.ErrPendingVerification is returned when the other user is not
+// activated and was created within the PendingWindow, so the client can
+// resend the verification instead. xerrors.ErrDuplicateEmail is returned
+// otherwise. The email is looked up in the IndexName index, which is
+// eventually consistent: simultaneous registrations may both succeed.
+//
+// With an EmailTableName, the email is claimed along with the insert, and
+// xerrors.ErrDuplicateEmail is returned when it is already claimed.
+// xerrors.ErrDuplicateUser is returned when the id of the user is taken.
+func (m Model) Create(ctx context.Context, user *User) error {
+	m.transform(user)
+	if err := m.checkEmail(ctx, user); err != nil {
+		return err
 	}
 
-	return userOut, nil
+	return m.insert(ctx, user)
 }
 
-// Update updates a user that already exists in the DynamoDB table with the
-// new attributes. Current user attributes are not required to be passed.
+// emailClaim is the item of the EmailTableName claiming an email for a
+// user.
+type emailClaim struct {
+	Email string `dynamodbav:"email"`
+	// Owner is the id of the user. It isn't named userID, so the claims
+	// aren't mistaken for users.
+	Owner string `dynamodbav:"owner"`
+}
+
+// claimKey returns the key of the claim of the email.
+func claimKey(email string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"email": &types.AttributeValueMemberS{Value: email}}
+}
+
+// ownedBy checks that the claim of an email is missing, or belongs to the
+// user with the id.
+func ownedBy(id string) expression.ConditionBuilder {
+	return expression.AttributeNotExists(expression.Name("email")).
+		Or(expression.Name("owner").Equal(expression.Value(id)))
+}
+
+// claimOp claims the email of the user, unless another user claimed it.
+func (m Model) claimOp(user *User) TransactOp {
+	return PutOp(emailClaim{Email: user.Email, Owner: user.ID}).In(m.EmailTableName).If(ownedBy(user.ID))
+}
+
+// releaseOp releases the claim of the email by the user with the id. The
+// claim of another user is left as is, and cancels the transaction.
+func (m Model) releaseOp(email, id string) TransactOp {
+	return DeleteOp(claimKey(email)).In(m.EmailTableName).If(ownedBy(id))
+}
+
+// putClaimingEmail puts the user, already transformed, if the condition is
+// met, and claims its email in the same transaction. The claim of its
+// previous email, if it changed, is released.
 //
-// If the user does not already exist, it adds a new item to the table.
-// This function uses the `expression` package to build the update
-// expression.
-// The Version attribute of the user is automatically updated to handle
-// race conditions.
-func (m Model) Update(user *User, newAttributes map[string]interface{}) (map[string]interface{}, error) {
-	var err error
-	var response *dynamodb.UpdateItemOutput
-	var attributeMap map[string]interface{}
+// xerrors.ErrConditionFailed is returned when the condition fails, and
+// xerrors.ErrDuplicateEmail when another user claimed the email.
+func (m Model) putClaimingEmail(ctx context.Context, user *User, condition expression.ConditionBuilder, previousEmail string) error {
+	ops := []TransactOp{PutOp(user).If(condition), m.claimOp(user)}
+	if previousEmail != "" && previousEmail != user.Email {
+		ops = append(ops, m.releaseOp(previousEmail, user.ID))
+	}
 
-	var update expression.UpdateBuilder
-	first := true
-	for k, v := range newAttributes {
-		if first {
-			update = expression.Set(expression.Name(k), expression.Value(v))
-			first = false
-		} else {
-			update.Set(expression.Name(k), expression.Value(v))
+	return claimError(m.Transact(ctx, ops...))
+}
+
+// claimError translates the error of a transaction whose first operation
+// writes a user, and whose second one claims its email:
+// xerrors.ErrConditionFailed is returned when the write is rejected, and
+// xerrors.ErrDuplicateEmail when the claim is.
+func claimError(err error) error {
+	var transactErr *TransactionError
+	if !errors.As(err, &transactErr) {
+		return err
+	}
+
+	for _, i := range transactErr.ConditionFailed() {
+		switch i {
+		case 0:
+			return xerrors.ErrConditionFailed
+		case 1:
+			return xerrors.ErrDuplicateEmail
 		}
 	}
-	update.Set(expression.Name("version"), expression.Value(user.Version+1))
+	return fmt.Errorf("couldn't write user. Here's why: %v", err)
+}
+
+// CreateIfAbsent inserts a new user like Create, unless a user with the
+// same id already exists, in which case xerrors.ErrConditionFailed is
+// returned.
+func (m Model) CreateIfAbsent(ctx context.Context, user *User) error {
+	m.transform(user)
+	if err := m.checkEmail(ctx, user); err != nil {
+		return err
+	}
 
-	condition := expression.Name("version").Equal(expression.Value(user.Version))
+	condition := expression.AttributeNotExists(expression.Name("userID"))
+	if m.EmailTableName != "" {
+		return m.putClaimingEmail(ctx, user, condition, "")
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	return m.put(ctx, user, condition)
+}
 
-	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+// Replace replaces the stored user by the given user, if the stored
+// version is still the given version. The version of the user is set to
+// the next version.
+//
+// xerrors.ErrConditionFailed is returned when the version doesn't match,
+// or when the user doesn't exist. The email is checked like in Create.
+func (m Model) Replace(ctx context.Context, user *User, version int64) error {
+	m.transform(user)
+	if err := m.checkEmail(ctx, user); err != nil {
+		return err
+	}
+
+	user.Version = version + 1
+	condition := m.versionCondition(version)
+
+	if m.EmailTableName != "" {
+		// The stored email is the previous email of the user as long as
+		// the version still matches.
+		stored, err := m.getConsistent(ctx, user.ID)
+		if errors.Is(err, xerrors.ErrRecordNotFound) {
+			return xerrors.ErrConditionFailed
+		}
+		if err != nil {
+			return err
+		}
+		return m.putClaimingEmail(ctx, user, condition, stored.Email)
+	}
+
+	return m.put(ctx, user, condition)
+}
+
+// put inserts the user, already transformed, if the condition is met, and
+// returns xerrors.ErrConditionFailed otherwise.
+func (m Model) put(ctx context.Context, user *User, condition expression.ConditionBuilder) error {
+	item, err := attributevalue.MarshalMap(user)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't build expression for update. Here's why: %v", err)
-	} else {
-		response, err = m.DynamoDbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		panic(err)
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("couldn't build expression for put. Here's why: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.retry(ctx, func() error {
+		_, err := m.DynamoDbClient.PutItem(ctx, &dynamodb.PutItemInput{
 			TableName:                 aws.String(m.TableName),
-			Key:                       user.GetKey(),
+			Item:                      item,
 			ExpressionAttributeNames:  expr.Names(),
 			ExpressionAttributeValues: expr.Values(),
-			UpdateExpression:          expr.Update(),
 			ConditionExpression:       expr.Condition(),
-			ReturnValues:              types.ReturnValueUpdatedNew,
 		})
-		if err != nil {
-			var ccf *types.ConditionalCheckFailedException
-			switch {
-			case errors.As(err, &ccf):
-				return nil, xerrors.ErrEditConflict
-			default:
-				return nil, fmt.Errorf("couldn't update id %v. Here's why: %v", user.ID, err)
-			}
-		} else {
-			err = attributevalue.UnmarshalMap(response.Attributes, &attributeMap)
-			if err != nil {
-				return nil, fmt.Errorf("couldn't unmarshall update response. Here's why: %v", err)
-			}
+		return err
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return xerrors.ErrConditionFailed
 		}
+		return fmt.Errorf("couldn't add item to table. Here's why: %v", err)
 	}
 
-	return attributeMap, nil
+	return nil
 }
 
-// Delete deletes the user from the table in DynamoDB.
+// checkEmail checks that no other user registered the email of the user.
 //
-// The operation is idempotent; running it multiple times on
-// the same item or attribute does not result in an error response.
-func (m Model) Delete(user *User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	_, err := m.DynamoDbClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-		TableName: aws.String(m.TableName), Key: user.GetKey(),
-	})
+// xerrors.ErrPendingVerification or xerrors.ErrDuplicateEmail are
+// returned like in Create.
+func (m Model) checkEmail(ctx context.Context, user *User) error {
+	ids, err := m.emailOwners(ctx, user.Email)
 	if err != nil {
-		return fmt.Errorf("couldn't delete %v from the table. Here's why: %v", user.ID, err)
+		return err
+	}
+
+	for _, id := range ids {
+		if id == user.ID {
+			continue
+		}
+
+		existing, err := m.Get(ctx, id)
+		if errors.Is(err, xerrors.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if !existing.Activated && m.isPending(existing, time.Now()) {
+			return xerrors.ErrPendingVerification
+		}
+		return xerrors.ErrDuplicateEmail
 	}
 
 	return nil
 }
 
-// DeleteTable deletes the DynamoDB table and all of its data.
+// isPending reports whether the user was created within the
+// PendingWindow. The creation date has a granularity of a day.
+func (m Model) isPending(user *User, now time.Time) bool {
+	createdAt, err := time.Parse("2006-01-02", user.CreatedAt)
+	if err != nil {
+		return false
+	}
+
+	return now.Sub(createdAt) < m.PendingWindow
+}
+
+// emailOwners returns the ids of the users registered with the email.
 //
-// * SHOULD ONLY BE USED DURING TESTING *
+// No user is returned when the model has no email index.
+func (m Model) emailOwners(ctx context.Context, email string) ([]string, error) {
+	if m.IndexName == "" {
+		return nil, nil
+	}
+
+	keyCondition := expression.Key("email").Equal(expression.Value(email))
+	projection := expression.NamesList(expression.Name("userID"))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).WithProjection(projection).Build()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build expression for query. Here's why: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var response *dynamodb.QueryOutput
+	err = m.retry(ctx, func() (err error) {
+		response, err = m.DynamoDbClient.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(m.TableName),
+			IndexName:                 aws.String(m.IndexName),
+			KeyConditionExpression:    expr.KeyCondition(),
+			ProjectionExpression:      expr.Projection(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't query users by email. Here's why: %v", err)
+	}
+
+	var owners []User
+	err = attributevalue.UnmarshalListOfMaps(response.Items, &owners)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal query response. Here's why: %v", err)
+	}
+
+	ids := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		ids = append(ids, owner.ID)
+	}
+
+	return ids, nil
+}
+
+// Get retrieves the user with the specific id.
+//
+// xerrors.ErrRecordNotFound is returned when no user was found with the
+// given id, and for the soft-deleted users as well, unless the Model
+// includes them. The user is fetched along with other users when the Model
+// has a Batcher, unless the read is consistent.
+func (m Model) Get(ctx context.Context, id string) (*User, error) {
+	user, err := m.get(ctx, id)
+	if err != nil || m.IncludeDeleted || user.DeletedAt == "" {
+		return user, err
+	}
+
+	return nil, xerrors.ErrRecordNotFound
+}
+
+// get gets the user, even when it is soft-deleted.
+func (m Model) get(ctx context.Context, id string) (*User, error) {
+	if m.Batcher != nil && !m.ConsistentRead {
+		return m.Batcher.get(ctx, m, id)
+	}
+
+	userIn := User{ID: id}
+	userOut := &User{}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var response *dynamodb.GetItemOutput
+	err := m.retry(ctx, func() (err error) {
+		response, err = m.DynamoDbClient.GetItem(ctx, &dynamodb.GetItemInput{
+			Key: userIn.GetKey(), TableName: aws.String(m.TableName), ConsistentRead: aws.Bool(m.ConsistentRead),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get info about %v. Here's why: %v", id, err)
+	} else if len(response.Item) == 0 {
+		return nil, xerrors.ErrRecordNotFound
+	} else {
+		err = attributevalue.UnmarshalMap(response.Item, userOut)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't unmarshal response. Here's why: %v", err)
+		}
+	}
+
+	return userOut, nil
+}
+
+// getConsistent gets the user like get, with a strongly consistent read.
+func (m Model) getConsistent(ctx context.Context, id string) (*User, error) {
+	m.ConsistentRead = true
+	return m.get(ctx, id)
+}
+
+// ErrAmbiguousEmail is returned by GetByEmail when several users are
+// registered with the email.
+var ErrAmbiguousEmail = errors.New("several users are registered with the email")
+
+// GetByEmail retrieves the user registered with the email, which is
+// looked up in the IndexName index. The index only projects the ids, so
+// the user is then fetched with Get.
+//
+// xerrors.ErrRecordNotFound is returned when no user is registered with
+// the email, and ErrAmbiguousEmail when several users are.
+func (m Model) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if m.IndexName == "" {
+		return nil, errors.New("couldn't get user by email. Here's why: the model has no email index")
+	}
+
+	ids, err := m.emailOwners(ctx, NormalizeEmail(email))
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(ids) {
+	case 0:
+		return nil, xerrors.ErrRecordNotFound
+	case 1:
+		return m.Get(ctx, ids[0])
+	default:
+		return nil, ErrAmbiguousEmail
+	}
+}
+
+// GetVersion retrieves the version of the user with the specific id,
+// without the rest of the user. The legacy users stored without a version
+// are at version 0.
+//
+// xerrors.ErrRecordNotFound is returned when the user doesn't exist, or
+// is soft-deleted and the Model doesn't include the soft-deleted users.
+func (m Model) GetVersion(ctx context.Context, id string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	expr, err := expression.NewBuilder().
+		WithProjection(expression.NamesList(expression.Name("userID"), expression.Name("version"), expression.Name("deletedAt"))).
+		Build()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't build expression for version. Here's why: %v", err)
+	}
+
+	var response *dynamodb.GetItemOutput
+	err = m.retry(ctx, func() (err error) {
+		response, err = m.DynamoDbClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:                aws.String(m.TableName),
+			Key:                      User{ID: id}.GetKey(),
+			ProjectionExpression:     expr.Projection(),
+			ExpressionAttributeNames: expr.Names(),
+			ConsistentRead:           aws.Bool(m.ConsistentRead),
+		})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get version of id %v. Here's why: %v", id, err)
+	}
+	if len(response.Item) == 0 {
+		return 0, xerrors.ErrRecordNotFound
+	}
+
+	var stored struct {
+		Version   int64  `dynamodbav:"version"`
+		DeletedAt string `dynamodbav:"deletedAt"`
+	}
+	err = attributevalue.UnmarshalMap(response.Item, &stored)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't unmarshal response. Here's why: %v", err)
+	}
+	if stored.DeletedAt != "" && !m.IncludeDeleted {
+		return 0, xerrors.ErrRecordNotFound
+	}
+
+	return stored.Version, nil
+}
+
+// GetRaw retrieves the item of the user with the specific id, as stored
+// in the table.
+//
+// If no user was found with the given id, ErrRecordNotFound is returned.
+func (m Model) GetRaw(ctx context.Context, id string) (map[string]types.AttributeValue, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var response *dynamodb.GetItemOutput
+	err := m.retry(ctx, func() (err error) {
+		response, err = m.DynamoDbClient.GetItem(ctx, &dynamodb.GetItemInput{
+			Key: User{ID: id}.GetKey(), TableName: aws.String(m.TableName), ConsistentRead: aws.Bool(m.ConsistentRead),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get info about %v. Here's why: %v", id, err)
+	}
+	if len(response.Item) == 0 {
+		return nil, xerrors.ErrRecordNotFound
+	}
+
+	return response.Item, nil
+}
+
+// MaxBatchGetKeys is the maximum number of keys of a single BatchGetItem call.
+const MaxBatchGetKeys = 100
+
+// BatchGet retrieves the users with the given ids.
+//
+// The users are returned by id, and ids without a user are missing from
+// the map, as well as the soft-deleted users unless the Model includes
+// them. The ids are requested by chunks of MaxBatchGetKeys, and the
+// keys left unprocessed by DynamoDB are requested again with backoff.
+// The ids must be unique.
+//
+// When some keys are still unprocessed once the attempts run out, the
+// users which were fetched are returned along with a *xerrors.BatchError
+// listing the ids which weren't.
+func (m Model) BatchGet(ctx context.Context, ids []string) (map[string]*User, error) {
+	users := make(map[string]*User, len(ids))
+	var unfetched []string
+	var unfetchedErr error
+
+	for start := 0; start < len(ids); start += MaxBatchGetKeys {
+		end := start + MaxBatchGetKeys
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		keys := make([]map[string]types.AttributeValue, 0, end-start)
+		for _, id := range ids[start:end] {
+			keys = append(keys, User{ID: id}.GetKey())
+		}
+
+		unprocessed, err := m.batchGet(ctx, keys, users)
+		if len(unprocessed) > 0 {
+			for _, key := range unprocessed {
+				var user User
+				if err := attributevalue.UnmarshalMap(key, &user); err != nil {
+					return nil, fmt.Errorf("couldn't unmarshal unprocessed key. Here's why: %v", err)
+				}
+				unfetched = append(unfetched, user.ID)
+			}
+			unfetchedErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !m.IncludeDeleted {
+		for id, user := range users {
+			if user.DeletedAt != "" {
+				delete(users, id)
+			}
+		}
+	}
+
+	if len(unfetched) > 0 {
+		return users, &xerrors.BatchError{IDs: unfetched, Err: unfetchedErr}
+	}
+
+	return users, nil
+}
+
+// GetBatch retrieves the users with the given ids, in the order of the
+// ids. The ids without a user are left out, and BatchGet tells them apart.
+//
+// Like BatchGet, the users which were fetched are returned along with a
+// *xerrors.BatchError when some ids couldn't be.
+func (m Model) GetBatch(ctx context.Context, ids []string) ([]*User, error) {
+	found, err := m.BatchGet(ctx, ids)
+	if found == nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0, len(found))
+	for _, id := range ids {
+		if user, ok := found[id]; ok {
+			users = append(users, user)
+		}
+	}
+
+	return users, err
+}
+
+// batchGet retrieves a chunk of keys into users, until no key is left
+// unprocessed or the attempts run out. The keys still unprocessed are
+// returned along with the error.
+func (m Model) batchGet(ctx context.Context, keys []map[string]types.AttributeValue, users map[string]*User) ([]map[string]types.AttributeValue, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	requestItems := map[string]types.KeysAndAttributes{m.TableName: {Keys: keys, ConsistentRead: aws.Bool(m.ConsistentRead)}}
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		var response *dynamodb.BatchGetItemOutput
+		err := m.retry(ctx, func() (err error) {
+			response, err = m.DynamoDbClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: requestItems,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get batch of users. Here's why: %v", err)
+		}
+
+		var page []*User
+		err = attributevalue.UnmarshalListOfMaps(response.Responses[m.TableName], &page)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't unmarshal batch response. Here's why: %v", err)
+		}
+		for _, user := range page {
+			users[user.ID] = user
+		}
+
+		requestItems = response.UnprocessedKeys
+		unprocessed := requestItems[m.TableName].Keys
+		if len(unprocessed) == 0 {
+			return nil, nil
+		}
+		if attempt == maxAttempts {
+			return unprocessed, fmt.Errorf("couldn't get %d unprocessed users", len(unprocessed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return unprocessed, fmt.Errorf("couldn't get unprocessed users. Here's why: %v", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Update updates a user that already exists in the DynamoDB table with the
+// new attributes. Current user attributes are not required to be passed.
+//
+// A user which no longer exists is never re-created: ErrEditConflict is
+// returned instead.
+// This function uses the `expression` package to build the update
+// expression.
+// The Version attribute of the user is automatically updated to handle
+// race conditions. The ReservedAttributes are never updated, and the
+// attributes whose new value is nil are removed from the item.
+//
+// The update is only applied when the conditions, if any, are met as
+// well, such as activated being false. ErrConditionFailed is returned when
+// one of them fails, and ErrEditConflict when the version check fails.
+//
+// A new email is checked like in Create. With an EmailTableName, the new
+// email is claimed and the previous one released in the same transaction
+// as the update.
+func (m Model) Update(ctx context.Context, user *User, newAttributes map[string]interface{}, conditions ...expression.ConditionBuilder) (map[string]interface{}, error) {
+	var err error
+	var response *dynamodb.UpdateItemOutput
+	var attributeMap map[string]interface{}
+
+	newAttributes, err = m.transformAttributes(user, newAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	email, ok := newAttributes["email"].(string)
+	changesEmail := ok && email != user.Email
+	if changesEmail {
+		if err = m.checkEmail(ctx, &User{ID: user.ID, Email: email}); err != nil {
+			return nil, err
+		}
+	}
+
+	update := expression.Set(expression.Name("version"), expression.Value(user.Version+1))
+	for k, v := range newAttributes {
+		switch {
+		case validator.In(k, ReservedAttributes...):
+		case v == nil:
+			update = update.Remove(expression.Name(k))
+		default:
+			update = update.Set(expression.Name(k), expression.Value(v))
+		}
+	}
+
+	condition := m.versionCondition(user.Version)
+	if len(conditions) > 0 {
+		condition = condition.And(conditions[0], conditions[1:]...)
+	}
+
+	if changesEmail && m.EmailTableName != "" {
+		return m.updateClaimingEmail(ctx, user, email, update, condition, len(conditions) > 0, newAttributes)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't build expression for update. Here's why: %v", err)
+	} else {
+		err = m.retry(ctx, func() (err error) {
+			response, err = m.DynamoDbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+				TableName:                 aws.String(m.TableName),
+				Key:                       user.GetKey(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+				UpdateExpression:          expr.Update(),
+				ConditionExpression:       expr.Condition(),
+				ReturnValues:              types.ReturnValueUpdatedNew,
+			})
+			return err
+		})
+		if err != nil {
+			var ccf *types.ConditionalCheckFailedException
+			switch {
+			case errors.As(err, &ccf) && len(conditions) > 0:
+				return nil, m.conditionError(ctx, user)
+			case errors.As(err, &ccf):
+				return nil, xerrors.ErrEditConflict
+			default:
+				return nil, fmt.Errorf("couldn't update id %v. Here's why: %v", user.ID, err)
+			}
+		} else {
+			err = attributevalue.UnmarshalMap(response.Attributes, &attributeMap)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't unmarshall update response. Here's why: %v", err)
+			}
+		}
+	}
+
+	return attributeMap, nil
+}
+
+// updateClaimingEmail applies the update of the user changing its email,
+// and claims the new email and releases the previous one in the same
+// transaction. The errors are the ones of Update, and the attributes set
+// by the update are returned.
+func (m Model) updateClaimingEmail(ctx context.Context, user *User, email string, update expression.UpdateBuilder, condition expression.ConditionBuilder, conditioned bool, newAttributes map[string]interface{}) (map[string]interface{}, error) {
+	ops := []TransactOp{UpdateOp(user.GetKey(), update).If(condition), m.claimOp(&User{ID: user.ID, Email: email})}
+	if user.Email != "" {
+		ops = append(ops, m.releaseOp(user.Email, user.ID))
+	}
+
+	err := claimError(m.Transact(ctx, ops...))
+	switch {
+	case errors.Is(err, xerrors.ErrConditionFailed) && conditioned:
+		return nil, m.conditionError(ctx, user)
+	case errors.Is(err, xerrors.ErrConditionFailed):
+		return nil, xerrors.ErrEditConflict
+	case err != nil:
+		return nil, err
+	}
+
+	attributes := map[string]interface{}{"version": user.Version + 1}
+	for k, v := range newAttributes {
+		if v != nil && !validator.In(k, ReservedAttributes...) {
+			attributes[k] = v
+		}
+	}
+	item, err := attributevalue.MarshalMap(attributes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal updated attributes. Here's why: %v", err)
+	}
+	var attributeMap map[string]interface{}
+	if err = attributevalue.UnmarshalMap(item, &attributeMap); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshall updated attributes. Here's why: %v", err)
+	}
+
+	return attributeMap, nil
+}
+
+// ReservedAttributes are the attributes managed by the model, which Update
+// leaves out of the new attributes.
+var ReservedAttributes = []string{"userID", "createdAt", "version"}
+
+// conditionError tells which condition of a rejected update failed, by
+// comparing the stored version of the user with its expected version.
+//
+// DynamoDB doesn't report which part of a condition failed, so the user
+// is read again, with a strongly consistent read so the rejected write is
+// seen: ErrConditionFailed is returned when its version still matches,
+// and ErrEditConflict otherwise.
+func (m Model) conditionError(ctx context.Context, user *User) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var response *dynamodb.GetItemOutput
+	err := m.retry(ctx, func() (err error) {
+		response, err = m.DynamoDbClient.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:            aws.String(m.TableName),
+			Key:                  user.GetKey(),
+			ProjectionExpression: aws.String("version"),
+			ConsistentRead:       aws.Bool(true),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't get version of id %v. Here's why: %v", user.ID, err)
+	}
+	if len(response.Item) == 0 {
+		return xerrors.ErrEditConflict
+	}
+
+	var stored struct {
+		Version *int64 `dynamodbav:"version"`
+	}
+	err = attributevalue.UnmarshalMap(response.Item, &stored)
+	if err != nil {
+		return fmt.Errorf("couldn't unmarshal response. Here's why: %v", err)
+	}
+
+	switch {
+	case stored.Version != nil && *stored.Version == user.Version:
+		return xerrors.ErrConditionFailed
+	case stored.Version == nil && m.VersionGrace && user.Version == 0:
+		return xerrors.ErrConditionFailed
+	default:
+		return xerrors.ErrEditConflict
+	}
+}
+
+// versionCondition checks that the user exists and that its stored
+// version is still the given version, so a versioned write never
+// re-creates a deleted user.
+//
+// With VersionGrace, a missing version matches version 0.
+func (m Model) versionCondition(version int64) expression.ConditionBuilder {
+	condition := expression.Name("version").Equal(expression.Value(version))
+	if m.VersionGrace && version == 0 {
+		condition = expression.AttributeNotExists(expression.Name("version")).Or(condition)
+	}
+
+	return expression.AttributeExists(expression.Name("userID")).And(condition)
+}
+
+// Activate marks the email of the user as verified, and removes its
+// pending verification.
+//
+// The Version attribute of the user is checked and incremented like in
+// Update.
+func (m Model) Activate(ctx context.Context, user *User) error {
+	update := expression.Set(expression.Name("activated"), expression.Value(true)).
+		Set(expression.Name("version"), expression.Value(user.Version+1)).
+		Remove(expression.Name("verification"))
+	condition := m.versionCondition(user.Version)
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("couldn't build expression for activation. Here's why: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.retry(ctx, func() error {
+		_, err := m.DynamoDbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(m.TableName),
+			Key:                       user.GetKey(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+		})
+		return err
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return xerrors.ErrEditConflict
+		}
+		return fmt.Errorf("couldn't activate id %v. Here's why: %v", user.ID, err)
+	}
+
+	user.Activated = true
+	user.Verification = nil
+	user.Version++
+
+	return nil
+}
+
+// SetPhoneVerification replaces the pending phone verification of the
+// user, such as with a new code or more attempts.
+//
+// The Version attribute of the user is checked and incremented like in
+// Update.
+func (m Model) SetPhoneVerification(ctx context.Context, user *User, verification *PhoneVerification) error {
+	update := expression.Set(expression.Name("phoneVerification"), expression.Value(verification)).
+		Set(expression.Name("version"), expression.Value(user.Version+1))
+
+	err := m.updateVersioned(ctx, user, update, "phone verification")
+	if err != nil {
+		return err
+	}
+
+	user.PhoneVerification = verification
+	user.Version++
+
+	return nil
+}
+
+// VerifyPhone sets the phone of the pending phone verification of the
+// user as its verified phone, and removes the verification.
+//
+// The Version attribute of the user is checked and incremented like in
+// Update.
+func (m Model) VerifyPhone(ctx context.Context, user *User) error {
+	if user.PhoneVerification == nil {
+		return errors.New("couldn't verify phone without a pending verification")
+	}
+
+	update := expression.Set(expression.Name("phone"), expression.Value(user.PhoneVerification.Phone)).
+		Set(expression.Name("phoneVerified"), expression.Value(true)).
+		Set(expression.Name("version"), expression.Value(user.Version+1)).
+		Remove(expression.Name("phoneVerification"))
+
+	err := m.updateVersioned(ctx, user, update, "phone")
+	if err != nil {
+		return err
+	}
+
+	user.Phone = user.PhoneVerification.Phone
+	user.PhoneVerified = true
+	user.PhoneVerification = nil
+	user.Version++
+
+	return nil
+}
+
+// updateVersioned applies the update to the user, if its version is still
+// the stored one. What names the update in the errors.
+func (m Model) updateVersioned(ctx context.Context, user *User, update expression.UpdateBuilder, what string) error {
+	condition := m.versionCondition(user.Version)
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("couldn't build expression for %v. Here's why: %v", what, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err = m.retry(ctx, func() error {
+		_, err := m.DynamoDbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(m.TableName),
+			Key:                       user.GetKey(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+		})
+		return err
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return xerrors.ErrEditConflict
+		}
+		return fmt.Errorf("couldn't update %v of id %v. Here's why: %v", what, user.ID, err)
+	}
+
+	return nil
+}
+
+// ErrNotNumeric is returned when incrementing an attribute which is not a
+// numeric attribute of User.
+var ErrNotNumeric = errors.New("attribute is not a numeric attribute of the user")
+
+// NumericAttributes are the numeric attributes of User which can be
+// incremented, the version excepted.
+var NumericAttributes = numericAttributes()
+
+// numericAttributes lists the integer attributes of User.
+func numericAttributes() []string {
+	var names []string
+	typ := reflect.TypeOf(User{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("dynamodbav"), ",")
+		if field.Type.Kind() == reflect.Int64 && name != "version" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Increment atomically adds delta, which may be negative, to the numeric
+// attribute of the user with the specific id, and returns its new value.
+//
+// The attribute is a dynamodb attribute name, which must be one of
+// NumericAttributes, else ErrNotNumeric is returned. A missing attribute
+// is incremented from 0. The version of the user is incremented too, so
+// the concurrent updates of the user conflict with the increment. If no
+// user was found with the given id, ErrRecordNotFound is returned.
+func (m Model) Increment(ctx context.Context, id, attribute string, delta int64) (int64, error) {
+	if !validator.In(attribute, NumericAttributes...) {
+		return 0, fmt.Errorf("%w: %v", ErrNotNumeric, attribute)
+	}
+
+	update := expression.Add(expression.Name(attribute), expression.Value(delta)).
+		Add(expression.Name("version"), expression.Value(1))
+	condition := expression.AttributeExists(expression.Name("userID"))
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't build expression for increment. Here's why: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var response *dynamodb.UpdateItemOutput
+	err = m.retry(ctx, func() (err error) {
+		response, err = m.DynamoDbClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(m.TableName),
+			Key:                       User{ID: id}.GetKey(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ReturnValues:              types.ReturnValueUpdatedNew,
+		})
+		return err
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return 0, xerrors.ErrRecordNotFound
+		}
+		return 0, fmt.Errorf("couldn't increment %v of id %v. Here's why: %v", attribute, id, err)
+	}
+
+	var value int64
+	err = attributevalue.Unmarshal(response.Attributes[attribute], &value)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't unmarshal response. Here's why: %v", err)
+	}
+
+	return value, nil
+}
+
+// ErrNotSlice is returned when replacing an attribute which is not a
+// slice attribute of User.
+var ErrNotSlice = errors.New("attribute is not a slice attribute of the user")
+
+// SliceAttributes are the slice attributes of User which can be replaced
+// as a whole, mapped to their type.
+var SliceAttributes = sliceAttributes()
+
+// sliceAttributes lists the slice attributes of User.
+func sliceAttributes() map[string]reflect.Type {
+	attributes := make(map[string]reflect.Type)
+	typ := reflect.TypeOf(User{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("dynamodbav"), ",")
+		if field.Type.Kind() == reflect.Slice {
+			attributes[name] = field.Type
+		}
+	}
+
+	return attributes
+}
+
+// ReplaceSlice atomically replaces the whole slice attribute of the user
+// with the specific id by value, such as the milestones by a []Milestone.
+//
+// The attribute is a dynamodb attribute name, which must be one of
+// SliceAttributes, else ErrNotSlice is returned. The value must have the
+// type of the attribute, and an empty value removes the attribute. The
+// Version attribute of the user is checked and incremented like in Update.
+// If no user was found with the given id, ErrRecordNotFound is returned.
+func (m Model) ReplaceSlice(ctx context.Context, id, attribute string, value interface{}) error {
+	typ, ok := SliceAttributes[attribute]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrNotSlice, attribute)
+	}
+	if reflect.TypeOf(value) != typ {
+		return fmt.Errorf("couldn't replace %v with a %T, it must be a %v", attribute, value, typ)
+	}
+
+	user, err := m.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	update := expression.Set(expression.Name("version"), expression.Value(user.Version+1))
+	if reflect.ValueOf(value).Len() == 0 {
+		update = update.Remove(expression.Name(attribute))
+	} else {
+		update = update.Set(expression.Name(attribute), expression.Value(value))
+	}
+
+	return m.updateVersioned(ctx, user, update, attribute)
+}
+
+// AppendGoals atomically appends the goals to the goals of the user. The
+// Version attribute of the user is checked and incremented like in Update.
+func (m Model) AppendGoals(ctx context.Context, user *User, goals []Goal) error {
+	if len(goals) == 0 {
+		return nil
+	}
+
+	stored := expression.IfNotExists(expression.Name("goals"), expression.Value([]Goal{}))
+	update := expression.Set(expression.Name("goals"), expression.ListAppend(stored, expression.Value(goals))).
+		Set(expression.Name("version"), expression.Value(user.Version+1))
+
+	return m.updateVersioned(ctx, user, update, "goals")
+}
+
+// Delete deletes the user from the table in DynamoDB.
+//
+// The operation is idempotent; running it multiple times on
+// the same item or attribute does not result in an error response.
+//
+// With an EmailTableName, the claim of the email of the user is released
+// in the same transaction. The user is then read first to learn its email,
+// and xerrors.ErrEditConflict is returned when its email changes
+// meanwhile.
+func (m Model) Delete(ctx context.Context, user *User) error {
+	if m.EmailTableName != "" {
+		return m.deleteReleasingEmail(ctx, user.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.retry(ctx, func() error {
+		_, err := m.DynamoDbClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(m.TableName), Key: user.GetKey(),
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't delete %v from the table. Here's why: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// deleteReleasingEmail deletes the user with the id, and releases the
+// claim of its email in the same transaction.
+func (m Model) deleteReleasingEmail(ctx context.Context, id string) error {
+	stored, err := m.getConsistent(ctx, id)
+	if errors.Is(err, xerrors.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	condition := expression.AttributeNotExists(expression.Name("userID")).
+		Or(expression.Name("email").Equal(expression.Value(stored.Email)))
+	ops := []TransactOp{DeleteOp(stored.GetKey()).If(condition)}
+	if stored.Email != "" {
+		ops = append(ops, m.releaseOp(stored.Email, id))
+	}
+
+	err = m.Transact(ctx, ops...)
+	var transactErr *TransactionError
+	if errors.As(err, &transactErr) {
+		if failed := transactErr.ConditionFailed(); len(failed) > 0 && failed[0] == 0 {
+			return xerrors.ErrEditConflict
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't delete %v from the table. Here's why: %v", id, err)
+	}
+
+	return nil
+}
+
+// ForEach scans the users matching the filter, and calls fn for every
+// one of them, one page at a time. The whole table is scanned when the
+// filter isn't set. The soft-deleted users are left out, unless the Model
+// includes them.
+//
+// Only a single page is held in memory, so it is suited for bulk jobs
+// over many users. The scan stops at the first error returned by fn, and
+// with the error of ctx once it is done, which is checked between the
+// pages and the users. The pages are read within the deadline of ctx.
+func (m Model) ForEach(ctx context.Context, filter expression.ConditionBuilder, fn func(*User) error) error {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(m.TableName),
+	}
+	if err := setFilter(input, m.visibleFilter(filter)); err != nil {
+		return err
+	}
+
+	paginator := dynamodb.NewScanPaginator(m.DynamoDbClient, input)
+	for paginator.HasMorePages() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		page, err := m.nextPage(ctx, paginator)
+		if err != nil {
+			return fmt.Errorf("couldn't scan table %v. Here's why: %v", m.TableName, err)
+		}
+
+		var users []*User
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &users)
+		if err != nil {
+			return fmt.Errorf("couldn't unmarshal scan response. Here's why: %v", err)
+		}
+
+		for _, user := range users {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			if err = fn(user); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// visibleFilter adds the condition leaving out the soft-deleted users to
+// the filter, unless the Model includes them.
+func (m Model) visibleFilter(filter expression.ConditionBuilder) expression.ConditionBuilder {
+	if m.IncludeDeleted {
+		return filter
+	}
+
+	notDeleted := expression.AttributeNotExists(expression.Name("deletedAt"))
+	if !filter.IsSet() {
+		return notDeleted
+	}
+	return filter.And(notDeleted)
+}
+
+// setFilter sets the filter of the scan, unless it isn't set, along with
+// the projection of the attributes, if any.
+func setFilter(input *dynamodb.ScanInput, filter expression.ConditionBuilder, projection ...expression.NameBuilder) error {
+	if !filter.IsSet() && len(projection) == 0 {
+		return nil
+	}
+
+	builder := expression.NewBuilder()
+	if filter.IsSet() {
+		builder = builder.WithFilter(filter)
+	}
+	if len(projection) > 0 {
+		builder = builder.WithProjection(expression.NamesList(projection[0], projection[1:]...))
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return fmt.Errorf("couldn't build expression for scan. Here's why: %v", err)
+	}
+	input.FilterExpression = expr.Filter()
+	input.ProjectionExpression = expr.Projection()
+	input.ExpressionAttributeNames = expr.Names()
+	input.ExpressionAttributeValues = expr.Values()
+
+	return nil
+}
+
+// ErrNotDistinct is returned when listing the distinct values of an
+// attribute which is not one of DistinctAttributes.
+var ErrNotDistinct = errors.New("attribute doesn't support listing its distinct values")
+
+// DistinctAttributes are the attributes of User with few distinct values,
+// which can be listed by DistinctValues.
+var DistinctAttributes = []string{"countryCodeAlpha2", "provinceCode", "currency"}
+
+// DistinctValues scans the whole table, and returns the sorted distinct
+// values of the attribute, such as the countries of the users.
+//
+// The attribute is a dynamodb attribute name, which must be one of
+// DistinctAttributes, else ErrNotDistinct is returned. Only the attribute
+// is read, and the users without it are left out, as are the soft-deleted
+// users unless the Model includes them.
+func (m Model) DistinctValues(ctx context.Context, attribute string) ([]string, error) {
+	if !validator.In(attribute, DistinctAttributes...) {
+		return nil, fmt.Errorf("%w: %v", ErrNotDistinct, attribute)
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(m.TableName),
+	}
+	err := setFilter(input, m.visibleFilter(expression.ConditionBuilder{}), expression.Name(attribute))
+	if err != nil {
+		return nil, err
+	}
+
+	paginator := dynamodb.NewScanPaginator(m.DynamoDbClient, input)
+	seen := make(map[string]bool)
+	var values []string
+	for paginator.HasMorePages() {
+		page, err := m.nextPage(ctx, paginator)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan table %v. Here's why: %v", m.TableName, err)
+		}
+
+		for _, item := range page.Items {
+			var value string
+			if err = attributevalue.Unmarshal(item[attribute], &value); err != nil {
+				return nil, fmt.Errorf("couldn't unmarshal scan response. Here's why: %v", err)
+			}
+			if value != "" && !seen[value] {
+				seen[value] = true
+				values = append(values, value)
+			}
+		}
+	}
+	sort.Strings(values)
+
+	return values, nil
+}
+
+// List returns up to limit users scanned from startKey, along with the key
+// where the next list starts, like ListFunc. The users are never nil, so
+// an empty page is an empty slice.
+//
+// The list stops with the error of ctx once it is done. Each page is read
+// within its own timeout, derived from ctx.
+func (m Model) List(ctx context.Context, limit int, startKey map[string]types.AttributeValue) ([]*User, map[string]types.AttributeValue, error) {
+	users := []*User{}
+	nextKey, err := m.ListFunc(ctx, expression.ConditionBuilder{}, limit, startKey, func(user *User) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	})
+
+	return users, nextKey, err
+}
+
+// ListFunc scans up to limit users matching the filter from startKey,
+// calling fn for every user as it is read. Every user is read when the
+// filter isn't set, except the soft-deleted users unless the Model
+// includes them.
+//
+// The returned key is where the next list starts, and is nil once the
+// whole table is scanned. Pages are requested until limit users are read,
+// as DynamoDB may return less items than asked for. The scan stops at the
+// first error returned by fn, and with the error of ctx once it is done,
+// which is checked between the pages.
+//
+// DynamoDB filters the users once they are read, so a selective filter
+// may scan many pages to find limit users.
+//
+// With SkipCorruptItems, the items which can't be unmarshalled are
+// skipped, and reported in a *CorruptItemsError returned along with the
+// next key once the list is complete. The skipped items count towards the
+// limit.
+func (m Model) ListFunc(ctx context.Context, filter expression.ConditionBuilder, limit int, startKey map[string]types.AttributeValue, fn func(*User) error) (map[string]types.AttributeValue, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(m.TableName),
+	}
+	if err := setFilter(input, m.visibleFilter(filter)); err != nil {
+		return nil, err
+	}
+
+	var corrupt *CorruptItemsError
+	for read := 0; read < limit; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		input.Limit = aws.Int32(int32(limit - read))
+		input.ExclusiveStartKey = startKey
+		page, err := m.scanPage(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't scan table %v. Here's why: %v", m.TableName, err)
+		}
+
+		for _, item := range page.Items {
+			user := new(User)
+			err = attributevalue.UnmarshalMap(item, user)
+			if err != nil {
+				if !m.SkipCorruptItems {
+					return nil, fmt.Errorf("couldn't unmarshal scan response. Here's why: %v", err)
+				}
+				if corrupt == nil {
+					corrupt = &CorruptItemsError{}
+				}
+				corrupt.add(item, err)
+				continue
+			}
+
+			if err = fn(user); err != nil {
+				return nil, err
+			}
+		}
+
+		read += len(page.Items)
+		startKey = page.LastEvaluatedKey
+		if len(startKey) == 0 {
+			startKey = nil
+			break
+		}
+	}
+
+	if corrupt != nil {
+		return startKey, corrupt
+	}
+
+	return startKey, nil
+}
+
+// scanPage fetches a page of the scan within its own timeout, derived
+// from ctx.
+func (m Model) scanPage(ctx context.Context, input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var page *dynamodb.ScanOutput
+	err := m.retry(ctx, func() (err error) {
+		page, err = m.DynamoDbClient.Scan(ctx, input)
+		return err
+	})
+
+	return page, err
+}
+
+// nextPage fetches the next page of a scan within its own timeout, derived
+// from ctx.
+func (m Model) nextPage(ctx context.Context, paginator *dynamodb.ScanPaginator) (*dynamodb.ScanOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var page *dynamodb.ScanOutput
+	err := m.retry(ctx, func() (err error) {
+		page, err = paginator.NextPage(ctx)
+		return err
+	})
+
+	return page, err
+}
+
+// DeleteTable deletes the DynamoDB table and all of its data.
+//
+// * SHOULD ONLY BE USED DURING TESTING *
 //
 // If a table is in CREATING or UPDATING states, then DynamoDB returns a
 // ResourceInUseException. If the specified table does not exist, DynamoDB
 // returns a ResourceNotFoundException. If table is already in the DELETING
 // state, no error is returned.
-func (m Model) DeleteTable() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+func (m Model) DeleteTable(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
 	_, err := m.DynamoDbClient.DeleteTable(ctx, &dynamodb.DeleteTableInput{
@@ -273,5 +1953,14 @@ func (m Model) DeleteTable() error {
 		return fmt.Errorf("Couldn't delete table %v. Here's why: %v\n", m.TableName, err)
 	}
 
+	if m.EmailTableName != "" {
+		_, err = m.DynamoDbClient.DeleteTable(ctx, &dynamodb.DeleteTableInput{
+			TableName: aws.String(m.EmailTableName),
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't delete table %v. Here's why: %v", m.EmailTableName, err)
+		}
+	}
+
 	return nil
 }
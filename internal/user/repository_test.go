@@ -19,3 +19,896 @@ package user
 // Refer to integration/user_repository_integration_test.go
 //
 // TODO: Tests must be added to mock the behaviour
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	xerrors "user-service.mykapital.io/internal/errors"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+// newFakeModel creates a Model backed by a fake table holding users.
+func newFakeModel(t *testing.T, users ...User) (Model, *testsupport.FakeDynamoDB) {
+	t.Helper()
+
+	fake := testsupport.NewFakeDynamoDB()
+	for _, usr := range users {
+		item, err := attributevalue.MarshalMap(usr)
+		if err != nil {
+			t.Fatalf("failed to marshal user %s: %v", usr.ID, err)
+		}
+		fake.Put(item)
+	}
+
+	return Model{DynamoDbClient: fake, TableName: "User"}, fake
+}
+
+func TestBatchGet(t *testing.T) {
+	var users []User
+	var ids []string
+	for i := 0; i < 150; i++ {
+		id := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+		ids = append(ids, id)
+		if i%2 == 0 {
+			users = append(users, User{ID: id})
+		}
+	}
+	model, fake := newFakeModel(t, users...)
+
+	found, err := model.BatchGet(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("failed to get batch: %v", err)
+	}
+
+	if len(found) != len(users) {
+		t.Errorf("unexpected number of users: got %d, want %d", len(found), len(users))
+	}
+	for _, usr := range users {
+		if _, ok := found[usr.ID]; !ok {
+			t.Errorf("user %s was not found", usr.ID)
+		}
+	}
+	if calls := fake.CallCount("BatchGetItem"); calls != 2 {
+		t.Errorf("unexpected number of calls: got %d, want 2", calls)
+	}
+}
+
+func TestBatchGetUnprocessed(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	model, fake := newFakeModel(t, User{ID: "1"}, User{ID: "2"}, User{ID: "3"})
+	fake.LeaveUnprocessed("2", "4")
+
+	found, err := model.BatchGet(context.Background(), []string{"1", "2", "3", "4"})
+
+	var batchErr *xerrors.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("unexpected error: got %v, want a BatchError", err)
+	}
+	if len(batchErr.IDs) != 2 || batchErr.IDs[0] != "2" || batchErr.IDs[1] != "4" {
+		t.Errorf("unexpected unfetched ids: got %v, want [2 4]", batchErr.IDs)
+	}
+	if len(found) != 2 || found["1"] == nil || found["3"] == nil {
+		t.Errorf("unexpected users: got %v, want 1 and 3", found)
+	}
+	if calls := fake.CallCount("BatchGetItem"); calls != maxAttempts {
+		t.Errorf("unexpected number of calls: got %d, want %d", calls, maxAttempts)
+	}
+}
+
+func TestGetBatch(t *testing.T) {
+	// The ids are requested in reverse, so that the order of the users
+	// differs from the order of the table, and 101 of them cross the chunk
+	// boundary.
+	var users []User
+	var ids, want []string
+	for i := MaxBatchGetKeys; i >= 0; i-- {
+		id := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+		ids = append(ids, id)
+		if i%3 != 0 {
+			users = append(users, User{ID: id})
+			want = append(want, id)
+		}
+	}
+	model, fake := newFakeModel(t, users...)
+
+	found, err := model.GetBatch(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("failed to get batch: %v", err)
+	}
+
+	var got []string
+	for _, usr := range found {
+		got = append(got, usr.ID)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected users: got %v, want %v", got, want)
+	}
+	if calls := fake.CallCount("BatchGetItem"); calls != 2 {
+		t.Errorf("unexpected number of calls: got %d, want 2", calls)
+	}
+}
+
+func TestInsertBatch(t *testing.T) {
+	tests := map[string]struct {
+		users         int
+		expectedCalls int
+	}{
+		`single chunk`: {users: MaxBatchWriteItems, expectedCalls: 1},
+		`two chunks`:   {users: MaxBatchWriteItems + 1, expectedCalls: 2},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			model, fake := newFakeModel(t)
+
+			var users []*User
+			for i := 0; i < tt.users; i++ {
+				users = append(users, &User{ID: fmt.Sprintf("00000000-0000-0000-0000-%012d", i), Version: 1})
+			}
+
+			if err := model.InsertBatch(context.Background(), users); err != nil {
+				t.Fatalf("failed to insert batch: %v", err)
+			}
+
+			if len(fake.Items) != tt.users {
+				t.Errorf("unexpected number of items: got %d, want %d", len(fake.Items), tt.users)
+			}
+			if calls := fake.CallCount("BatchWriteItem"); calls != tt.expectedCalls {
+				t.Errorf("unexpected number of calls: got %d, want %d", calls, tt.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestInsertBatchRegisteredEmail(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", Email: "john.doe@example.com", Activated: true, Version: 1})
+	model.IndexName = "email"
+
+	err := model.InsertBatch(context.Background(), []*User{
+		{ID: "2", Email: "jane.doe@example.com", Version: 1},
+		{ID: "3", Email: "john.doe@example.com", Version: 1},
+	})
+
+	var duplicateErr *DuplicateEmailsError
+	if !errors.As(err, &duplicateErr) || !errors.Is(err, xerrors.ErrDuplicateEmail) {
+		t.Fatalf("unexpected error: got %v, want a *DuplicateEmailsError", err)
+	}
+	if len(duplicateErr.IDs) != 1 || duplicateErr.IDs[0] != "3" {
+		t.Errorf("unexpected duplicate emails: got %v, want [3]", duplicateErr.IDs)
+	}
+	if len(fake.Items) != 1 {
+		t.Errorf("expected no user to be inserted, got %d items", len(fake.Items))
+	}
+}
+
+func TestInsertBatchUnprocessed(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	model, fake := newFakeModel(t)
+	fake.LeaveUnprocessed("2")
+
+	err := model.InsertBatch(context.Background(), []*User{{ID: "1"}, {ID: "2"}, {ID: "3"}})
+
+	var batchErr *xerrors.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("unexpected error: got %v, want a BatchError", err)
+	}
+	if len(batchErr.IDs) != 1 || batchErr.IDs[0] != "2" {
+		t.Errorf("unexpected unwritten ids: got %v, want [2]", batchErr.IDs)
+	}
+	if _, ok := fake.Items["2"]; ok || len(fake.Items) != 2 {
+		t.Errorf("unexpected items: got %d items, want 1 and 3", len(fake.Items))
+	}
+	if calls := fake.CallCount("BatchWriteItem"); calls != maxAttempts {
+		t.Errorf("unexpected number of calls: got %d, want %d", calls, maxAttempts)
+	}
+}
+
+func TestCreateTableInUse(t *testing.T) {
+	model, fake := newFakeModel(t)
+	fake.FailWith("CreateTable", &types.ResourceInUseException{Message: aws.String("Table already exists: User")})
+
+	_, err := model.CreateTable(context.Background())
+	if !errors.Is(err, xerrors.ErrTableExists) {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrTableExists)
+	}
+
+	if err := model.EnsureTable(context.Background()); err != nil {
+		t.Errorf("failed to ensure the existing table: %v", err)
+	}
+	// The existing table is waited for, as it may still be being created.
+	if calls := fake.CallCount("DescribeTable"); calls != 1 {
+		t.Errorf("unexpected DescribeTable calls: got %d, want 1", calls)
+	}
+}
+
+func TestEnsureTable(t *testing.T) {
+	model, fake := newFakeModel(t)
+
+	if err := model.EnsureTable(context.Background()); err != nil {
+		t.Fatalf("failed to ensure the table: %v", err)
+	}
+	if calls := fake.CallCount("CreateTable"); calls != 1 {
+		t.Errorf("unexpected CreateTable calls: got %d, want 1", calls)
+	}
+
+	fake.FailWith("CreateTable", errors.New("access denied"))
+	if err := model.EnsureTable(context.Background()); err == nil || errors.Is(err, xerrors.ErrTableExists) {
+		t.Errorf("unexpected error: got %v", err)
+	}
+}
+
+func TestUpdateVersionGrace(t *testing.T) {
+	tests := map[string]struct {
+		grace    bool
+		expected error
+	}{
+		`with grace`:    {grace: true, expected: nil},
+		`without grace`: {grace: false, expected: xerrors.ErrEditConflict},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			model, fake := newFakeModel(t, User{ID: "1", FirstName: "John"})
+			delete(fake.Items["1"], "version")
+			model.VersionGrace = tt.grace
+
+			usr, err := model.Get(context.Background(), "1")
+			if err != nil {
+				t.Fatalf("failed to get user: %v", err)
+			}
+
+			_, err = model.Update(context.Background(), usr, map[string]interface{}{"firstName": "Jack"})
+			if err != tt.expected {
+				t.Fatalf("unexpected error: got %v, want %v", err, tt.expected)
+			}
+			if err != nil {
+				return
+			}
+
+			// The version is initialized, so the stale version now conflicts.
+			_, err = model.Update(context.Background(), usr, map[string]interface{}{"firstName": "Jim"})
+			if err != xerrors.ErrEditConflict {
+				t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrEditConflict)
+			}
+
+			usr.Version = 1
+			_, err = model.Update(context.Background(), usr, map[string]interface{}{"firstName": "Jim"})
+			if err != nil {
+				t.Errorf("failed to update initialized user: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateDeletedUser(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FirstName: "John"})
+	model.VersionGrace = true
+
+	usr, err := model.Get(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	delete(fake.Items, "1")
+
+	_, err = model.Update(context.Background(), usr, map[string]interface{}{"firstName": "Jack"})
+	if err != xerrors.ErrEditConflict {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrEditConflict)
+	}
+	if _, found := fake.Items["1"]; found {
+		t.Errorf("the deleted user was re-created: %v", fake.Items["1"])
+	}
+
+	if err = model.Activate(context.Background(), usr); err == nil {
+		t.Errorf("activated the deleted user")
+	}
+	if _, found := fake.Items["1"]; found {
+		t.Errorf("the deleted user was re-created: %v", fake.Items["1"])
+	}
+}
+
+func TestUpdateConditions(t *testing.T) {
+	unactivated := expression.Name("activated").Equal(expression.Value(false))
+
+	tests := map[string]struct {
+		stored   User
+		version  int64
+		expected error
+	}{
+		`condition met`:                   {stored: User{ID: "1", Version: 1}, version: 1, expected: nil},
+		`condition failed`:                {stored: User{ID: "1", Version: 1, Activated: true}, version: 1, expected: xerrors.ErrConditionFailed},
+		`condition met, stale version`:    {stored: User{ID: "1", Version: 2}, version: 1, expected: xerrors.ErrEditConflict},
+		`condition failed, stale version`: {stored: User{ID: "1", Version: 2, Activated: true}, version: 1, expected: xerrors.ErrEditConflict},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			model, _ := newFakeModel(t, tt.stored)
+
+			_, err := model.Update(context.Background(), &User{ID: "1", Version: tt.version}, map[string]interface{}{"firstName": "Jack"}, unactivated)
+			if err != tt.expected {
+				t.Errorf("unexpected error: got %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreate(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+
+	tests := map[string]struct {
+		existing []User
+		expected error
+	}{
+		`new email`: {
+			existing: []User{{ID: "1", Email: "jane.doe@example.com", CreatedAt: today}},
+			expected: nil,
+		},
+		`activated user`: {
+			existing: []User{{ID: "1", Email: "john.doe@example.com", Activated: true, CreatedAt: today}},
+			expected: xerrors.ErrDuplicateEmail,
+		},
+		`pending verification`: {
+			existing: []User{{ID: "1", Email: "john.doe@example.com", CreatedAt: today}},
+			expected: xerrors.ErrPendingVerification,
+		},
+		`expired verification`: {
+			existing: []User{{ID: "1", Email: "john.doe@example.com", CreatedAt: "2023-01-01"}},
+			expected: xerrors.ErrDuplicateEmail,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			model, fake := newFakeModel(t, tt.existing...)
+			model.IndexName = "email"
+			model.PendingWindow = 72 * time.Hour
+
+			err := model.Create(context.Background(), &User{ID: "2", Email: "john.doe@example.com", CreatedAt: today})
+			if err != tt.expected {
+				t.Fatalf("unexpected error: got %v, want %v", err, tt.expected)
+			}
+
+			_, inserted := fake.Items["2"]
+			if inserted != (tt.expected == nil) {
+				t.Errorf("unexpected insertion: got %v", inserted)
+			}
+		})
+	}
+}
+
+func TestListFuncCorruptItems(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1"}, User{ID: "3"})
+	fake.Put(map[string]types.AttributeValue{
+		"userID":  &types.AttributeValueMemberS{Value: "2"},
+		"version": &types.AttributeValueMemberS{Value: "not a number"},
+	})
+
+	list := func() ([]string, error) {
+		var ids []string
+		_, err := model.ListFunc(context.Background(), expression.ConditionBuilder{}, 10, nil, func(usr *User) error {
+			ids = append(ids, usr.ID)
+			return nil
+		})
+		return ids, err
+	}
+
+	if _, err := list(); err == nil {
+		t.Fatal("expected the corrupt item to fail the list")
+	}
+
+	model.SkipCorruptItems = true
+	ids, err := list()
+	var corrupt *CorruptItemsError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("unexpected error: got %v, want a CorruptItemsError", err)
+	}
+	if len(corrupt.Keys) != 1 || corrupt.Keys[0] != "2" {
+		t.Errorf("unexpected corrupt keys: got %v, want [2]", corrupt.Keys)
+	}
+	if len(ids) != 2 {
+		t.Errorf("unexpected users: got %v, want 1 and 3", ids)
+	}
+}
+
+func TestListFuncFilter(t *testing.T) {
+	model, _ := newFakeModel(t,
+		User{ID: "1", CountryCodeAlpha2: "CA"},
+		User{ID: "2", CountryCodeAlpha2: "US"},
+		User{ID: "3", CountryCodeAlpha2: "CA"},
+	)
+	canadians := expression.Name("countryCodeAlpha2").Equal(expression.Value("CA"))
+
+	var ids []string
+	next, err := model.ListFunc(context.Background(), canadians, 10, nil, func(usr *User) error {
+		ids = append(ids, usr.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != nil {
+		t.Errorf("unexpected next key: %v", next)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "3"}) {
+		t.Errorf("unexpected users: got %v, want [1 3]", ids)
+	}
+}
+
+func TestUpdateAttributes(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FirstName: "John", LastName: "Doe", Occupation: "11", Version: 1})
+
+	_, err := model.Update(context.Background(), &User{ID: "1", Version: 1}, map[string]interface{}{
+		"firstName":  "Jack",
+		"lastName":   "Smith",
+		"occupation": "21",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var usr User
+	if err = attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+		t.Fatal(err)
+	}
+	if usr.FirstName != "Jack" || usr.LastName != "Smith" || usr.Occupation != "21" || usr.Version != 2 {
+		t.Errorf("unexpected user: got %q %q with occupation %q at version %d", usr.FirstName, usr.LastName, usr.Occupation, usr.Version)
+	}
+}
+
+func TestUpdateReservedAttributes(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FirstName: "John", CreatedAt: "2023-01-01", Version: 1})
+
+	_, err := model.Update(context.Background(), &User{ID: "1", Version: 1}, map[string]interface{}{
+		"firstName": "Jack",
+		"createdAt": "1999-01-01",
+		"version":   int64(42),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var usr User
+	if err = attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+		t.Fatal(err)
+	}
+	if usr.FirstName != "Jack" || usr.CreatedAt != "2023-01-01" || usr.Version != 2 {
+		t.Errorf("unexpected user: got %q created at %q at version %d", usr.FirstName, usr.CreatedAt, usr.Version)
+	}
+}
+
+func TestDistinctValues(t *testing.T) {
+	model, _ := newFakeModel(t,
+		User{ID: "1", CountryCodeAlpha2: "CA", ProvinceCode: "ON"},
+		User{ID: "2", CountryCodeAlpha2: "US", ProvinceCode: "TX"},
+		User{ID: "3", CountryCodeAlpha2: "CA", ProvinceCode: "QC"},
+		User{ID: "4"},
+		User{ID: "5", CountryCodeAlpha2: "MX", DeletedAt: "2023-03-01"},
+	)
+
+	countries, err := model.DistinctValues(context.Background(), "countryCodeAlpha2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(countries, []string{"CA", "US"}) {
+		t.Errorf("unexpected countries: got %v, want [CA US]", countries)
+	}
+
+	if _, err = model.DistinctValues(context.Background(), "email"); !errors.Is(err, ErrNotDistinct) {
+		t.Errorf("unexpected error: got %v, want %v", err, ErrNotDistinct)
+	}
+}
+
+func TestReplaceSlice(t *testing.T) {
+	model, fake := newFakeModel(t, User{
+		ID:         "1",
+		Milestones: []Milestone{{Date: "2020-01-01", Title: "Emergency fund", Type: "Savings"}},
+		Version:    1,
+	})
+
+	milestones := []Milestone{
+		{Date: "2021-06-01", Title: "Paid off car", Type: "Debt"},
+		{Date: "2022-03-01", Title: "First investment", Type: "Investment"},
+	}
+	if err := model.ReplaceSlice(context.Background(), "1", "milestones", milestones); err != nil {
+		t.Fatal(err)
+	}
+
+	var usr User
+	if err := attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(usr.Milestones, milestones) || usr.Version != 2 {
+		t.Errorf("unexpected user: got milestones %v at version %d", usr.Milestones, usr.Version)
+	}
+
+	if err := model.ReplaceSlice(context.Background(), "1", "milestones", []Milestone{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Items["1"]["milestones"]; ok {
+		t.Error("expected the empty milestones to be removed")
+	}
+
+	if err := model.ReplaceSlice(context.Background(), "1", "firstName", []string{"John"}); !errors.Is(err, ErrNotSlice) {
+		t.Errorf("unexpected error: got %v, want %v", err, ErrNotSlice)
+	}
+	if err := model.ReplaceSlice(context.Background(), "1", "milestones", []Goal{}); err == nil {
+		t.Error("expected an error for a value of the wrong type")
+	}
+	if err := model.ReplaceSlice(context.Background(), "2", "milestones", milestones); err != xerrors.ErrRecordNotFound {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrRecordNotFound)
+	}
+}
+
+func TestIncrement(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FamilyMemberNumber: 2, Version: 1})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(delta int64) {
+			defer wg.Done()
+
+			if _, err := model.Increment(context.Background(), "1", "familyMemberNumber", delta); err != nil {
+				t.Error(err)
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	value, err := model.Increment(context.Background(), "1", "familyMemberNumber", -10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2, plus 1 to 20, minus 10.
+	if value != 202 {
+		t.Errorf("unexpected value: got %d, want 202", value)
+	}
+
+	var usr User
+	if err = attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+		t.Fatal(err)
+	}
+	if usr.FamilyMemberNumber != 202 || usr.Version != 22 {
+		t.Errorf("unexpected user: got %d members at version %d", usr.FamilyMemberNumber, usr.Version)
+	}
+
+	if _, err = model.Increment(context.Background(), "1", "firstName", 1); !errors.Is(err, ErrNotNumeric) {
+		t.Errorf("unexpected error: got %v, want %v", err, ErrNotNumeric)
+	}
+	if _, err = model.Increment(context.Background(), "2", "income", 1); err != xerrors.ErrRecordNotFound {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrRecordNotFound)
+	}
+}
+
+func TestInsertDuplicate(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FirstName: "John", Version: 1})
+
+	if err := model.Insert(context.Background(), &User{ID: "1", FirstName: "Jack", Version: 1}); err != xerrors.ErrDuplicateUser {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrDuplicateUser)
+	}
+
+	var usr User
+	if err := attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+		t.Fatal(err)
+	}
+	if usr.FirstName != "John" {
+		t.Errorf("unexpected overwritten user: %+v", usr)
+	}
+
+	if err := model.InsertOrReplace(context.Background(), &User{ID: "1", FirstName: "Jack", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+		t.Fatal(err)
+	}
+	if usr.FirstName != "Jack" {
+		t.Errorf("unexpected user not replaced: %+v", usr)
+	}
+}
+
+func TestGetMissing(t *testing.T) {
+	model, _ := newFakeModel(t, User{ID: "1", FirstName: "John"})
+
+	if _, err := model.Get(context.Background(), "2"); err != xerrors.ErrRecordNotFound {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrRecordNotFound)
+	}
+
+	model.Batcher = &GetBatcher{Window: time.Millisecond, MaxSize: 10}
+	if _, err := model.Get(context.Background(), "2"); err != xerrors.ErrRecordNotFound {
+		t.Errorf("unexpected batched error: got %v, want %v", err, xerrors.ErrRecordNotFound)
+	}
+}
+
+func TestGetByEmail(t *testing.T) {
+	model, _ := newFakeModel(t,
+		User{ID: "1", Email: "john.doe@example.com", FirstName: "John"},
+		User{ID: "2", Email: "jane.doe@example.com", FirstName: "Jane"},
+		User{ID: "3", Email: "jane.doe@example.com", FirstName: "Janet"},
+	)
+	model.IndexName = "email"
+
+	usr, err := model.GetByEmail(context.Background(), " John.Doe@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.ID != "1" || usr.FirstName != "John" {
+		t.Errorf("unexpected user: %+v", usr)
+	}
+
+	if _, err = model.GetByEmail(context.Background(), "nobody@example.com"); err != xerrors.ErrRecordNotFound {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrRecordNotFound)
+	}
+	if _, err = model.GetByEmail(context.Background(), "jane.doe@example.com"); err != ErrAmbiguousEmail {
+		t.Errorf("unexpected error: got %v, want %v", err, ErrAmbiguousEmail)
+	}
+}
+
+func TestGetDeleted(t *testing.T) {
+	model, _ := newFakeModel(t, User{ID: "1", FirstName: "John", DeletedAt: "2023-03-01"})
+
+	if _, err := model.Get(context.Background(), "1"); err != xerrors.ErrRecordNotFound {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrRecordNotFound)
+	}
+
+	model.IncludeDeleted = true
+	usr, err := model.Get(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usr.ID != "1" || usr.DeletedAt != "2023-03-01" {
+		t.Errorf("unexpected included user: %+v", usr)
+	}
+}
+
+func TestScansDeleted(t *testing.T) {
+	model, _ := newFakeModel(t,
+		User{ID: "1", CountryCodeAlpha2: "CA"},
+		User{ID: "2", CountryCodeAlpha2: "CA", DeletedAt: "2023-03-01"},
+		User{ID: "3", CountryCodeAlpha2: "US"},
+	)
+	canadians := expression.Name("countryCodeAlpha2").Equal(expression.Value("CA"))
+
+	scans := map[string]func(m Model) ([]string, error){
+		`ListFunc`: func(m Model) ([]string, error) {
+			var ids []string
+			_, err := m.ListFunc(context.Background(), canadians, 10, nil, func(usr *User) error {
+				ids = append(ids, usr.ID)
+				return nil
+			})
+			return ids, err
+		},
+		`ForEach`: func(m Model) ([]string, error) {
+			var ids []string
+			err := m.ForEach(context.Background(), canadians, func(usr *User) error {
+				ids = append(ids, usr.ID)
+				return nil
+			})
+			return ids, err
+		},
+		`BatchGet`: func(m Model) ([]string, error) {
+			users, err := m.BatchGet(context.Background(), []string{"1", "2"})
+			var ids []string
+			for id := range users {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			return ids, err
+		},
+	}
+
+	for name, scan := range scans {
+		t.Run(name, func(t *testing.T) {
+			ids, err := scan(model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, []string{"1"}) {
+				t.Errorf("unexpected users: got %v, want [1]", ids)
+			}
+
+			included := model
+			included.IncludeDeleted = true
+			ids, err = scan(included)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(ids, []string{"1", "2"}) {
+				t.Errorf("unexpected included users: got %v, want [1 2]", ids)
+			}
+		})
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FirstName: "John", Version: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := model.Get(ctx, "1"); err == nil {
+		t.Error("expected the get of a canceled context to fail")
+	}
+	if _, err := model.Update(ctx, &User{ID: "1", Version: 1}, map[string]interface{}{"firstName": "Jack"}); err == nil {
+		t.Error("expected the update of a canceled context to fail")
+	}
+
+	var stored User
+	if err := attributevalue.UnmarshalMap(fake.Items["1"], &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.FirstName != "John" {
+		t.Errorf("unexpected first name after a canceled update: got %s, want John", stored.FirstName)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	model, fake := newFakeModel(t,
+		User{ID: "1", FirstName: "John", Version: 3},
+		User{ID: "2", FirstName: "Jane", Version: 2, DeletedAt: "2023-03-01"},
+	)
+	fake.Put(map[string]types.AttributeValue{"userID": &types.AttributeValueMemberS{Value: "3"}})
+
+	tests := map[string]struct {
+		id       string
+		expected int64
+		err      error
+	}{
+		`stored user`:  {id: "1", expected: 3},
+		`legacy user`:  {id: "3", expected: 0},
+		`deleted user`: {id: "2", err: xerrors.ErrRecordNotFound},
+		`missing user`: {id: "4", err: xerrors.ErrRecordNotFound},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			version, err := model.GetVersion(context.Background(), tt.id)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: got %v, want %v", err, tt.err)
+			}
+			if version != tt.expected {
+				t.Errorf("unexpected version: got %d, want %d", version, tt.expected)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	model, _ := newFakeModel(t, User{ID: "1"}, User{ID: "2"}, User{ID: "3"})
+
+	var ids []string
+	var startKey map[string]types.AttributeValue
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("the list doesn't end")
+		}
+
+		users, nextKey, err := model.List(context.Background(), 2, startKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, usr := range users {
+			ids = append(ids, usr.ID)
+		}
+		if nextKey == nil {
+			break
+		}
+		startKey = nextKey
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+		t.Errorf("unexpected users: got %v, want [1 2 3]", ids)
+	}
+
+	empty, _ := newFakeModel(t)
+	users, nextKey, err := empty.List(context.Background(), 2, nil)
+	if err != nil || users == nil || len(users) != 0 || nextKey != nil {
+		t.Errorf("unexpected empty list: %v, %v, %v", users, nextKey, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err = model.List(ctx, 2, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error for a canceled list: got %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	model, _ := newFakeModel(t,
+		User{ID: "1", CountryCodeAlpha2: "CA"},
+		User{ID: "2", CountryCodeAlpha2: "US"},
+		User{ID: "3", CountryCodeAlpha2: "CA"},
+		User{ID: "4", CountryCodeAlpha2: "CA"},
+	)
+	canadians := expression.Name("countryCodeAlpha2").Equal(expression.Value("CA"))
+
+	var ids []string
+	err := model.ForEach(context.Background(), canadians, func(usr *User) error {
+		ids = append(ids, usr.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "3", "4"}) {
+		t.Errorf("unexpected users: got %v, want [1 3 4]", ids)
+	}
+
+	calls := 0
+	err = model.ForEach(context.Background(), expression.ConditionBuilder{}, func(*User) error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 4 {
+		t.Errorf("unexpected unfiltered scan: %d calls, %v", calls, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls = 0
+	err = model.ForEach(ctx, canadians, func(*User) error {
+		calls++
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error for a canceled scan: got %v, want %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("unexpected calls after cancel: got %d, want 1", calls)
+	}
+
+	stop := errors.New("stop")
+	calls = 0
+	err = model.ForEach(context.Background(), canadians, func(*User) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("unexpected stop: %d calls, %v", calls, err)
+	}
+}
+
+func TestAppendGoals(t *testing.T) {
+	model, _ := newFakeModel(t,
+		User{ID: "1", Goals: []Goal{{Title: "Car"}}, Version: 1},
+		User{ID: "2", Version: 1},
+	)
+
+	for id, expected := range map[string][]string{"1": {"Car", "House"}, "2": {"House"}} {
+		err := model.AppendGoals(context.Background(), &User{ID: id, Version: 1}, []Goal{{Title: "House"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		usr, err := model.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, goal := range usr.Goals {
+			titles = append(titles, goal.Title)
+		}
+		if !reflect.DeepEqual(titles, expected) || usr.Version != 2 {
+			t.Errorf("unexpected goals of user %s: got %v at version %d, want %v", id, titles, usr.Version, expected)
+		}
+	}
+
+	err := model.AppendGoals(context.Background(), &User{ID: "1", Version: 1}, []Goal{{Title: "Boat"}})
+	if !errors.Is(err, xerrors.ErrEditConflict) {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrEditConflict)
+	}
+}
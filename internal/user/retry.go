@@ -0,0 +1,115 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"golang.org/x/time/rate"
+)
+
+// maxAttempts is the maximum number of attempts of a throttled call.
+const maxAttempts = 4
+
+// retryBaseDelay is the delay before the first retry. It doubles on
+// every following retry.
+var retryBaseDelay = 50 * time.Millisecond
+
+// RetryBudget is a token bucket shared by every retry of throttled calls.
+//
+// Under sustained throttling, retries would amplify the load on DynamoDB.
+// Every retry spends a token, so once the budget is exhausted the calls
+// fail fast with the throttling error instead of retrying.
+type RetryBudget struct {
+	limiter *rate.Limiter
+}
+
+// NewRetryBudget creates a RetryBudget refilled with rps tokens per second,
+// holding up to burst tokens.
+func NewRetryBudget(rps float64, burst int) *RetryBudget {
+	return &RetryBudget{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+}
+
+// allow spends a token, and reports whether a retry is allowed.
+//
+// A nil RetryBudget allows every retry.
+func (b *RetryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+	return b.limiter.Allow()
+}
+
+// NewRetryer returns the retryer of the DynamoDB client of a Model. It is
+// the standard retryer of the SDK, except that it doesn't retry the
+// throttling errors: those are retried by the Model within its
+// RetryBudget, and retried by both, a throttled call would be attempted
+// up to maxAttempts times the attempts of the SDK.
+func NewRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.Retryables = append([]retry.IsErrorRetryable{
+			retry.IsErrorRetryableFunc(func(err error) aws.Ternary {
+				if isThrottled(err) {
+					return aws.FalseTernary
+				}
+				return aws.UnknownTernary
+			}),
+		}, o.Retryables...)
+	})
+}
+
+// retry calls fn until it succeeds, fails with an error which is not a
+// throttling error, or runs out of attempts, budget or time.
+func (m Model) retry(ctx context.Context, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err != nil && isThrottled(err) && m.OnThrottle != nil {
+			m.OnThrottle()
+		}
+		if err == nil || !isThrottled(err) || attempt == maxAttempts || !m.RetryBudget.allow() {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isThrottled reports whether err is a DynamoDB throttling error.
+func isThrottled(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.ErrorCode() {
+	case "ProvisionedThroughputExceededException", "RequestLimitExceeded", "ThrottlingException":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+func TestRetryBudgetUnderSustainedThrottling(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	const requests, burst = 20, 5
+
+	fake := testsupport.NewFakeDynamoDB()
+	fake.FailWith("GetItem", &types.ProvisionedThroughputExceededException{Message: aws.String("throttled")})
+	model := Model{
+		DynamoDbClient: fake,
+		TableName:      "User",
+		RetryBudget:    NewRetryBudget(0.001, burst),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := model.Get(context.Background(), "77d1cbe1-f734-4b94-b69e-e9d55b81ed19"); err == nil {
+				t.Errorf("expected the throttling error")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := fake.CallCount("GetItem"); calls != requests+burst {
+		t.Errorf("unexpected number of calls: got %d, want %d", calls, requests+burst)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	tests := map[string]struct {
+		err           error
+		budget        *RetryBudget
+		expectedCalls int
+	}{
+		`throttled without budget`: {
+			err:           &types.ProvisionedThroughputExceededException{},
+			budget:        nil,
+			expectedCalls: maxAttempts,
+		},
+		`throttled with exhausted budget`: {
+			err:           &types.RequestLimitExceeded{},
+			budget:        NewRetryBudget(0, 0),
+			expectedCalls: 1,
+		},
+		`not throttled`: {
+			err:           errors.New("validation failed"),
+			budget:        nil,
+			expectedCalls: 1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := testsupport.NewFakeDynamoDB()
+			fake.FailWith("DeleteItem", tt.err)
+			model := Model{DynamoDbClient: fake, TableName: "User", RetryBudget: tt.budget}
+
+			if err := model.Delete(context.Background(), &User{ID: "77d1cbe1-f734-4b94-b69e-e9d55b81ed19"}); err == nil {
+				t.Fatalf("expected an error")
+			}
+
+			if calls := fake.CallCount("DeleteItem"); calls != tt.expectedCalls {
+				t.Errorf("unexpected number of calls: got %d, want %d", calls, tt.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestNewRetryer(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		`throttled`:           {err: &types.ProvisionedThroughputExceededException{}, expected: false},
+		`request limit`:       {err: &types.RequestLimitExceeded{}, expected: false},
+		`request timeout`:     {err: &smithy.GenericAPIError{Code: "RequestTimeoutException"}, expected: true},
+		`conditional failure`: {err: &types.ConditionalCheckFailedException{}, expected: false},
+	}
+
+	retryer := NewRetryer()
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := retryer.IsErrorRetryable(tt.err); got != tt.expected {
+				t.Errorf("unexpected retryable: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
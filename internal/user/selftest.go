@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	xerrors "user-service.mykapital.io/internal/errors"
+)
+
+// SelfTestIDPrefix prefixes the id of the throwaway user of SelfTest.
+const SelfTestIDPrefix = "self-test-"
+
+// Steps of SelfTest, as reported.
+const (
+	SelfTestDescribe = "describe table"
+	SelfTestPut      = "put item"
+	SelfTestGet      = "get item"
+	SelfTestDelete   = "delete item"
+)
+
+// SelfTest runs a smoke test against the table of the model: it describes
+// the table, then puts a throwaway user, gets it back and deletes it.
+//
+// Every step is passed to report, along with its error. The throwaway
+// user is deleted even when a later step fails. The error of the first
+// failed step is returned.
+func (m Model) SelfTest(ctx context.Context, report func(step string, err error)) (err error) {
+	step := func(name string, fn func() error) error {
+		err := fn()
+		report(name, err)
+		if err != nil {
+			return fmt.Errorf("self-test failed to %s: %v", name, err)
+		}
+		return nil
+	}
+
+	err = step(SelfTestDescribe, func() error {
+		_, err := m.TableExists(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 8)
+	if _, err = rand.Read(suffix); err != nil {
+		return err
+	}
+	id := SelfTestIDPrefix + hex.EncodeToString(suffix)
+	sentinel := &User{ID: id, Email: id + "@self-test.invalid", FirstName: "Self-test"}
+
+	err = step(SelfTestPut, func() error { return m.Insert(ctx, sentinel) })
+	// The put may have been applied even when it failed, such as on a
+	// timeout, so the user is deleted in any case.
+	defer func() {
+		deleteErr := step(SelfTestDelete, func() error { return m.Delete(ctx, &User{ID: id}) })
+		if err == nil {
+			err = deleteErr
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	return step(SelfTestGet, func() error {
+		_, err := m.getConsistent(ctx, id)
+		if errors.Is(err, xerrors.ErrRecordNotFound) {
+			return errors.New("the item put isn't found")
+		}
+		return err
+	})
+}
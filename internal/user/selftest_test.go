@@ -0,0 +1,96 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+// inconsistentGets counts the GetItem calls which aren't strongly
+// consistent.
+type inconsistentGets struct {
+	*testsupport.FakeDynamoDB
+	count int
+}
+
+func (i *inconsistentGets) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if !aws.ToBool(params.ConsistentRead) {
+		i.count++
+	}
+	return i.FakeDynamoDB.GetItem(ctx, params, optFns...)
+}
+
+func TestSelfTest(t *testing.T) {
+	tests := map[string]struct {
+		failing  string
+		expected []string
+	}{
+		`every step passes`: {
+			expected: []string{SelfTestDescribe, SelfTestPut, SelfTestGet, SelfTestDelete},
+		},
+		`the get fails`: {
+			failing:  "GetItem",
+			expected: []string{SelfTestDescribe, SelfTestPut, SelfTestGet + " failed", SelfTestDelete},
+		},
+		`the table is missing`: {
+			failing:  "DescribeTable",
+			expected: []string{SelfTestDescribe + " failed"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			model, fake := newFakeModel(t)
+			if tt.failing != "" {
+				fake.FailWith(tt.failing, errors.New("connection reset"))
+			}
+			gets := &inconsistentGets{FakeDynamoDB: fake}
+			model.DynamoDbClient = gets
+
+			var steps []string
+			err := model.SelfTest(context.Background(), func(step string, err error) {
+				if err != nil {
+					step += " failed"
+				}
+				steps = append(steps, step)
+			})
+
+			if (err != nil) != (tt.failing != "") {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(steps, tt.expected) {
+				t.Errorf("unexpected steps: got %v, want %v", steps, tt.expected)
+			}
+			if gets.count != 0 {
+				t.Errorf("the get of the throwaway user isn't strongly consistent")
+			}
+			for key := range fake.Items {
+				if strings.HasPrefix(key, SelfTestIDPrefix) {
+					t.Errorf("the throwaway user %s wasn't deleted", key)
+				}
+			}
+		})
+	}
+}
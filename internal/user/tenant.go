@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"errors"
+	"regexp"
+)
+
+// ErrInvalidTenant is returned for a tenant unsafe to use in table names.
+var ErrInvalidTenant = errors.New("tenant must be 1 to 32 lowercase letters, digits or hyphens")
+
+// TenantRX matches the tenants allowed as a table name prefix.
+var TenantRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// TenantName prefixes a table or index name with the tenant, such as
+// "acme_User". The name is unchanged when there is no tenant.
+func TenantName(tenant, name string) (string, error) {
+	if tenant == "" {
+		return name, nil
+	}
+	if !TenantRX.MatchString(tenant) {
+		return "", ErrInvalidTenant
+	}
+
+	return tenant + "_" + name, nil
+}
+
+// ForTenant returns a copy of the model using the tables and the index of
+// the tenant.
+func (m Model) ForTenant(tenant string) (Model, error) {
+	tableName, err := TenantName(tenant, m.TableName)
+	if err != nil {
+		return Model{}, err
+	}
+	m.TableName = tableName
+
+	if m.EmailTableName != "" {
+		m.EmailTableName, err = TenantName(tenant, m.EmailTableName)
+		if err != nil {
+			return Model{}, err
+		}
+	}
+
+	if m.IndexName != "" {
+		m.IndexName, err = TenantName(tenant, m.IndexName)
+		if err != nil {
+			return Model{}, err
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import "testing"
+
+func TestForTenant(t *testing.T) {
+	model := Model{TableName: "User", IndexName: "email"}
+
+	tests := map[string]struct {
+		tenant        string
+		expectedTable string
+		expectedIndex string
+		expectedErr   error
+	}{
+		`no tenant`:           {tenant: "", expectedTable: "User", expectedIndex: "email"},
+		`tenant`:              {tenant: "acme", expectedTable: "acme_User", expectedIndex: "acme_email"},
+		`tenant with hyphen`:  {tenant: "acme-eu-1", expectedTable: "acme-eu-1_User", expectedIndex: "acme-eu-1_email"},
+		`uppercase tenant`:    {tenant: "Acme", expectedErr: ErrInvalidTenant},
+		`tenant with space`:   {tenant: "acme corp", expectedErr: ErrInvalidTenant},
+		`tenant with symbols`: {tenant: "acme;drop", expectedErr: ErrInvalidTenant},
+		`leading hyphen`:      {tenant: "-acme", expectedErr: ErrInvalidTenant},
+		`long tenant`:         {tenant: "abcdefghijklmnopqrstuvwxyz0123456", expectedErr: ErrInvalidTenant},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tenantModel, err := model.ForTenant(tt.tenant)
+			if err != tt.expectedErr {
+				t.Fatalf("unexpected error: got %v, want %v", err, tt.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if tenantModel.TableName != tt.expectedTable || tenantModel.IndexName != tt.expectedIndex {
+				t.Errorf("unexpected names: got %s/%s, want %s/%s",
+					tenantModel.TableName, tenantModel.IndexName, tt.expectedTable, tt.expectedIndex)
+			}
+		})
+	}
+
+	if model.TableName != "User" {
+		t.Errorf("model was modified: %s", model.TableName)
+	}
+}
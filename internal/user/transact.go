@@ -0,0 +1,380 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	xerrors "user-service.mykapital.io/internal/errors"
+)
+
+// MaxTransactOps is the maximum number of operations of a transaction.
+const MaxTransactOps = 100
+
+// MaxTransactBytes is the maximum total size of the items of a
+// transaction.
+const MaxTransactBytes = 4 << 20
+
+// ReasonConditionFailed is the cancellation code of an operation whose
+// condition failed.
+const ReasonConditionFailed = "ConditionalCheckFailed"
+
+// TransactOp is an operation of a transaction, created by PutOp, UpdateOp,
+// DeleteOp or CheckOp.
+//
+// The operation applies to the table of the Model, unless another table
+// is given with In.
+type TransactOp struct {
+	table     string
+	item      interface{}
+	key       map[string]types.AttributeValue
+	update    *expression.UpdateBuilder
+	delete    bool
+	condition *expression.ConditionBuilder
+}
+
+// PutOp puts the item, which is marshalled like a User.
+func PutOp(item interface{}) TransactOp {
+	return TransactOp{item: item}
+}
+
+// UpdateOp applies the update to the item with the key.
+func UpdateOp(key map[string]types.AttributeValue, update expression.UpdateBuilder) TransactOp {
+	return TransactOp{key: key, update: &update}
+}
+
+// DeleteOp deletes the item with the key.
+func DeleteOp(key map[string]types.AttributeValue) TransactOp {
+	return TransactOp{key: key, delete: true}
+}
+
+// CheckOp checks the condition on the item with the key, without
+// modifying it.
+func CheckOp(key map[string]types.AttributeValue, condition expression.ConditionBuilder) TransactOp {
+	return TransactOp{key: key, condition: &condition}
+}
+
+// In returns a copy of the operation applying to the table.
+func (op TransactOp) In(table string) TransactOp {
+	op.table = table
+	return op
+}
+
+// If returns a copy of the operation only applied when the condition is
+// met. Otherwise, the whole transaction is canceled.
+func (op TransactOp) If(condition expression.ConditionBuilder) TransactOp {
+	op.condition = &condition
+	return op
+}
+
+// build returns the operation as a TransactWriteItem, in the table unless
+// the operation has its own table.
+func (op TransactOp) build(table string) (types.TransactWriteItem, error) {
+	if op.table != "" {
+		table = op.table
+	}
+
+	builder := expression.NewBuilder()
+	if op.update != nil {
+		builder = builder.WithUpdate(*op.update)
+	}
+	if op.condition != nil {
+		builder = builder.WithCondition(*op.condition)
+	}
+
+	var expr expression.Expression
+	if op.update != nil || op.condition != nil {
+		var err error
+		expr, err = builder.Build()
+		if err != nil {
+			return types.TransactWriteItem{}, err
+		}
+	}
+
+	switch {
+	case op.item != nil:
+		item, err := attributevalue.MarshalMap(op.item)
+		if err != nil {
+			return types.TransactWriteItem{}, err
+		}
+		return types.TransactWriteItem{Put: &types.Put{
+			TableName:                 aws.String(table),
+			Item:                      item,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}}, nil
+	case op.update != nil:
+		return types.TransactWriteItem{Update: &types.Update{
+			TableName:                 aws.String(table),
+			Key:                       op.key,
+			UpdateExpression:          expr.Update(),
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}}, nil
+	case op.delete:
+		return types.TransactWriteItem{Delete: &types.Delete{
+			TableName:                 aws.String(table),
+			Key:                       op.key,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}}, nil
+	case op.condition != nil:
+		return types.TransactWriteItem{ConditionCheck: &types.ConditionCheck{
+			TableName:                 aws.String(table),
+			Key:                       op.key,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+		}}, nil
+	default:
+		return types.TransactWriteItem{}, errors.New("empty operation")
+	}
+}
+
+// TransactReason is why an operation canceled a transaction.
+type TransactReason struct {
+	// Index is the index of the operation in the transaction.
+	Index int
+	// Code is the cancellation code, such as ReasonConditionFailed.
+	Code string
+	// Message describes the cancellation.
+	Message string
+}
+
+// TransactionError reports the operations which canceled a transaction.
+//
+// It matches xerrors.ErrConditionFailed with errors.Is when the condition
+// of an operation failed.
+type TransactionError struct {
+	Reasons []TransactReason
+}
+
+func (e *TransactionError) Error() string {
+	reasons := make([]string, 0, len(e.Reasons))
+	for _, reason := range e.Reasons {
+		reasons = append(reasons, fmt.Sprintf("operation %d: %s", reason.Index, reason.Code))
+	}
+
+	return "transaction canceled (" + strings.Join(reasons, ", ") + ")"
+}
+
+func (e *TransactionError) Is(target error) bool {
+	return target == xerrors.ErrConditionFailed && len(e.ConditionFailed()) > 0
+}
+
+// ConditionFailed returns the indexes of the operations whose condition
+// failed.
+func (e *TransactionError) ConditionFailed() []int {
+	var indexes []int
+	for _, reason := range e.Reasons {
+		if reason.Code == ReasonConditionFailed {
+			indexes = append(indexes, reason.Index)
+		}
+	}
+
+	return indexes
+}
+
+// Transact applies the operations all together, or none of them.
+//
+// A *TransactionError is returned when DynamoDB cancels the transaction,
+// such as when the condition of an operation fails.
+func (m Model) Transact(ctx context.Context, ops ...TransactOp) error {
+	if len(ops) == 0 || len(ops) > MaxTransactOps {
+		return fmt.Errorf("couldn't run a transaction of %d operations, it must have 1 to %d", len(ops), MaxTransactOps)
+	}
+
+	items := make([]types.TransactWriteItem, 0, len(ops))
+	for i, op := range ops {
+		item, err := op.build(m.TableName)
+		if err != nil {
+			return fmt.Errorf("couldn't build operation %d of transaction. Here's why: %v", i, err)
+		}
+		items = append(items, item)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.retry(ctx, func() error {
+		_, err := m.DynamoDbClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items,
+		})
+		return err
+	})
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			return transactionError(canceled)
+		}
+		return fmt.Errorf("couldn't run transaction. Here's why: %v", err)
+	}
+
+	return nil
+}
+
+// transactionError lists the reasons of a canceled transaction, leaving
+// out the operations which didn't cancel it.
+func transactionError(canceled *types.TransactionCanceledException) *TransactionError {
+	e := &TransactionError{}
+	for i, reason := range canceled.CancellationReasons {
+		code := aws.ToString(reason.Code)
+		if code == "" || code == "None" {
+			continue
+		}
+		e.Reasons = append(e.Reasons, TransactReason{Index: i, Code: code, Message: aws.ToString(reason.Message)})
+	}
+
+	return e
+}
+
+// DuplicateUsersError reports the users of TransactInsert whose id is
+// already taken.
+//
+// It matches xerrors.ErrDuplicateUser with errors.Is.
+type DuplicateUsersError struct {
+	// IDs are the ids of the users which already exist.
+	IDs []string
+}
+
+func (e *DuplicateUsersError) Error() string {
+	return "duplicate users (" + strings.Join(e.IDs, ", ") + ")"
+}
+
+func (e *DuplicateUsersError) Is(target error) bool {
+	return target == xerrors.ErrDuplicateUser
+}
+
+// TransactInsert inserts the new users all together, or none of them.
+//
+// A transaction has at most MaxTransactOps users of MaxTransactBytes in
+// total, so larger batches are rejected before being sent. A
+// *DuplicateUsersError is returned when the id of some of the users is
+// already taken, and nothing is inserted.
+//
+// With an EmailTableName, the emails of the users are claimed in the same
+// transaction, which then holds at most half as many users, and
+// xerrors.ErrDuplicateEmail is returned when one of them was already
+// claimed.
+func (m Model) TransactInsert(ctx context.Context, users []*User) error {
+	maxUsers := MaxTransactOps
+	if m.EmailTableName != "" {
+		maxUsers /= 2
+	}
+	if len(users) == 0 || len(users) > maxUsers {
+		return fmt.Errorf("couldn't insert %d users in a transaction, it must have 1 to %d", len(users), maxUsers)
+	}
+
+	var size int
+	ops := make([]TransactOp, 0, len(users))
+	for _, user := range users {
+		m.transform(user)
+		item, err := attributevalue.MarshalMap(user)
+		if err != nil {
+			panic(err)
+		}
+		size += itemSize(item)
+		ops = append(ops, PutOp(user).If(expression.AttributeNotExists(expression.Name("userID"))))
+	}
+	if size > MaxTransactBytes {
+		return fmt.Errorf("couldn't insert users of %d bytes in a transaction, it must have at most %d", size, MaxTransactBytes)
+	}
+	if m.EmailTableName != "" {
+		for _, user := range users {
+			ops = append(ops, m.claimOp(user))
+		}
+	}
+
+	err := m.Transact(ctx, ops...)
+
+	var transactErr *TransactionError
+	if errors.As(err, &transactErr) {
+		if failed := transactErr.ConditionFailed(); len(failed) > 0 {
+			// The claims follow the users in the transaction.
+			e := &DuplicateUsersError{}
+			for _, i := range failed {
+				if i < len(users) {
+					e.IDs = append(e.IDs, users[i].ID)
+				}
+			}
+			if len(e.IDs) == 0 {
+				return xerrors.ErrDuplicateEmail
+			}
+			return e
+		}
+	}
+
+	return err
+}
+
+// itemSize estimates the size of the item as DynamoDB accounts it: the
+// lengths of the attribute names and of their values.
+func itemSize(item map[string]types.AttributeValue) int {
+	var size int
+	for name, value := range item {
+		size += len(name) + valueSize(value)
+	}
+
+	return size
+}
+
+// valueSize estimates the size of an attribute value.
+func valueSize(value types.AttributeValue) int {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return len(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		var size int
+		for _, s := range v.Value {
+			size += len(s)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		var size int
+		for _, n := range v.Value {
+			size += len(n)
+		}
+		return size
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, element := range v.Value {
+			size += 1 + valueSize(element)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		return 3 + itemSize(v.Value)
+	default:
+		// Booleans and nulls.
+		return 1
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	xerrors "user-service.mykapital.io/internal/errors"
+	"user-service.mykapital.io/internal/testsupport"
+)
+
+func TestTransact(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FirstName: "John", Version: 1})
+
+	err := model.Transact(context.Background(),
+		PutOp(User{ID: "2", FirstName: "Jane", Version: 1}),
+		UpdateOp(User{ID: "1"}.GetKey(), expression.Set(expression.Name("firstName"), expression.Value("Jack"))),
+		CheckOp(User{ID: "3"}.GetKey(), expression.AttributeExists(expression.Name("userID"))),
+	)
+
+	var transactErr *TransactionError
+	if !errors.As(err, &transactErr) {
+		t.Fatalf("unexpected error: got %v, want a *TransactionError", err)
+	}
+	if !errors.Is(err, xerrors.ErrConditionFailed) {
+		t.Errorf("expected %v to match %v", err, xerrors.ErrConditionFailed)
+	}
+	if failed := transactErr.ConditionFailed(); len(failed) != 1 || failed[0] != 2 {
+		t.Errorf("unexpected failed operations: got %v, want [2]", failed)
+	}
+	if _, ok := fake.Items["2"]; ok {
+		t.Error("expected the put of a canceled transaction not to be applied")
+	}
+
+	err = model.Transact(context.Background(),
+		PutOp(User{ID: "2", FirstName: "Jane", Version: 1}),
+		UpdateOp(User{ID: "1"}.GetKey(), expression.Set(expression.Name("firstName"), expression.Value("Jack"))),
+		CheckOp(User{ID: "1"}.GetKey(), expression.AttributeExists(expression.Name("userID"))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Items["2"]; !ok {
+		t.Error("expected the put to be applied")
+	}
+}
+
+func TestTransactInsert(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "2", FirstName: "Jane", Version: 1})
+
+	err := model.TransactInsert(context.Background(), []*User{
+		{ID: "1", FirstName: "John", Version: 1},
+		{ID: "2", FirstName: "Jack", Version: 1},
+		{ID: "3", FirstName: "Jill", Version: 1},
+	})
+
+	var duplicateErr *DuplicateUsersError
+	if !errors.As(err, &duplicateErr) {
+		t.Fatalf("unexpected error: got %v, want a *DuplicateUsersError", err)
+	}
+	if !errors.Is(err, xerrors.ErrDuplicateUser) {
+		t.Errorf("expected %v to match %v", err, xerrors.ErrDuplicateUser)
+	}
+	if len(duplicateErr.IDs) != 1 || duplicateErr.IDs[0] != "2" {
+		t.Errorf("unexpected duplicate users: got %v, want [2]", duplicateErr.IDs)
+	}
+	if _, ok := fake.Items["1"]; ok {
+		t.Error("expected the users of a canceled transaction not to be inserted")
+	}
+
+	err = model.TransactInsert(context.Background(), []*User{
+		{ID: "1", FirstName: "John", Version: 1},
+		{ID: "3", FirstName: "Jill", Version: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Items["3"]; !ok {
+		t.Error("expected the users to be inserted")
+	}
+}
+
+func TestTransactInsertLimits(t *testing.T) {
+	model, fake := newFakeModel(t)
+
+	users := make([]*User, MaxTransactOps+1)
+	for i := range users {
+		users[i] = &User{ID: fmt.Sprintf("%d", i), Version: 1}
+	}
+	if err := model.TransactInsert(context.Background(), users); err == nil {
+		t.Errorf("expected a transaction of %d users to be rejected", len(users))
+	}
+
+	// The users fit in the number of operations, but not in the size.
+	large := strings.Repeat("a", MaxTransactBytes/MaxTransactOps)
+	for i := range users[:MaxTransactOps] {
+		users[i].Meta = []MetaField{{Key: "note", Value: large}}
+	}
+	if err := model.TransactInsert(context.Background(), users[:MaxTransactOps]); err == nil {
+		t.Error("expected a transaction too large to be rejected")
+	}
+	if calls := fake.CallCount("TransactWriteItems"); calls != 0 {
+		t.Errorf("unexpected TransactWriteItems calls: got %d, want 0", calls)
+	}
+}
+
+func TestCreateClaimingEmail(t *testing.T) {
+	model, _ := newFakeModel(t)
+	model.EmailTableName = "UserEmail"
+
+	err := model.Create(context.Background(), &User{ID: "1", Email: "john.doe@example.com", Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The model has no email index, so only the claim tells the email is
+	// already taken.
+	err = model.Create(context.Background(), &User{ID: "2", Email: "john.doe@example.com", Version: 1})
+	if err != xerrors.ErrDuplicateEmail {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrDuplicateEmail)
+	}
+
+	if _, err = model.Get(context.Background(), "2"); err != xerrors.ErrRecordNotFound {
+		t.Errorf("expected the user with a claimed email not to be created, got %v", err)
+	}
+
+	err = model.Create(context.Background(), &User{ID: "1", Email: "jack.doe@example.com", Version: 1})
+	if err != xerrors.ErrDuplicateUser {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrDuplicateUser)
+	}
+}
+
+func TestInsertClaimingEmail(t *testing.T) {
+	ctx := context.Background()
+	model, fake := newFakeModel(t)
+	model.EmailTableName = "UserEmail"
+
+	if err := model.Insert(ctx, &User{ID: "1", Email: "john.doe@example.com", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if owner := claimOwner(t, fake, "john.doe@example.com"); owner != "1" {
+		t.Errorf("unexpected owner of the inserted email: got %q, want 1", owner)
+	}
+	err := model.Insert(ctx, &User{ID: "2", Email: "john.doe@example.com", Version: 1})
+	if err != xerrors.ErrDuplicateEmail {
+		t.Errorf("unexpected error of Insert: got %v, want %v", err, xerrors.ErrDuplicateEmail)
+	}
+
+	// The replacement moves the claim to the new email.
+	if err = model.InsertOrReplace(ctx, &User{ID: "1", Email: "jack.doe@example.com", Version: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if owner := claimOwner(t, fake, "jack.doe@example.com"); owner != "1" {
+		t.Errorf("unexpected owner of the replaced email: got %q, want 1", owner)
+	}
+	if owner := claimOwner(t, fake, "john.doe@example.com"); owner != "" {
+		t.Errorf("expected the previous email to be released, got owner %q", owner)
+	}
+	err = model.InsertOrReplace(ctx, &User{ID: "2", Email: "jack.doe@example.com", Version: 1})
+	if err != xerrors.ErrDuplicateEmail {
+		t.Errorf("unexpected error of InsertOrReplace: got %v, want %v", err, xerrors.ErrDuplicateEmail)
+	}
+
+	err = model.TransactInsert(ctx, []*User{
+		{ID: "3", Email: "jill.doe@example.com", Version: 1},
+		{ID: "4", Email: "jack.doe@example.com", Version: 1},
+	})
+	if err != xerrors.ErrDuplicateEmail {
+		t.Errorf("unexpected error of TransactInsert: got %v, want %v", err, xerrors.ErrDuplicateEmail)
+	}
+	if _, ok := fake.Items["3"]; ok {
+		t.Error("expected the users of a canceled transaction not to be inserted")
+	}
+
+	err = model.TransactInsert(ctx, []*User{{ID: "3", Email: "jill.doe@example.com", Version: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := claimOwner(t, fake, "jill.doe@example.com"); owner != "3" {
+		t.Errorf("unexpected owner of the transacted email: got %q, want 3", owner)
+	}
+}
+
+// claimOwner returns the owner of the claim of the email, if any.
+func claimOwner(t *testing.T, fake *testsupport.FakeDynamoDB, email string) string {
+	t.Helper()
+
+	item, ok := fake.Items[email]
+	if !ok {
+		return ""
+	}
+	var claim emailClaim
+	if err := attributevalue.UnmarshalMap(item, &claim); err != nil {
+		t.Fatal(err)
+	}
+	return claim.Owner
+}
+
+func TestEmailClaims(t *testing.T) {
+	ctx := context.Background()
+	model, fake := newFakeModel(t)
+	model.EmailTableName = "UserEmail"
+
+	if err := model.Create(ctx, &User{ID: "1", Email: "john.doe@example.com", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := model.CreateIfAbsent(ctx, &User{ID: "2", Email: "jane.doe@example.com", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	err := model.CreateIfAbsent(ctx, &User{ID: "3", Email: "john.doe@example.com", Version: 1})
+	if err != xerrors.ErrDuplicateEmail {
+		t.Errorf("unexpected error of CreateIfAbsent: got %v, want %v", err, xerrors.ErrDuplicateEmail)
+	}
+
+	// The update moves the claim to the new email.
+	john, err := model.Get(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = model.Update(ctx, john, map[string]interface{}{"email": "jack.doe@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if owner := claimOwner(t, fake, "jack.doe@example.com"); owner != "1" {
+		t.Errorf("unexpected owner of the new email: got %q, want 1", owner)
+	}
+	if owner := claimOwner(t, fake, "john.doe@example.com"); owner != "" {
+		t.Errorf("expected the previous email to be released, got owner %q", owner)
+	}
+
+	jane, err := model.Get(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = model.Update(ctx, jane, map[string]interface{}{"email": "jack.doe@example.com"})
+	if err != xerrors.ErrDuplicateEmail {
+		t.Errorf("unexpected error of Update: got %v, want %v", err, xerrors.ErrDuplicateEmail)
+	}
+
+	// The replacement moves the claim as well.
+	err = model.Replace(ctx, &User{ID: "2", Email: "john.doe@example.com"}, jane.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := claimOwner(t, fake, "john.doe@example.com"); owner != "2" {
+		t.Errorf("unexpected owner of the replaced email: got %q, want 2", owner)
+	}
+	if owner := claimOwner(t, fake, "jane.doe@example.com"); owner != "" {
+		t.Errorf("expected the replaced email to be released, got owner %q", owner)
+	}
+
+	// The deletion releases the claim, so the email can be registered again.
+	if err = model.Delete(ctx, &User{ID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if owner := claimOwner(t, fake, "john.doe@example.com"); owner != "" {
+		t.Errorf("expected the email of the deleted user to be released, got owner %q", owner)
+	}
+	if err = model.Delete(ctx, &User{ID: "2"}); err != nil {
+		t.Errorf("unexpected error deleting the user again: %v", err)
+	}
+
+	err = model.InsertBatch(ctx, []*User{
+		{ID: "4", Email: "john.doe@example.com", Version: 1},
+		{ID: "5", Email: "jack.doe@example.com", Version: 1},
+	})
+	var batchErr *xerrors.BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.IDs) != 1 || batchErr.IDs[0] != "5" {
+		t.Fatalf("unexpected error of InsertBatch: got %v, want the user 5 rejected", err)
+	}
+	if owner := claimOwner(t, fake, "john.doe@example.com"); owner != "4" {
+		t.Errorf("unexpected owner of the inserted email: got %q, want 4", owner)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+// WriteTransform normalizes or enriches a user before it is stored, like
+// Normalize.
+type WriteTransform func(*User)
+
+// transform applies the WriteTransforms of the model to the user.
+func (m Model) transform(user *User) {
+	for _, fn := range m.WriteTransforms {
+		fn(user)
+	}
+}
+
+// transformAttributes applies the WriteTransforms of the model to the new
+// attributes of an update of the user.
+//
+// The transforms run on a copy of the user holding the new attributes,
+// and the attributes they changed are returned along with the others. The
+// attributes which aren't fields of User are left as is, and so are the
+// attributes cleared by the transforms.
+func (m Model) transformAttributes(user *User, newAttributes map[string]interface{}) (map[string]interface{}, error) {
+	if len(m.WriteTransforms) == 0 {
+		return newAttributes, nil
+	}
+
+	updated := *user
+	item, err := attributevalue.MarshalMap(newAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal the attributes to transform. Here's why: %v", err)
+	}
+	if err = attributevalue.UnmarshalMap(item, &updated); err != nil {
+		return nil, fmt.Errorf("couldn't apply the attributes to transform. Here's why: %v", err)
+	}
+
+	before, err := attributevalue.MarshalMap(updated)
+	if err != nil {
+		panic(err)
+	}
+	m.transform(&updated)
+	after, err := attributevalue.MarshalMap(updated)
+	if err != nil {
+		panic(err)
+	}
+
+	attributes := make(map[string]interface{}, len(newAttributes))
+	for k, v := range newAttributes {
+		attributes[k] = v
+		if after[k] == nil || reflect.DeepEqual(before[k], after[k]) {
+			continue
+		}
+		var value interface{}
+		if err = attributevalue.Unmarshal(after[k], &value); err != nil {
+			return nil, fmt.Errorf("couldn't unmarshal the transformed %s. Here's why: %v", k, err)
+		}
+		attributes[k] = value
+	}
+
+	return attributes, nil
+}
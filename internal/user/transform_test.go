@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+func TestWriteTransforms(t *testing.T) {
+	model, fake := newFakeModel(t)
+	model.WriteTransforms = []WriteTransform{Normalize, func(user *User) {
+		if user.Currency == "" && user.CountryCodeAlpha2 == "CA" {
+			user.Currency = "CAD"
+		}
+	}}
+
+	stored := func() User {
+		t.Helper()
+		var usr User
+		if err := attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+			t.Fatal(err)
+		}
+		return usr
+	}
+
+	err := model.Insert(context.Background(), &User{ID: "1", Email: " John@Example.com", CountryCodeAlpha2: "ca ", ProvinceCode: "on", Version: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr := stored()
+	if usr.Email != "john@example.com" || usr.CountryCodeAlpha2 != "CA" || usr.ProvinceCode != "ON" || usr.Currency != "CAD" {
+		t.Errorf("unexpected inserted user: %+v", usr)
+	}
+
+	_, err = model.Update(context.Background(), &usr, map[string]interface{}{"provinceCode": " qc", "firstName": "John", "currency": "usd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr = stored()
+	if usr.ProvinceCode != "QC" || usr.Currency != "USD" || usr.FirstName != "John" {
+		t.Errorf("unexpected updated user: %+v", usr)
+	}
+}
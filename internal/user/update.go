@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"reflect"
+	"strings"
+
+	"user-service.mykapital.io/internal/validator"
+)
+
+// UpdateOptions configures the attributes built by BuildUpdateAttributes.
+type UpdateOptions struct {
+	// Exclude are the attributes left out of the update, such as the
+	// attributes managed by the server.
+	Exclude []string
+	// Remove are the pointer attributes which are removed from the item
+	// when nil, instead of being left out of the update.
+	Remove []string
+}
+
+// BuildUpdateAttributes returns the new attributes of an update from the
+// fields of the struct v, or of the struct v points to, keyed by the names
+// of their dynamodbav tags, or by their field names without one.
+//
+// The zero fields are left out, whether their tag has omitempty or not,
+// as they weren't given. A nil pointer is left out as well, unless its
+// attribute is in opts.Remove: it is then nil, which Update removes from
+// the item. A pointer to a zero value is kept. The unexported fields and
+// the fields tagged dynamodbav:"-" are never part of the update.
+func BuildUpdateAttributes(v interface{}, opts UpdateOptions) map[string]interface{} {
+	val := reflect.Indirect(reflect.ValueOf(v))
+	typ := val.Type()
+
+	attributes := make(map[string]interface{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("dynamodbav"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if !field.IsExported() || name == "-" || validator.In(name, opts.Exclude...) {
+			continue
+		}
+
+		value := val.Field(i)
+		switch {
+		case value.Kind() == reflect.Pointer && value.IsNil():
+			if validator.In(name, opts.Remove...) {
+				attributes[name] = nil
+			}
+		case value.Kind() != reflect.Pointer && value.IsZero():
+		default:
+			attributes[name] = value.Interface()
+		}
+	}
+
+	return attributes
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+func TestBuildUpdateAttributes(t *testing.T) {
+	type settings struct {
+		Name     string  `dynamodbav:"displayName,omitempty"`
+		Count    int64   `dynamodbav:"count"`
+		Enabled  *bool   `dynamodbav:"enabled,omitempty"`
+		Notes    *string `dynamodbav:"notes"`
+		Untagged string
+		Skipped  string `dynamodbav:"-"`
+		internal string
+	}
+	disabled := false
+
+	tests := map[string]struct {
+		v        interface{}
+		opts     UpdateOptions
+		expected map[string]interface{}
+	}{
+		`tag names`: {
+			v:        settings{Name: "John", Count: 3, Untagged: "x"},
+			expected: map[string]interface{}{"displayName": "John", "count": int64(3), "Untagged": "x"},
+		},
+		`zero values with and without omitempty`: {
+			v:        &settings{Name: "", Count: 0},
+			expected: map[string]interface{}{},
+		},
+		`pointer to a zero value`: {
+			v:        settings{Enabled: &disabled},
+			expected: map[string]interface{}{"enabled": &disabled},
+		},
+		`removed nil pointer`: {
+			v:        settings{Count: 1},
+			opts:     UpdateOptions{Remove: []string{"notes", "count"}},
+			expected: map[string]interface{}{"count": int64(1), "notes": nil},
+		},
+		`excluded and skipped fields`: {
+			v:        settings{Name: "John", Count: 3, Skipped: "x", internal: "x"},
+			opts:     UpdateOptions{Exclude: []string{"count"}},
+			expected: map[string]interface{}{"displayName": "John"},
+		},
+		`user`: {
+			v:        User{ID: "1", FirstName: "John", CountryCodeAlpha2: "CA", Income: 100, CreatedAt: "2023-01-01"},
+			opts:     UpdateOptions{Exclude: []string{"userID", "createdAt"}},
+			expected: map[string]interface{}{"firstName": "John", "countryCodeAlpha2": "CA", "income": Money(100)},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := BuildUpdateAttributes(tt.v, tt.opts)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("unexpected attributes: got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpdateRemovedAttributes(t *testing.T) {
+	model, fake := newFakeModel(t, User{ID: "1", FirstName: "John", Spouse: &FamilyMember{FirstName: "Jane"}, Version: 1})
+
+	attributes := BuildUpdateAttributes(User{FirstName: "Jack"}, UpdateOptions{Remove: []string{"spouse"}})
+	if _, err := model.Update(context.Background(), &User{ID: "1", Version: 1}, attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	var usr User
+	if err := attributevalue.UnmarshalMap(fake.Items["1"], &usr); err != nil {
+		t.Fatal(err)
+	}
+	if usr.FirstName != "Jack" || usr.Spouse != nil {
+		t.Errorf("unexpected user: got %q with spouse %v", usr.FirstName, usr.Spouse)
+	}
+	if _, ok := fake.Items["1"]["spouse"]; ok {
+		t.Error("the spouse attribute was not removed")
+	}
+}
@@ -20,6 +20,7 @@ package user
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -28,104 +29,125 @@ import (
 )
 
 // User struct is the main struct declaring user fields.
+//
+// The json tags define the representation of the user in the API, which
+// uses snake_case keys and hides the internal fields.
 type User struct {
 	// ID is the UUID of the user.
-	ID           string `dynamodbav:"userID"` // dynamodbav is the representation of the field as a dynamodb attribute.
-	Email        string `dynamodbav:"email"`
-	FirstName    string `dynamodbav:"firstName"`
-	LastName     string `dynamodbav:"lastName"`
-	ProvinceCode string `dynamodbav:"provinceCode"`
+	ID           string `dynamodbav:"userID" json:"id"` // dynamodbav is the representation of the field as a dynamodb attribute.
+	Email        string `dynamodbav:"email" json:"email"`
+	FirstName    string `dynamodbav:"firstName" json:"first_name"`
+	LastName     string `dynamodbav:"lastName" json:"last_name"`
+	ProvinceCode string `dynamodbav:"provinceCode" json:"province_code"`
 	// CountryCodeAlpha2 represents the two-letter word representing a country.
 	//
 	// For example Country Code Alpha 2 for Canada is "CA".
-	CountryCodeAlpha2 string `dynamodbav:"countryCodeAlpha2"`
-	Currency          string `dynamodbav:"currency"`
+	CountryCodeAlpha2 string `dynamodbav:"countryCodeAlpha2" json:"country_code_alpha_2"`
+	Currency          string `dynamodbav:"currency" json:"currency"`
 	// AdministrativeDivision is the type of the division within a country.
 	//
 	// For example Administrative Division of Canada is "province".
-	AdministrativeDivision string `dynamodbav:"administrativeDivision"`
-	DateOfBirth            string `dynamodbav:"dateOfBirth,omitempty"`
-	Occupation             string `dynamodbav:"occupation,omitempty"`
+	AdministrativeDivision string `dynamodbav:"administrativeDivision" json:"administrative_division"`
+	DateOfBirth            string `dynamodbav:"dateOfBirth,omitempty" json:"date_of_birth,omitempty"`
+	Occupation             string `dynamodbav:"occupation,omitempty" json:"occupation,omitempty"`
 	// Income represent the amount in the user's currency.
-	Income string `dynamodbav:"income,omitempty"`
+	Income Money `dynamodbav:"income,omitempty" json:"income,omitempty"`
 	// Expenses represent the amount in the user's currency.
-	Expenses           string `dynamodbav:"expenses,omitempty"`
-	FamilyMemberNumber int64  `dynamodbav:"familyMemberNumber,omitempty"`
-	IsMarried          bool   `dynamodbav:"isMarried,omitempty"`
+	Expenses           Money `dynamodbav:"expenses,omitempty" json:"expenses,omitempty"`
+	FamilyMemberNumber int64 `dynamodbav:"familyMemberNumber,omitempty" json:"family_member_number,omitempty"`
+	IsMarried          bool  `dynamodbav:"isMarried,omitempty" json:"is_married,omitempty"`
 	// Spouse should be a pointer, else dynamodb would reject the field.
-	Spouse      *FamilyMember  `dynamodbav:"spouse,omitempty"`
-	Dependents  []FamilyMember `dynamodbav:"dependents,omitempty"`
-	Milestones  []Milestone    `dynamodbav:"milestones,omitempty"`
-	Goals       []Goal         `dynamodbav:"goals,omitempty"`
-	Protections []Protection   `dynamodbav:"protections,omitempty"`
-	Debts       []Debt         `dynamodbav:"debts,omitempty"`
+	Spouse      *FamilyMember  `dynamodbav:"spouse,omitempty" json:"spouse,omitempty"`
+	Dependents  []FamilyMember `dynamodbav:"dependents,omitempty" json:"dependents,omitempty"`
+	Milestones  []Milestone    `dynamodbav:"milestones,omitempty" json:"milestones,omitempty"`
+	Goals       []Goal         `dynamodbav:"goals,omitempty" json:"goals,omitempty"`
+	Protections []Protection   `dynamodbav:"protections,omitempty" json:"protections,omitempty"`
+	Debts       []Debt         `dynamodbav:"debts,omitempty" json:"debts,omitempty"`
 	// RiskTolerance can be represented in a different metric.
 	//
 	// TODO: Find the correct metric for RiskTolerance.
-	RiskTolerance string `dynamodbav:"riskTolerance,omitempty"`
-	CreatedAt     string `dynamodbav:"createdAt"`
-	// Version is used to handle data races
-	Version int64       `dynamodbav:"version"`
-	Meta    []MetaField `dynamodbav:"meta,omitempty"`
+	RiskTolerance string `dynamodbav:"riskTolerance,omitempty" json:"risk_tolerance,omitempty"`
+	CreatedAt     string `dynamodbav:"createdAt" json:"created_at"`
+	// Version is used to handle data races, and is not part of the API.
+	Version int64       `dynamodbav:"version" json:"-"`
+	Meta    []MetaField `dynamodbav:"meta,omitempty" json:"meta,omitempty"`
+	// Activated is set once the email of the user is verified.
+	Activated bool `dynamodbav:"activated" json:"activated"`
+	// Verification is never exposed, as it holds the token hash.
+	Verification *Verification `dynamodbav:"verification,omitempty" json:"-"`
+	// Phone is set once verified with a code sent by text message.
+	Phone         string `dynamodbav:"phone,omitempty" json:"phone,omitempty"`
+	PhoneVerified bool   `dynamodbav:"phoneVerified,omitempty" json:"phone_verified,omitempty"`
+	// PhoneVerification is never exposed, as it holds the code hash.
+	PhoneVerification *PhoneVerification `dynamodbav:"phoneVerification,omitempty" json:"-"`
+	// DeletedAt is set once the user is soft-deleted. Get hides the
+	// soft-deleted users, unless the model includes them.
+	DeletedAt string `dynamodbav:"deletedAt,omitempty" json:"deleted_at,omitempty"`
 }
 
 // FamilyMember struct declares family member fields
 type FamilyMember struct {
 	// Type is either Spouse or Child
-	Type        string
-	FirstName   string
-	LastName    string
-	DateOfBirth string
+	Type        string `json:"type"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	DateOfBirth string `json:"date_of_birth"`
 	// Income represent the amount in the user's currency.
-	Income string
+	Income Money `json:"income"`
 	// Expenses represent the amount in the user's currency.
-	Expenses string
+	Expenses Money `json:"expenses"`
 }
 
 // Goal struct declares the financial goal of the user
 type Goal struct {
-	Date              string
-	Title             string
-	ProgressLevel     string
-	EstimatedDuration time.Duration
-	Description       string
+	Date              string        `json:"date"`
+	Title             string        `json:"title"`
+	ProgressLevel     string        `json:"progress_level"`
+	EstimatedDuration time.Duration `json:"estimated_duration"`
+	Description       string        `json:"description"`
 }
 
+// MilestoneTypes are the allowed types of a Milestone.
+var MilestoneTypes = []string{"Debt", "Savings", "Investment", "Other"}
+
+// GoalProgressLevels are the allowed progress levels of a Goal.
+var GoalProgressLevels = []string{"not_started", "in_progress", "completed"}
+
 // Milestone struct declares the financial achievement of the user
 type Milestone struct {
-	Date        string
-	Title       string
-	Type        string
-	Description string
+	Date        string `json:"date"`
+	Title       string `json:"title"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
 }
 
 // Protection struct declares the financial protection the user
 // currently posses.
 type Protection struct {
-	Type           string
-	Premium        int64
-	ClaimedDate    string
-	ExpirationDate string
-	Description    string
+	Type           string `json:"type"`
+	Premium        int64  `json:"premium"`
+	ClaimedDate    string `json:"claimed_date"`
+	ExpirationDate string `json:"expiration_date"`
+	Description    string `json:"description"`
 }
 
 // Debt struct declares the financial debt the user
 // currently posses.
 type Debt struct {
-	Type         string
-	Cost         string
-	InterestRate int64
-	Term         int64
-	Collateral   string
-	Description  string
+	Type         string `json:"type"`
+	Cost         Money  `json:"cost"`
+	InterestRate int64  `json:"interest_rate"`
+	Term         int64  `json:"term"`
+	Collateral   string `json:"collateral"`
+	Description  string `json:"description"`
 }
 
 // MetaField struct declares user's personalized configuration
 type MetaField struct {
-	Key       string
-	Namespace string
-	Value     string
-	Type      string
+	Key       string `json:"key"`
+	Namespace string `json:"namespace"`
+	Value     string `json:"value"`
+	Type      string `json:"type"`
 }
 
 // GetKey is used to create a primary key for dynamodb.
@@ -138,17 +160,163 @@ func (user User) GetKey() map[string]types.AttributeValue {
 	return map[string]types.AttributeValue{"userID": id}
 }
 
+// Age returns the age of the user from its date of birth. It is not ok
+// when the date of birth is missing or invalid.
+func (user User) Age() (int, bool) {
+	return ageAt(user.DateOfBirth, time.Now())
+}
+
+// Rules declares the configurable parts of the User validation.
+type Rules struct {
+	// Regions are the countries with known conventions.
+	Regions map[string]Region
+	// DateOfBirthRequired are the countries where the date of birth is
+	// mandatory, such as for KYC purposes. It is optional elsewhere.
+	DateOfBirthRequired []string
+	// DefaultCurrency is the currency assumed when it can't be defaulted
+	// from the country and the client omits it. It is not assumed when
+	// empty.
+	DefaultCurrency string
+	// StrictCurrency rejects the users whose currency can't be defaulted
+	// from the country and is omitted, instead of assuming one.
+	StrictCurrency bool
+	// MaxDependents caps the number of dependents of a user, as very long
+	// lists are likely erroneous. The dependents are unlimited when it is 0.
+	MaxDependents int
+	// Occupations are the codes an occupation must match, such as
+	// ISCOSubMajorGroups. Occupations are free-form when it is empty.
+	Occupations []string
+	// MaxMetaValueBytes caps the size of the value of a meta field, so a
+	// single value can't bloat the item. Values are unlimited when it is 0.
+	MaxMetaValueBytes int
+	// MaxGoalDuration caps the estimated duration of the goals, as
+	// durations of centuries are likely erroneous. The durations are
+	// unlimited when it is 0.
+	MaxGoalDuration time.Duration
+	// MetaNamespaces are the namespaces allowed in the meta fields, which
+	// are enforced by FilterMeta according to the MetaPolicy. Any
+	// namespace is allowed when it is empty.
+	MetaNamespaces []string
+	// MetaPolicy is how FilterMeta handles the meta fields of the other
+	// namespaces.
+	MetaPolicy MetaPolicy
+	// RejectFutureMilestones rejects the milestones dated after the
+	// current day, as a milestone is an achievement.
+	RejectFutureMilestones bool
+	// Now returns the current time, and is time.Now when nil.
+	Now func() time.Time
+}
+
+// MetaPolicy is how the meta fields of namespaces which aren't allowed
+// are handled.
+type MetaPolicy string
+
+const (
+	// MetaPassthrough keeps the meta fields of any namespace.
+	MetaPassthrough MetaPolicy = "passthrough"
+	// MetaStrip drops the meta fields of the namespaces not allowed.
+	MetaStrip MetaPolicy = "strip"
+	// MetaReject rejects the user with meta fields of the namespaces not
+	// allowed.
+	MetaReject MetaPolicy = "reject"
+)
+
+// DefaultMaxDependents is the default maximum number of dependents.
+const DefaultMaxDependents = 20
+
+// DefaultMaxMetaValueBytes is the default maximum size of a meta value.
+const DefaultMaxMetaValueBytes = 4096
+
+// Year is the length of a year, as used to express the goal durations.
+const Year = 365 * 24 * time.Hour
+
+// DefaultMaxGoalDuration is the default maximum estimated duration of a
+// goal.
+const DefaultMaxGoalDuration = 100 * Year
+
+// DefaultRules are the rules used by ValidateUser.
+var DefaultRules = Rules{
+	Regions:           DefaultRegions,
+	MaxDependents:     DefaultMaxDependents,
+	MaxMetaValueBytes: DefaultMaxMetaValueBytes,
+	MaxGoalDuration:   DefaultMaxGoalDuration,
+}
+
+// ValidateUser validates User data with the DefaultRules.
+func ValidateUser(v *validator.Validator, user *User) {
+	DefaultRules.ValidateUser(v, user)
+}
+
+// Normalize trims and upper-cases the country, province and currency
+// codes of the user, so they can be matched against the known codes. The
+// email is normalized as the key of the email index.
+func Normalize(user *User) {
+	user.Email = NormalizeEmail(user.Email)
+	user.CountryCodeAlpha2 = strings.ToUpper(strings.TrimSpace(user.CountryCodeAlpha2))
+	user.ProvinceCode = strings.ToUpper(strings.TrimSpace(user.ProvinceCode))
+	user.Currency = strings.ToUpper(strings.TrimSpace(user.Currency))
+}
+
 // ValidateUser validates User data.
 //
 // The email address of the user should follow the regex validator.EmailRX.
-// First name, last name, province code, spouse (if applicable) and
-// dependent (if applicable) must be provided.
-// Spouse (if applicable) and dependents (if applicable) must be validated.
-func ValidateUser(v *validator.Validator, user *User) {
+// First name, province code, spouse (if applicable) and dependent
+// (if applicable) must be provided, and a warning is raised when the
+// last name is missing.
+// The date of birth must be provided in the countries requiring it, and
+// must be a valid date which isn't in the future when provided.
+// The currency (if provided) must be an ISO 4217 code.
+// The province code must belong to the country when its subdivisions
+// are known.
+// The administrative division (if provided) must be allowed for the
+// country of the user.
+// Spouse (if applicable) and dependents (if applicable) must be validated,
+// as well as the milestones, the goals, the protections and the meta
+// fields.
+// There must not be more than MaxDependents dependents.
+// The occupation (if provided) must be valid.
+// With RejectFutureMilestones, the milestones must not be dated after the
+// current day.
+// The amounts must not have more decimal places than the minor units of
+// the currency.
+func (r Rules) ValidateUser(v *validator.Validator, user *User) {
 	v.Check(validator.Matches(user.Email, validator.EmailRX), "email", "must be valid")
 	v.Check(user.FirstName != "", "first_name", "must be provided")
-	v.Check(len(user.CountryCodeAlpha2) == 2, "country_code_alpha_2", "must be two letters")
+	v.Warn(user.LastName != "", "last_name", "should be provided")
+	v.Check(
+		validator.IsCountryCode(user.CountryCodeAlpha2),
+		"country_code_alpha_2",
+		"must be a valid ISO 3166-1 alpha-2 country code",
+	)
 	v.Check(user.ProvinceCode != "", "province_code", "must be provided")
+	if user.Currency != "" {
+		v.Check(validator.IsCurrency(user.Currency), "currency", "must be a valid ISO 4217 code")
+	}
+	validateAmounts(v, user)
+
+	if validator.In(strings.ToUpper(user.CountryCodeAlpha2), r.DateOfBirthRequired...) {
+		v.Check(user.DateOfBirth != "", "date_of_birth", "must be provided")
+	}
+	if user.DateOfBirth != "" {
+		v.Check(validator.IsDate(user.DateOfBirth), "date_of_birth", "must be a valid date (YYYY-MM-DD)")
+		v.Check(!r.isFuture(user.DateOfBirth), "date_of_birth", "must not be in the future")
+	}
+
+	if _, ok := validator.Subdivisions[strings.ToUpper(user.CountryCodeAlpha2)]; ok && user.ProvinceCode != "" {
+		v.Check(
+			validator.IsSubdivision(user.CountryCodeAlpha2, user.ProvinceCode),
+			"province_code",
+			"is not valid for the given country",
+		)
+	}
+
+	if region, ok := r.Regions[user.CountryCodeAlpha2]; ok && user.AdministrativeDivision != "" {
+		v.Check(
+			validator.In(user.AdministrativeDivision, region.AdministrativeDivisions...),
+			"administrative_division",
+			"must be one of "+strings.Join(region.AdministrativeDivisions, ", "),
+		)
+	}
 
 	if user.IsMarried {
 		v.Check(user.Spouse != nil, "spouse", "must be provided")
@@ -157,12 +325,82 @@ func ValidateUser(v *validator.Validator, user *User) {
 		}
 	}
 
+	ValidateOccupation(v, user.Occupation, r.Occupations)
+
+	if r.MaxDependents > 0 {
+		v.Check(
+			len(user.Dependents) <= r.MaxDependents,
+			"dependents",
+			fmt.Sprintf("must not contain more than %d dependents", r.MaxDependents),
+		)
+	}
+
 	if user.Dependents != nil {
 		for i, dep := range user.Dependents {
 			depName := fmt.Sprintf("dependent_%d", i+1)
 			ValidateFamilyMember(v, &dep, depName)
 		}
 	}
+
+	for i, milestone := range user.Milestones {
+		milestoneName := fmt.Sprintf("milestone_%d", i+1)
+		ValidateMilestone(v, &milestone, milestoneName)
+		if r.RejectFutureMilestones {
+			v.Check(!r.isFuture(milestone.Date), milestoneName+"_date", "must not be in the future")
+		}
+	}
+
+	for i, goal := range user.Goals {
+		ValidateGoal(v, &goal, fmt.Sprintf("goal_%d", i+1), r.MaxGoalDuration)
+	}
+
+	for i, protection := range user.Protections {
+		ValidateProtection(v, &protection, fmt.Sprintf("protection_%d", i+1))
+	}
+
+	for i, meta := range user.Meta {
+		ValidateMeta(v, &meta, fmt.Sprintf("meta_%d", i+1), r.MaxMetaValueBytes)
+	}
+}
+
+// validateAmounts checks that the amounts of the user have no more
+// decimal places than the minor units of its currency.
+func validateAmounts(v *validator.Validator, user *User) {
+	message := fmt.Sprintf("must not have more than %d decimal places", CurrencyExponent(user.Currency))
+	check := func(amount Money, key string) {
+		v.Check(amount.FitsCurrency(user.Currency), key, message)
+	}
+
+	check(user.Income, "income")
+	check(user.Expenses, "expenses")
+	if user.Spouse != nil {
+		check(user.Spouse.Income, "spouse_income")
+		check(user.Spouse.Expenses, "spouse_expenses")
+	}
+	for i, dep := range user.Dependents {
+		depName := fmt.Sprintf("dependent_%d", i+1)
+		check(dep.Income, depName+"_income")
+		check(dep.Expenses, depName+"_expenses")
+	}
+	for i, debt := range user.Debts {
+		check(debt.Cost, fmt.Sprintf("debt_%d_cost", i+1))
+	}
+}
+
+// isFuture tells whether the date, as "2006-01-02", is after the current
+// day. The malformed dates are never in the future.
+func (r Rules) isFuture(date string) bool {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return false
+	}
+
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+
+	return day.Format("2006-01-02") > now().Format("2006-01-02")
 }
 
 // ValidateFamilyMember validates FamilyMember data.
@@ -172,3 +410,101 @@ func ValidateFamilyMember(v *validator.Validator, familyMember *FamilyMember, un
 	v.Check(familyMember.Type != "", uniqueName+"_type", "must be provided")
 	v.Check(familyMember.FirstName != "", uniqueName+"_first_name", "must be provided")
 }
+
+// ValidateMilestone validates Milestone data.
+//
+// The type must be one of MilestoneTypes, and the date (if provided) must
+// be a valid date.
+func ValidateMilestone(v *validator.Validator, milestone *Milestone, uniqueName string) {
+	v.Check(
+		validator.In(milestone.Type, MilestoneTypes...),
+		uniqueName+"_type",
+		"must be one of "+strings.Join(MilestoneTypes, ", "),
+	)
+	validateDate(v, milestone.Date, uniqueName+"_date")
+}
+
+// ValidateGoal validates Goal data.
+//
+// The progress level must be one of GoalProgressLevels, and the date (if
+// provided) must be a valid date. The estimated duration must not be
+// negative, nor longer than maxDuration, unless it is 0.
+func ValidateGoal(v *validator.Validator, goal *Goal, uniqueName string, maxDuration time.Duration) {
+	v.Check(
+		validator.In(goal.ProgressLevel, GoalProgressLevels...),
+		uniqueName+"_progress_level",
+		"must be one of "+strings.Join(GoalProgressLevels, ", "),
+	)
+	validateDate(v, goal.Date, uniqueName+"_date")
+	v.Check(goal.EstimatedDuration >= 0, uniqueName+"_estimated_duration", "must not be negative")
+	if maxDuration > 0 {
+		v.Check(
+			goal.EstimatedDuration <= maxDuration,
+			uniqueName+"_estimated_duration",
+			fmt.Sprintf("must not be longer than %g years", float64(maxDuration)/float64(Year)),
+		)
+	}
+}
+
+// ValidateProtection validates Protection data.
+//
+// The claimed and expiration dates (if provided) must be valid dates.
+func ValidateProtection(v *validator.Validator, protection *Protection, uniqueName string) {
+	validateDate(v, protection.ClaimedDate, uniqueName+"_claimed_date")
+	validateDate(v, protection.ExpirationDate, uniqueName+"_expiration_date")
+}
+
+// validateDate checks that the date, when provided, is a valid date.
+func validateDate(v *validator.Validator, date, key string) {
+	if date != "" {
+		v.Check(validator.IsDate(date), key, "must be a valid date (YYYY-MM-DD)")
+	}
+}
+
+// FilterMeta enforces the MetaNamespaces on the meta fields according to
+// the MetaPolicy, and returns the meta fields to keep along with the
+// dropped ones.
+//
+// With MetaStrip, the meta fields of the other namespaces are dropped,
+// and nil is kept when none is left. With MetaReject, they are all kept,
+// but an error is added for each of them.
+func (r Rules) FilterMeta(v *validator.Validator, meta []MetaField) (kept, dropped []MetaField) {
+	if len(r.MetaNamespaces) == 0 {
+		return meta, nil
+	}
+
+	switch r.MetaPolicy {
+	case MetaStrip:
+		for _, field := range meta {
+			if validator.In(field.Namespace, r.MetaNamespaces...) {
+				kept = append(kept, field)
+			} else {
+				dropped = append(dropped, field)
+			}
+		}
+		return kept, dropped
+	case MetaReject:
+		for i, field := range meta {
+			v.Check(
+				validator.In(field.Namespace, r.MetaNamespaces...),
+				fmt.Sprintf("meta_%d_namespace", i+1),
+				"must be one of "+strings.Join(r.MetaNamespaces, ", "),
+			)
+		}
+	}
+
+	return meta, nil
+}
+
+// ValidateMeta validates MetaField data.
+//
+// The value must not be larger than maxValueBytes, unless it is 0.
+func ValidateMeta(v *validator.Validator, meta *MetaField, uniqueName string, maxValueBytes int) {
+	if maxValueBytes > 0 {
+		v.Check(
+			len(meta.Value) <= maxValueBytes,
+			uniqueName+"_value",
+			fmt.Sprintf("must not be more than %d bytes long", maxValueBytes),
+		)
+	}
+}
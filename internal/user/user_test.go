@@ -17,7 +17,11 @@ limitations under the License.
 package user
 
 import (
+	"encoding/json"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"user-service.mykapital.io/internal/validator"
@@ -31,7 +35,7 @@ func TestUserGetKey(t *testing.T) {
 		`get primary key`: {
 			input: User{ID: "77d1cbe1-f734-4b94-b69e-e9d55b81ed19"},
 			expected: map[string]types.AttributeValue{
-				"ID": &types.AttributeValueMemberS{
+				"userID": &types.AttributeValueMemberS{
 					Value: "77d1cbe1-f734-4b94-b69e-e9d55b81ed19",
 				},
 			},
@@ -39,7 +43,7 @@ func TestUserGetKey(t *testing.T) {
 		`empty primary key`: {
 			input: User{ID: ""},
 			expected: map[string]types.AttributeValue{
-				"ID": &types.AttributeValueMemberS{
+				"userID": &types.AttributeValueMemberS{
 					Value: "",
 				},
 			},
@@ -117,11 +121,81 @@ func TestValidateUser(t *testing.T) {
 			expected: map[string]string{
 				"email":                "must be valid",
 				"first_name":           "must be provided",
-				"country_code_alpha_2": "must be two letters",
+				"country_code_alpha_2": "must be a valid ISO 3166-1 alpha-2 country code",
 				"province_code":        "must be provided",
 				"spouse":               "must be provided",
 			},
 		},
+		`province of another country`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "CA",
+				ProvinceCode:      "TX",
+			},
+			expected: map[string]string{
+				"province_code": "is not valid for the given country",
+			},
+		},
+		`province of another country in the US`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "US",
+				ProvinceCode:      "ON",
+			},
+			expected: map[string]string{
+				"province_code": "is not valid for the given country",
+			},
+		},
+		`province of a country without known subdivisions`: {
+			user: User{
+				Email:             "jean.dupont@example.com",
+				FirstName:         "Jean",
+				CountryCodeAlpha2: "FR",
+				ProvinceCode:      "IDF",
+			},
+			expected: make(map[string]string),
+		},
+		`missing province of a country without known subdivisions`: {
+			user: User{
+				Email:             "jean.dupont@example.com",
+				FirstName:         "Jean",
+				CountryCodeAlpha2: "FR",
+			},
+			expected: map[string]string{
+				"province_code": "must be provided",
+			},
+		},
+		`lower case province`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "CA",
+				ProvinceCode:      "on",
+			},
+			expected: make(map[string]string),
+		},
+		`lower case country`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "ca",
+				ProvinceCode:      "ON",
+			},
+			expected: make(map[string]string),
+		},
+		`unknown country`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "ZZ",
+				ProvinceCode:      "ON",
+			},
+			expected: map[string]string{
+				"country_code_alpha_2": "must be a valid ISO 3166-1 alpha-2 country code",
+			},
+		},
 		`invalid family member`: {
 			user: User{
 				Email:             "john.doe@example.com",
@@ -145,6 +219,48 @@ func TestValidateUser(t *testing.T) {
 				"dependent_2_type":       "must be provided",
 			},
 		},
+		`valid milestones and goals`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "US",
+				ProvinceCode:      "CA",
+				Milestones:        []Milestone{{Type: "Debt"}, {Type: "Savings"}},
+				Goals:             []Goal{{ProgressLevel: "not_started"}, {ProgressLevel: "completed"}},
+			},
+			expected: make(map[string]string),
+		},
+		`invalid milestones and goals`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "US",
+				ProvinceCode:      "CA",
+				Milestones:        []Milestone{{Type: "Debt"}, {Type: "debt"}, {}},
+				Goals:             []Goal{{ProgressLevel: "done"}},
+			},
+			expected: map[string]string{
+				"milestone_2_type":      "must be one of Debt, Savings, Investment, Other",
+				"milestone_3_type":      "must be one of Debt, Savings, Investment, Other",
+				"goal_1_progress_level": "must be one of not_started, in_progress, completed",
+			},
+		},
+		`amounts finer than the currency`: {
+			user: User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "US",
+				ProvinceCode:      "CA",
+				Currency:          "JPY",
+				Income:            MinorUnits(5000, "JPY"),
+				Expenses:          MinorUnits(1050, "USD"),
+				Debts:             []Debt{{Cost: MinorUnits(1125, "BHD")}},
+			},
+			expected: map[string]string{
+				"expenses":    "must not have more than 0 decimal places",
+				"debt_1_cost": "must not have more than 0 decimal places",
+			},
+		},
 	}
 
 	for name, tt := range tests {
@@ -166,3 +282,315 @@ func TestValidateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalize(t *testing.T) {
+	usr := User{CountryCodeAlpha2: " ca", ProvinceCode: "qc "}
+
+	Normalize(&usr)
+
+	if usr.CountryCodeAlpha2 != "CA" || usr.ProvinceCode != "QC" {
+		t.Errorf("unexpected normalized codes: got '%s' and '%s'", usr.CountryCodeAlpha2, usr.ProvinceCode)
+	}
+}
+
+func TestValidateDateOfBirthRequired(t *testing.T) {
+	rules := Rules{Regions: DefaultRegions, DateOfBirthRequired: []string{"US"}}
+
+	tests := map[string]struct {
+		country     string
+		province    string
+		dateOfBirth string
+		valid       bool
+	}{
+		`required and missing`:     {country: "US", province: "TX", dateOfBirth: "", valid: false},
+		`required and provided`:    {country: "US", province: "TX", dateOfBirth: "1990-01-01", valid: true},
+		`not required and missing`: {country: "CA", province: "ON", dateOfBirth: "", valid: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			usr := User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: tt.country,
+				ProvinceCode:      tt.province,
+				DateOfBirth:       tt.dateOfBirth,
+			}
+
+			rules.ValidateUser(v, &usr)
+
+			if _, found := v.Errors["date_of_birth"]; found == tt.valid {
+				t.Errorf("unexpected validation of the date of birth: errors %v", v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateMaxDependents(t *testing.T) {
+	rules := Rules{Regions: DefaultRegions, MaxDependents: 3}
+
+	tests := map[string]struct {
+		dependents int
+		valid      bool
+	}{
+		`at the maximum`:    {dependents: 3, valid: true},
+		`above the maximum`: {dependents: 4, valid: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			usr := User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "CA",
+				ProvinceCode:      "ON",
+			}
+			for i := 0; i < tt.dependents; i++ {
+				usr.Dependents = append(usr.Dependents, FamilyMember{Type: "child", FirstName: "Jane"})
+			}
+
+			rules.ValidateUser(v, &usr)
+
+			if _, found := v.Errors["dependents"]; found == tt.valid {
+				t.Errorf("unexpected validation of the dependents: errors %v", v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateFutureMilestones(t *testing.T) {
+	now := func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) }
+
+	tests := map[string]struct {
+		reject bool
+		date   string
+		valid  bool
+	}{
+		`past date`:           {reject: true, date: "2023-11-02", valid: true},
+		`current day`:         {reject: true, date: "2024-03-15", valid: true},
+		`future date`:         {reject: true, date: "2024-03-16", valid: false},
+		`future date allowed`: {reject: false, date: "2024-03-16", valid: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rules := Rules{Regions: DefaultRegions, RejectFutureMilestones: tt.reject, Now: now}
+			v := validator.New()
+			usr := User{
+				Email:             "john.doe@example.com",
+				FirstName:         "John",
+				CountryCodeAlpha2: "CA",
+				ProvinceCode:      "ON",
+				Milestones: []Milestone{
+					{Date: "2020-01-01", Title: "Car paid off", Type: "Debt"},
+					{Date: tt.date, Title: "Emergency fund", Type: "Savings"},
+				},
+			}
+
+			rules.ValidateUser(v, &usr)
+
+			if _, found := v.Errors["milestone_1_date"]; found {
+				t.Errorf("unexpected error for the first milestone: errors %v", v.Errors)
+			}
+			if _, found := v.Errors["milestone_2_date"]; found == tt.valid {
+				t.Errorf("unexpected validation of the milestone date: errors %v", v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateDates(t *testing.T) {
+	now := func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) }
+
+	tests := map[string]struct {
+		user     User
+		errorKey string
+	}{
+		`valid dates`: {
+			user: User{
+				DateOfBirth: "1990-05-01",
+				Milestones:  []Milestone{{Date: "2020-01-01", Type: "Debt"}},
+				Goals:       []Goal{{Date: "2030-01-01", ProgressLevel: "not_started"}},
+				Protections: []Protection{{ClaimedDate: "2021-06-30", ExpirationDate: "2031-06-30"}},
+			},
+		},
+		`dates not provided`: {
+			user: User{Milestones: []Milestone{{Type: "Debt"}}, Goals: []Goal{{ProgressLevel: "not_started"}}, Protections: []Protection{{}}},
+		},
+		`malformed date of birth`:     {user: User{DateOfBirth: "yesterday"}, errorKey: "date_of_birth"},
+		`date of birth in the future`: {user: User{DateOfBirth: "2024-03-16"}, errorKey: "date_of_birth"},
+		`date of birth today`:         {user: User{DateOfBirth: "2024-03-15"}},
+		`malformed milestone date`:    {user: User{Milestones: []Milestone{{Date: "01/01/2020", Type: "Debt"}}}, errorKey: "milestone_1_date"},
+		`malformed goal date`:         {user: User{Goals: []Goal{{Date: "next year", ProgressLevel: "not_started"}}}, errorKey: "goal_1_date"},
+		`malformed expiration date`:   {user: User{Protections: []Protection{{ExpirationDate: "2031-13-01"}}}, errorKey: "protection_1_expiration_date"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			rules := Rules{Regions: DefaultRegions, Now: now}
+			v := validator.New()
+			usr := tt.user
+			usr.Email = "john.doe@example.com"
+			usr.FirstName = "John"
+			usr.CountryCodeAlpha2 = "CA"
+			usr.ProvinceCode = "ON"
+
+			rules.ValidateUser(v, &usr)
+
+			if tt.errorKey == "" {
+				if !v.Valid() {
+					t.Errorf("unexpected errors: %v", v.Errors)
+				}
+				return
+			}
+			if _, found := v.Errors[tt.errorKey]; !found || len(v.Errors) != 1 {
+				t.Errorf("expected a single error for %s: errors %v", tt.errorKey, v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateMeta(t *testing.T) {
+	tests := map[string]struct {
+		size  int
+		valid bool
+	}{
+		`at the maximum size`:    {size: 16, valid: true},
+		`above the maximum size`: {size: 17, valid: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			meta := MetaField{Key: "theme", Value: strings.Repeat("a", tt.size)}
+
+			ValidateMeta(v, &meta, "meta_1", 16)
+
+			if _, found := v.Errors["meta_1_value"]; found == tt.valid {
+				t.Errorf("unexpected validation of the meta value: errors %v", v.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateGoalDuration(t *testing.T) {
+	tests := map[string]struct {
+		duration time.Duration
+		valid    bool
+	}{
+		`negative`:                {duration: -time.Nanosecond, valid: false},
+		`zero`:                    {duration: 0, valid: true},
+		`at the maximum duration`: {duration: 100 * Year, valid: true},
+		`above the maximum`:       {duration: 100*Year + time.Nanosecond, valid: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			goal := Goal{ProgressLevel: GoalProgressLevels[0], EstimatedDuration: tt.duration}
+
+			ValidateGoal(v, &goal, "goal_1", DefaultMaxGoalDuration)
+
+			if _, found := v.Errors["goal_1_estimated_duration"]; found == tt.valid {
+				t.Errorf("unexpected validation of the estimated duration: errors %v", v.Errors)
+			}
+		})
+	}
+
+	v := validator.New()
+	ValidateGoal(v, &Goal{ProgressLevel: GoalProgressLevels[0], EstimatedDuration: 200 * Year}, "goal_1", 0)
+	if !v.Valid() {
+		t.Errorf("unexpected errors for unlimited durations: %v", v.Errors)
+	}
+}
+
+func TestFilterMeta(t *testing.T) {
+	meta := []MetaField{
+		{Key: "theme", Namespace: "ui", Value: "dark"},
+		{Key: "campaign", Namespace: "marketing", Value: "spring"},
+	}
+
+	tests := map[string]struct {
+		policy  MetaPolicy
+		kept    int
+		dropped int
+		valid   bool
+	}{
+		`passthrough`: {policy: MetaPassthrough, kept: 2, dropped: 0, valid: true},
+		`strip`:       {policy: MetaStrip, kept: 1, dropped: 1, valid: true},
+		`reject`:      {policy: MetaReject, kept: 2, dropped: 0, valid: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator.New()
+			rules := Rules{MetaNamespaces: []string{"ui"}, MetaPolicy: tt.policy}
+
+			kept, dropped := rules.FilterMeta(v, meta)
+
+			if len(kept) != tt.kept || len(dropped) != tt.dropped {
+				t.Errorf("unexpected meta: kept %v, dropped %v", kept, dropped)
+			}
+			if tt.dropped > 0 && dropped[0].Namespace != "marketing" {
+				t.Errorf("unexpected dropped meta: %v", dropped)
+			}
+			if _, found := v.Errors["meta_2_namespace"]; found == tt.valid {
+				t.Errorf("unexpected validation of the meta namespaces: errors %v", v.Errors)
+			}
+		})
+	}
+}
+
+func TestUserJSONKeys(t *testing.T) {
+	usr := User{
+		ID:                     "f8ae3ad1-d5c7-4465-b446-2e931606e938",
+		Email:                  "john.doe@example.com",
+		FirstName:              "John",
+		LastName:               "Doe",
+		ProvinceCode:           "ON",
+		CountryCodeAlpha2:      "CA",
+		Currency:               "CAD",
+		AdministrativeDivision: "province",
+		Income:                 100000,
+		Milestones:             []Milestone{{Date: "2023-02-05", Title: "Bank Opened"}},
+		CreatedAt:              "2023-02-05",
+		Version:                3,
+		Verification:           &Verification{TokenHash: "hash"},
+	}
+
+	js, err := json.Marshal(usr)
+	if err != nil {
+		t.Fatalf("failed to marshal user: %v", err)
+	}
+
+	var object map[string]json.RawMessage
+	if err = json.Unmarshal(js, &object); err != nil {
+		t.Fatalf("failed to unmarshal user: %v", err)
+	}
+
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	expected := []string{
+		"activated", "administrative_division", "country_code_alpha_2", "created_at", "currency",
+		"email", "first_name", "id", "income", "last_name", "milestones", "province_code",
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("unexpected keys: got %v, want %v", keys, expected)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("unexpected keys: got %v, want %v", keys, expected)
+		}
+	}
+
+	var milestones []map[string]string
+	if err = json.Unmarshal(object["milestones"], &milestones); err != nil || milestones[0]["title"] != "Bank Opened" {
+		t.Errorf("unexpected milestones: %s", object["milestones"])
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
+	"time"
+)
+
+// VerificationTTL is how long a verification token can be used.
+const VerificationTTL = 24 * time.Hour
+
+// Verification is the pending verification of the email of a user.
+//
+// Only the hash of the token is stored, the token itself is sent to
+// the user.
+type Verification struct {
+	TokenHash string `dynamodbav:"tokenHash"`
+	ExpiresAt string `dynamodbav:"expiresAt"`
+}
+
+// NewVerification generates a verification token expiring after
+// VerificationTTL.
+func NewVerification(now time.Time) (string, *Verification, error) {
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(random)
+
+	return token, &Verification{
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(VerificationTTL).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// Matches reports whether the token is the one of the verification,
+// and has not expired.
+func (v *Verification) Matches(token string, now time.Time) bool {
+	if v == nil {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, v.ExpiresAt)
+	if err != nil || !now.Before(expiresAt) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(v.TokenHash)) == 1
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
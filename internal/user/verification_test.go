@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	xerrors "user-service.mykapital.io/internal/errors"
+)
+
+func TestVerificationMatches(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	token, verification, err := NewVerification(now)
+	if err != nil {
+		t.Fatalf("failed to create verification: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		now   time.Time
+		want  bool
+	}{
+		{"valid token", token, now.Add(time.Hour), true},
+		{"wrong token", token + "A", now.Add(time.Hour), false},
+		{"expired token", token, now.Add(VerificationTTL), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verification.Matches(tt.token, tt.now); got != tt.want {
+				t.Errorf("unexpected match: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var missing *Verification
+	if missing.Matches(token, now) {
+		t.Errorf("missing verification matched")
+	}
+}
+
+func TestActivate(t *testing.T) {
+	_, verification, err := NewVerification(time.Now())
+	if err != nil {
+		t.Fatalf("failed to create verification: %v", err)
+	}
+	model, _ := newFakeModel(t, User{ID: "1", Version: 1, Verification: verification})
+
+	usr, err := model.Get(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if err = model.Activate(context.Background(), usr); err != nil {
+		t.Fatalf("failed to activate user: %v", err)
+	}
+
+	stored, err := model.Get(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if !stored.Activated || stored.Verification != nil || stored.Version != 2 {
+		t.Errorf("user is not activated: %+v", stored)
+	}
+
+	stale := &User{ID: "1", Version: 1}
+	if err = model.Activate(context.Background(), stale); err != xerrors.ErrEditConflict {
+		t.Errorf("unexpected error: got %v, want %v", err, xerrors.ErrEditConflict)
+	}
+}
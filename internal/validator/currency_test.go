@@ -0,0 +1,42 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validator
+
+import "testing"
+
+func TestIsCurrency(t *testing.T) {
+	tests := map[string]struct {
+		code     string
+		expected bool
+	}{
+		`us dollar`:       {code: "USD", expected: true},
+		`canadian dollar`: {code: "CAD", expected: true},
+		`japanese yen`:    {code: "JPY", expected: true},
+		`lower case`:      {code: "usd", expected: false},
+		`two letters`:     {code: "US", expected: false},
+		`unknown code`:    {code: "XYZ", expected: false},
+		`empty code`:      {code: "", expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IsCurrency(tt.code); got != tt.expected {
+				t.Errorf("IsCurrency(%q) = %v; want %v", tt.code, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validator
+
+import (
+	"regexp"
+	"strings"
+)
+
+// PostalCodeRXs maps two-letter country codes to the regex of their
+// postal codes.
+var PostalCodeRXs = map[string]*regexp.Regexp{
+	// ZIP or ZIP+4 code, such as 12345 or 12345-6789.
+	"US": regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`),
+	// A1A 1A1, without the letters D, F, I, O, Q and U, nor W and Z as the
+	// first letter. The space is optional.
+	"CA": regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY][0-9][ABCEGHJ-NPRSTV-Z] ?[0-9][ABCEGHJ-NPRSTV-Z][0-9]$`),
+}
+
+// ValidPostalCode returns true if code is a postal code of the country.
+//
+// The comparison is case-insensitive. True is returned for a country
+// missing from PostalCodeRXs, as its format is unknown.
+func ValidPostalCode(country, code string) bool {
+	rx, ok := PostalCodeRXs[strings.ToUpper(country)]
+	if !ok {
+		return true
+	}
+
+	return Matches(strings.ToUpper(code), rx)
+}
+
+// ValidPostalCodeStrict is like ValidPostalCode, but returns false for a
+// country missing from PostalCodeRXs.
+func ValidPostalCodeStrict(country, code string) bool {
+	if _, ok := PostalCodeRXs[strings.ToUpper(country)]; !ok {
+		return false
+	}
+
+	return ValidPostalCode(country, code)
+}
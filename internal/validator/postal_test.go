@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validator
+
+import "testing"
+
+func TestValidPostalCode(t *testing.T) {
+	tests := map[string]struct {
+		country        string
+		code           string
+		expected       bool
+		expectedStrict bool
+	}{
+		`zip code`:                  {country: "US", code: "90210", expected: true, expectedStrict: true},
+		`zip+4 code`:                {country: "US", code: "90210-1234", expected: true, expectedStrict: true},
+		`short zip code`:            {country: "US", code: "9021", expected: false, expectedStrict: false},
+		`incomplete zip+4 code`:     {country: "US", code: "90210-12", expected: false, expectedStrict: false},
+		`canadian code in the US`:   {country: "US", code: "K1A 0B1", expected: false, expectedStrict: false},
+		`canadian code`:             {country: "CA", code: "K1A 0B1", expected: true, expectedStrict: true},
+		`canadian code, no space`:   {country: "CA", code: "K1A0B1", expected: true, expectedStrict: true},
+		`lower case`:                {country: "ca", code: "h2x 1y4", expected: true, expectedStrict: true},
+		`forbidden letter`:          {country: "CA", code: "K1O 0B1", expected: false, expectedStrict: false},
+		`forbidden first letter`:    {country: "CA", code: "W1A 0B1", expected: false, expectedStrict: false},
+		`zip code in CA`:            {country: "CA", code: "90210", expected: false, expectedStrict: false},
+		`empty code`:                {country: "CA", code: "", expected: false, expectedStrict: false},
+		`country of unknown format`: {country: "FR", code: "75001", expected: true, expectedStrict: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ValidPostalCode(tt.country, tt.code); got != tt.expected {
+				t.Errorf("ValidPostalCode(%q, %q) = %v; want %v", tt.country, tt.code, got, tt.expected)
+			}
+			if got := ValidPostalCodeStrict(tt.country, tt.code); got != tt.expectedStrict {
+				t.Errorf("ValidPostalCodeStrict(%q, %q) = %v; want %v", tt.country, tt.code, got, tt.expectedStrict)
+			}
+		})
+	}
+}
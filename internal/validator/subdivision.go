@@ -0,0 +1,43 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validator
+
+import "strings"
+
+// Subdivisions maps two-letter country codes to the codes of their
+// subdivisions (ISO 3166-2 without the country prefix).
+var Subdivisions = map[string][]string{
+	"CA": {
+		"AB", "BC", "MB", "NB", "NL", "NS", "NT", "NU", "ON", "PE", "QC", "SK", "YT",
+	},
+	"US": {
+		"AL", "AK", "AZ", "AR", "CA", "CO", "CT", "DE", "FL", "GA",
+		"HI", "ID", "IL", "IN", "IA", "KS", "KY", "LA", "ME", "MD",
+		"MA", "MI", "MN", "MS", "MO", "MT", "NE", "NV", "NH", "NJ",
+		"NM", "NY", "NC", "ND", "OH", "OK", "OR", "PA", "RI", "SC",
+		"SD", "TN", "TX", "UT", "VT", "VA", "WA", "WV", "WI", "WY",
+		"DC", "AS", "GU", "MP", "PR", "UM", "VI",
+	},
+}
+
+// IsSubdivision returns true if code is a subdivision of the country.
+//
+// The comparison is case-insensitive. False is returned for a country
+// missing from Subdivisions.
+func IsSubdivision(country, code string) bool {
+	return In(strings.ToUpper(code), Subdivisions[strings.ToUpper(country)]...)
+}
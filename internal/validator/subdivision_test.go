@@ -0,0 +1,44 @@
+/*
+Copyright 2023 The Kapital Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validator
+
+import "testing"
+
+func TestIsSubdivision(t *testing.T) {
+	tests := map[string]struct {
+		country  string
+		code     string
+		expected bool
+	}{
+		`canadian province`:       {country: "CA", code: "ON", expected: true},
+		`american state`:          {country: "US", code: "TX", expected: true},
+		`california in the US`:    {country: "US", code: "CA", expected: true},
+		`lower case`:              {country: "ca", code: "qc", expected: true},
+		`american state in CA`:    {country: "CA", code: "TX", expected: false},
+		`canadian province in US`: {country: "US", code: "ON", expected: false},
+		`unknown country`:         {country: "ZZ", code: "ON", expected: false},
+		`empty code`:              {country: "CA", code: "", expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IsSubdivision(tt.country, tt.code); got != tt.expected {
+				t.Errorf("IsSubdivision(%q, %q) = %v; want %v", tt.country, tt.code, got, tt.expected)
+			}
+		})
+	}
+}
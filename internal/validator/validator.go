@@ -17,9 +17,15 @@ limitations under the License.
 // Package validator contains validation specifications.
 package validator
 
-import "regexp"
+import (
+	"regexp"
+	"time"
+	"unicode"
+)
 
 var (
+	// PhoneRX is the regex for a phone number in the E.164 format.
+	PhoneRX = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
 	// EmailRX is the regex for a valid email address.
 	EmailRX = regexp.MustCompile("^[a-zA-Z\\d.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z\\d](?:[a-zA-Z\\d-]{0,61}[a-zA-Z\\d])?(?:\\.[a-zA-Z\\d](?:[a-zA-Z\\d-]{0,61}[a-zA-Z\\d])?)*$")
 )
@@ -28,14 +34,17 @@ var (
 type Validator struct {
 	// Errors are the errors received when a specification fails
 	Errors map[string]string
+	// Warnings are the warnings received when a soft specification fails.
+	// They are surfaced to the client without failing the validation.
+	Warnings map[string]string
 }
 
-// New is a helper which creates a new Validator instance with an empty errors map.
+// New is a helper which creates a new Validator instance with empty errors and warnings maps.
 func New() *Validator {
-	return &Validator{Errors: make(map[string]string)}
+	return &Validator{Errors: make(map[string]string), Warnings: make(map[string]string)}
 }
 
-// Valid returns true if the errors map doesn't contain any entries.
+// Valid returns true if the errors map doesn't contain any entries. Warnings are ignored.
 func (v *Validator) Valid() bool {
 	return len(v.Errors) == 0
 }
@@ -54,6 +63,20 @@ func (v *Validator) Check(ok bool, key, message string) {
 	}
 }
 
+// AddWarning adds a warning message to the map (so long as no entry already exists for the given key).
+func (v *Validator) AddWarning(key, message string) {
+	if _, exists := v.Warnings[key]; !exists {
+		v.Warnings[key] = message
+	}
+}
+
+// Warn adds a warning message to the map only if a soft validation check is not 'ok'.
+func (v *Validator) Warn(ok bool, key, message string) {
+	if !ok {
+		v.AddWarning(key, message)
+	}
+}
+
 // In returns true if a specific value is in a list of strings.
 func In(value string, list ...string) bool {
 	for i := range list {
@@ -69,6 +92,24 @@ func Matches(value string, rx *regexp.Regexp) bool {
 	return rx.MatchString(value)
 }
 
+// Printable returns true if a string value contains no control characters,
+// such as newlines or NUL bytes.
+func Printable(value string) bool {
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsDate returns true if a string value is a calendar date formatted as
+// "2006-01-02", the full-date of RFC 3339.
+func IsDate(value string) bool {
+	_, err := time.Parse("2006-01-02", value)
+	return err == nil
+}
+
 // Unique returns true if all string values in a slice are unique.
 func Unique(values []string) bool {
 	uniqueValues := make(map[string]bool)
@@ -118,6 +118,24 @@ func TestValidator(t *testing.T) {
 	}
 }
 
+func TestWarn(t *testing.T) {
+	v := New()
+
+	v.Warn(false, "key1", "message1")
+	v.Warn(true, "key2", "message2")
+	v.Warn(false, "key1", "message3")
+
+	if !v.Valid() {
+		t.Errorf("warnings should not fail the validation")
+	}
+	if len(v.Warnings) != 1 || v.Warnings["key1"] != "message1" {
+		t.Errorf("unexpected warnings: got %v, want map[key1:message1]", v.Warnings)
+	}
+	if len(v.Errors) != 0 {
+		t.Errorf("unexpected errors: got %v, want none", v.Errors)
+	}
+}
+
 // parseErrorString parses the key and the message from error
 func parseErrorString(err string) (key string, message string) {
 	parsedString := strings.Split(err, ":")
@@ -236,3 +254,48 @@ func TestUnique(t *testing.T) {
 		})
 	}
 }
+
+func TestPrintable(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected bool
+	}{
+		`printable`:       {input: "Software engineer", expected: true},
+		`accented`:        {input: "Ingénieure", expected: true},
+		`newline`:         {input: "Software\nengineer", expected: false},
+		`nul byte`:        {input: "Software\x00", expected: false},
+		`empty printable`: {input: "", expected: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if result := Printable(tt.input); result != tt.expected {
+				t.Errorf("expected Printable(%q) to be %v, but got %v", tt.input, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestIsDate(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected bool
+	}{
+		`date`:            {input: "1990-05-01", expected: true},
+		`leap day`:        {input: "2024-02-29", expected: true},
+		`not a leap year`: {input: "2023-02-29", expected: false},
+		`word`:            {input: "yesterday", expected: false},
+		`timestamp`:       {input: "1990-05-01T00:00:00Z", expected: false},
+		`unpadded`:        {input: "1990-5-1", expected: false},
+		`day first`:       {input: "01-05-1990", expected: false},
+		`empty`:           {input: "", expected: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if result := IsDate(tt.input); result != tt.expected {
+				t.Errorf("expected IsDate(%q) to be %v, but got %v", tt.input, tt.expected, result)
+			}
+		})
+	}
+}